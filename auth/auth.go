@@ -0,0 +1,239 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// Roles. Each includes those before it: activation implies discovery,
+// and admin implies everything.
+const (
+	RoleRead     = "read"
+	RoleActivate = "activate"
+	RoleAdmin    = "admin"
+)
+
+var roleRanks = map[string]int{RoleRead: 1, RoleActivate: 2, RoleAdmin: 3}
+
+// Principal is an authenticated broker user, with the Planet Labs key,
+// if any, that is mapped to the user or the user's team
+type Principal struct {
+	User      string
+	Team      string
+	Roles     []string
+	PlanetKey string
+}
+
+// HasRole reports whether the principal has the role, directly or through a greater one
+func (p Principal) HasRole(role string) bool {
+	for _, held := range p.Roles {
+		if roleRanks[held] >= roleRanks[role] && roleRanks[held] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// StaticToken is an API token issued to a user
+type StaticToken struct {
+	Token string   `json:"token"`
+	User  string   `json:"user"`
+	Team  string   `json:"team"`
+	Roles []string `json:"roles"`
+}
+
+// JWTConfig says which JWTs to trust. The user is the sub claim; the team
+// and roles come from the claims named by TeamClaim and RolesClaim.
+type JWTConfig struct {
+	Secret     string `json:"secret"`
+	JWKSFile   string `json:"jwksFile"`
+	Issuer     string `json:"issuer"`
+	Audience   string `json:"audience"`
+	TeamClaim  string `json:"teamClaim"`  // default "team"
+	RolesClaim string `json:"rolesClaim"` // default "roles"
+}
+
+// PlanetKeys map users and teams to Planet Labs keys; a user's own
+// mapping wins over the team's
+type PlanetKeys struct {
+	Users map[string]string `json:"users"`
+	Teams map[string]string `json:"teams"`
+}
+
+// Config is the authentication configuration, as read from BF_AUTH_CONFIG
+type Config struct {
+	JWT        *JWTConfig    `json:"jwt,omitempty"`
+	Tokens     []StaticToken `json:"tokens"`
+	PlanetKeys PlanetKeys    `json:"planetKeys"`
+}
+
+// Authenticator authenticates broker users, with static API tokens or with
+// JWTs, and decides which Planet Labs key each user's requests use.
+// A nil Authenticator lets everything through, as when authentication
+// is not configured.
+type Authenticator struct {
+	config   Config
+	verifier *jwtVerifier
+	now      func() time.Time
+}
+
+type contextKey int
+
+const principalKey contextKey = 0
+
+// New creates an Authenticator
+func New(config Config) (*Authenticator, error) {
+	result := Authenticator{config: config, now: time.Now}
+	if config.JWT != nil {
+		result.verifier = &jwtVerifier{secret: []byte(config.JWT.Secret), issuer: config.JWT.Issuer, audience: config.JWT.Audience}
+		if config.JWT.JWKSFile != "" {
+			keys, err := loadJWKS(config.JWT.JWKSFile)
+			if err != nil {
+				return nil, err
+			}
+			result.verifier.keys = keys
+		}
+		if config.JWT.Secret == "" && len(result.verifier.keys) == 0 {
+			return nil, errors.New("JWT authentication needs a secret or a JWKS file")
+		}
+		if result.config.JWT.TeamClaim == "" {
+			result.config.JWT.TeamClaim = "team"
+		}
+		if result.config.JWT.RolesClaim == "" {
+			result.config.JWT.RolesClaim = "roles"
+		}
+		util.AddSecret(config.JWT.Secret)
+	}
+	for _, token := range config.Tokens {
+		util.AddSecret(token.Token)
+	}
+	for _, key := range config.PlanetKeys.Users {
+		util.AddSecret(key)
+	}
+	for _, key := range config.PlanetKeys.Teams {
+		util.AddSecret(key)
+	}
+	return &result, nil
+}
+
+// LoadConfig reads a JSON configuration file
+func LoadConfig(filename string) (Config, error) {
+	var result Config
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return result, err
+	}
+	if err = json.Unmarshal(bytes, &result); err != nil {
+		return result, fmt.Errorf("Failed to read authentication configuration %v: %v", filename, err)
+	}
+	return result, nil
+}
+
+// FromFile creates the Authenticator configured by the named file. Without
+// one, authentication is disabled and nil is returned.
+func FromFile(filename string) (*Authenticator, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	config, err := LoadConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	return New(config)
+}
+
+// Authenticate identifies the user making a request from the bearer token
+// in its Authorization header
+func (a *Authenticator) Authenticate(request *http.Request) (Principal, error) {
+	var result Principal
+	parts := strings.SplitN(request.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return result, errors.New("This operation requires a bearer token.")
+	}
+	token := strings.TrimSpace(parts[1])
+
+	found := false
+	for _, staticToken := range a.config.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(staticToken.Token)) == 1 {
+			result = Principal{User: staticToken.User, Team: staticToken.Team, Roles: staticToken.Roles}
+			found = true
+		}
+	}
+	if !found {
+		if a.verifier == nil {
+			return result, errors.New("The bearer token is invalid.")
+		}
+		claims, err := a.verifier.verify(token, a.now())
+		if err != nil {
+			return result, err
+		}
+		result.User, _ = claims["sub"].(string)
+		result.Team, _ = claims[a.config.JWT.TeamClaim].(string)
+		result.Roles = stringsClaim(claims[a.config.JWT.RolesClaim])
+	}
+
+	if key, ok := a.config.PlanetKeys.Users[result.User]; ok && result.User != "" {
+		result.PlanetKey = key
+	} else if key, ok := a.config.PlanetKeys.Teams[result.Team]; ok && result.Team != "" {
+		result.PlanetKey = key
+	}
+	return result, nil
+}
+
+// Require wraps a handler so that it only serves authenticated users with
+// the role. The principal is available to the handler through FromRequest.
+// CORS preflight requests carry no credentials and are let through.
+func (a *Authenticator) Require(role string, handler http.Handler) http.Handler {
+	if a == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		logContext := util.NewRequestLogContext(request.Context())
+		if request.Method == "OPTIONS" {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		principal, err := a.Authenticate(request)
+		if err != nil {
+			util.LogAlert(logContext, fmt.Sprintf("Refused %v %v: %v", request.Method, request.URL.Path, err.Error()))
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="bf-ia-broker"`)
+			util.HTTPError(request, writer, logContext, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !principal.HasRole(role) {
+			util.LogAlert(logContext, fmt.Sprintf("Refused %v %v to %v, who lacks the %v role", request.Method, request.URL.Path, principal.User, role))
+			util.HTTPError(request, writer, logContext, fmt.Sprintf("This operation requires the %v role.", role), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), principalKey, principal)))
+	})
+}
+
+// FromRequest returns the principal of an authenticated request
+func FromRequest(request *http.Request) (Principal, bool) {
+	principal, ok := request.Context().Value(principalKey).(Principal)
+	return principal, ok
+}
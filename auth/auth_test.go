@@ -0,0 +1,139 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestAuthenticator(t *testing.T) *Authenticator {
+	authenticator, err := New(Config{
+		JWT: &JWTConfig{Secret: testingSecret, JWKSFile: testingJWKSFile, RolesClaim: "scope"},
+		Tokens: []StaticToken{
+			{Token: "reader-token", User: "reader", Team: "analysts", Roles: []string{RoleRead}},
+			{Token: "admin-token", User: "root", Roles: []string{RoleAdmin}},
+		},
+		PlanetKeys: PlanetKeys{
+			Users: map[string]string{"alice": "ALICE_KEY"},
+			Teams: map[string]string{"analysts": "ANALYSTS_KEY"},
+		},
+	})
+	assert.Nil(t, err)
+	return authenticator
+}
+
+func authorizedRequest(token string) *http.Request {
+	request := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return request
+}
+
+func TestHasRole(t *testing.T) {
+	assert.True(t, Principal{Roles: []string{RoleAdmin}}.HasRole(RoleActivate))
+	assert.True(t, Principal{Roles: []string{RoleActivate}}.HasRole(RoleRead))
+	assert.False(t, Principal{Roles: []string{RoleRead}}.HasRole(RoleActivate))
+	assert.False(t, Principal{Roles: []string{"unknown"}}.HasRole("other"))
+	assert.False(t, Principal{}.HasRole(RoleRead))
+}
+
+func TestAuthenticate(t *testing.T) {
+	authenticator := createTestAuthenticator(t)
+
+	principal, err := authenticator.Authenticate(authorizedRequest("reader-token"))
+	assert.Nil(t, err)
+	assert.Equal(t, Principal{User: "reader", Team: "analysts", Roles: []string{RoleRead}, PlanetKey: "ANALYSTS_KEY"}, principal)
+
+	token := makeToken("RS256", map[string]interface{}{"sub": "alice", "team": "analysts", "scope": "read activate"})
+	principal, err = authenticator.Authenticate(authorizedRequest(token))
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", principal.User)
+	assert.Equal(t, []string{RoleRead, RoleActivate}, principal.Roles)
+	assert.Equal(t, "ALICE_KEY", principal.PlanetKey, "Expected the user's key to win over the team's")
+
+	for _, token := range []string{"", "unknown-token", makeToken("HS256", map[string]interface{}{"sub": "bob", "exp": 1})} {
+		_, err = authenticator.Authenticate(authorizedRequest(token))
+		assert.NotNil(t, err, "Expected %v to fail", token)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	var served Principal
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		served, _ = FromRequest(request)
+	})
+	authenticator := createTestAuthenticator(t)
+	tests := []struct {
+		token  string
+		role   string
+		status int
+	}{
+		{"", RoleRead, http.StatusUnauthorized},
+		{"bad-token", RoleRead, http.StatusUnauthorized},
+		{"reader-token", RoleRead, http.StatusOK},
+		{"reader-token", RoleActivate, http.StatusForbidden},
+		{"admin-token", RoleActivate, http.StatusOK},
+	}
+	for _, test := range tests {
+		served = Principal{}
+		recorder := httptest.NewRecorder()
+		authenticator.Require(test.role, handler).ServeHTTP(recorder, authorizedRequest(test.token))
+		assert.Equal(t, test.status, recorder.Code, "Unexpected status for %v needing %v", test.token, test.role)
+		if test.status == http.StatusOK {
+			assert.NotEmpty(t, served.User)
+		} else {
+			assert.Empty(t, served.User)
+		}
+	}
+
+	// Preflight requests carry no credentials
+	recorder := httptest.NewRecorder()
+	authenticator.Require(RoleRead, handler).ServeHTTP(recorder, httptest.NewRequest("OPTIONS", "/planet/discover/rapideye", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// Without configuration, everything is let through
+	var disabled *Authenticator
+	recorder = httptest.NewRecorder()
+	disabled.Require(RoleAdmin, handler).ServeHTTP(recorder, authorizedRequest(""))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestFromFile(t *testing.T) {
+	authenticator, err := FromFile("")
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator, "Expected authentication to be disabled without a file")
+
+	file, _ := ioutil.TempFile("", "auth")
+	file.WriteString(`{"tokens": [{"token": "file-token", "user": "carol", "roles": ["read"]}], "planetKeys": {"users": {"carol": "CAROL_KEY"}}}`)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	authenticator, err = FromFile(file.Name())
+	if assert.Nil(t, err) && assert.NotNil(t, authenticator) {
+		principal, err := authenticator.Authenticate(authorizedRequest("file-token"))
+		assert.Nil(t, err)
+		assert.Equal(t, "CAROL_KEY", principal.PlanetKey)
+	}
+
+	_, err = New(Config{JWT: &JWTConfig{}})
+	assert.NotNil(t, err, "Expected JWT configuration without a secret or keys to fail")
+}
@@ -0,0 +1,199 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// leeway allows for clock skew between the token issuer and the broker
+const leeway = time.Minute
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwk is a JSON Web Key; only RSA signing keys are used
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// jwtVerifier checks JWT signatures and registered claims. HS256 tokens
+// are checked against the shared secret and RS256 tokens against the keys
+// of a local JWKS; no other algorithm is accepted.
+type jwtVerifier struct {
+	secret   []byte
+	keys     map[string]*rsa.PublicKey
+	issuer   string
+	audience string
+}
+
+// loadJWKS reads the RSA signing keys of a JWKS file, by key ID
+func loadJWKS(filename string) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bytes, &jwks); err != nil {
+		return nil, fmt.Errorf("Failed to read JWKS %v: %v", filename, err)
+	}
+	result := make(map[string]*rsa.PublicKey)
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("The JWKS key %v has an invalid modulus", key.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("The JWKS key %v has an invalid exponent", key.Kid)
+		}
+		result[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return result, nil
+}
+
+// verify checks a token and returns its claims
+func (v *jwtVerifier) verify(token string, now time.Time) (map[string]interface{}, error) {
+	var (
+		header jwtHeader
+		claims map[string]interface{}
+	)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("The token is not a JWT")
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("The token signature is malformed")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signed)
+
+	switch header.Alg {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("The token signature is invalid")
+		}
+	case "RS256":
+		key := v.keys[header.Kid]
+		if key == nil && header.Kid == "" && len(v.keys) == 1 {
+			for _, onlyKey := range v.keys {
+				key = onlyKey
+			}
+		}
+		if key == nil {
+			return nil, errors.New("The token was signed by an unknown key")
+		}
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.New("The token signature is invalid")
+		}
+	default:
+		return nil, fmt.Errorf("The token algorithm %v is not accepted", header.Alg)
+	}
+
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err = v.checkClaims(claims, now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkClaims checks the time limits, issuer and audience of a token
+func (v *jwtVerifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return errors.New("The token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-leeway)) {
+		return errors.New("The token is not yet valid")
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return errors.New("The token issuer is not trusted")
+	}
+	if v.audience != "" && !contains(stringsClaim(claims["aud"]), v.audience) {
+		return errors.New("The token is not intended for this broker")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, output interface{}) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(segment)
+	if err == nil {
+		err = json.Unmarshal(bytes, output)
+	}
+	if err != nil {
+		return errors.New("The token is malformed")
+	}
+	return nil
+}
+
+// stringsClaim reads a claim that may be a single string, a space-separated
+// list (as with scope), or an array of strings
+func stringsClaim(claim interface{}) []string {
+	switch typed := claim.(type) {
+	case string:
+		return strings.Fields(typed)
+	case []interface{}:
+		var result []string
+		for _, item := range typed {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
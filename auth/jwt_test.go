@@ -0,0 +1,69 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTVerify(t *testing.T) {
+	keys, err := loadJWKS(testingJWKSFile)
+	assert.Nil(t, err)
+	verifier := jwtVerifier{secret: []byte(testingSecret), keys: keys, issuer: "https://issuer", audience: "bf-ia-broker"}
+	now := time.Unix(1500000000, 0)
+	valid := map[string]interface{}{"sub": "alice", "iss": "https://issuer", "aud": []string{"other", "bf-ia-broker"}, "exp": 1500000100, "nbf": 1499999900}
+
+	for _, alg := range []string{"HS256", "RS256"} {
+		claims, err := verifier.verify(makeToken(alg, valid), now)
+		if assert.Nil(t, err, "Expected a valid %v token to verify", alg) {
+			assert.Equal(t, "alice", claims["sub"])
+		}
+	}
+
+	tests := map[string]map[string]interface{}{
+		"expired":      {"sub": "alice", "iss": "https://issuer", "aud": "bf-ia-broker", "exp": 1499999000},
+		"not yet":      {"sub": "alice", "iss": "https://issuer", "aud": "bf-ia-broker", "nbf": 1500001000},
+		"wrong issuer": {"sub": "alice", "iss": "https://other", "aud": "bf-ia-broker"},
+		"no audience":  {"sub": "alice", "iss": "https://issuer"},
+	}
+	for name, claims := range tests {
+		_, err = verifier.verify(makeToken("HS256", claims), now)
+		assert.NotNil(t, err, "Expected a token that is %v to fail", name)
+	}
+
+	// Tampering, unsigned tokens and other algorithms are all refused
+	token := makeToken("HS256", valid)
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory"}`)) + "." + parts[2]
+	for _, bad := range []string{tampered, parts[0] + "." + parts[1] + ".", "e30.e30.", "not a token", makeToken("none", valid)} {
+		_, err = verifier.verify(bad, now)
+		assert.NotNil(t, err, "Expected %v to fail", bad)
+	}
+
+	// A verifier without a secret refuses HS256, lest the public key be used as one
+	_, err = (&jwtVerifier{keys: keys}).verify(makeToken("HS256", valid), now)
+	assert.NotNil(t, err)
+}
+
+func TestStringsClaim(t *testing.T) {
+	assert.Equal(t, []string{"read", "activate"}, stringsClaim("read activate"))
+	assert.Equal(t, []string{"read"}, stringsClaim([]interface{}{"read", 3}))
+	assert.Nil(t, stringsClaim(3.0))
+}
@@ -0,0 +1,83 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+)
+
+const (
+	testingSecret = "a shared secret"
+	testingKID    = "key1"
+)
+
+var (
+	testingRSAKey   *rsa.PrivateKey
+	testingJWKSFile string
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	if testingRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	jwks := map[string][]map[string]string{"keys": {{
+		"kty": "RSA",
+		"kid": testingKID,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(testingRSAKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(testingRSAKey.E)).Bytes()),
+	}}}
+	file, err := ioutil.TempFile("", "jwks")
+	if err != nil {
+		panic(err)
+	}
+	json.NewEncoder(file).Encode(jwks)
+	file.Close()
+	testingJWKSFile = file.Name()
+
+	code := m.Run()
+	os.Remove(testingJWKSFile)
+	os.Exit(code)
+}
+
+// makeToken signs the claims with HS256 and the testing secret,
+// or with RS256 and the testing RSA key
+func makeToken(alg string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": testingKID})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte(testingSecret))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, testingRSAKey, crypto.SHA256, digest[:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
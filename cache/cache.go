@@ -0,0 +1,57 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Cache is a store of serialized responses. Values are byte slices so that
+// a shared backend can be plugged in without knowing what they represent.
+type Cache interface {
+	// Get returns the value for the key, if it is present and unexpired
+	Get(key string) ([]byte, bool)
+	// Set stores the value for the key for the given duration
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes the key
+	Delete(key string)
+	// Stats returns the usage counts of the cache
+	Stats() Stats
+}
+
+// Stats are the usage counts of a Cache, for monitoring
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+// HitRatio returns the fraction of lookups that were hits
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// HashSecret returns a digest of a secret, such as an API key,
+// that is suitable for use in a cache key
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,88 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUGetSet(t *testing.T) {
+	c := NewLRU(10)
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+
+	c.Set("key", []byte("value"), time.Minute)
+	value, ok := c.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, "value", string(value))
+
+	c.Delete("key")
+	_, ok = c.Get("key")
+	assert.False(t, ok)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.InDelta(t, 1.0/3.0, stats.HitRatio(), 1e-9)
+}
+
+func TestLRUExpiry(t *testing.T) {
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	c.Set("short", []byte("1"), time.Second)
+	c.Set("long", []byte("2"), time.Hour)
+	now = now.Add(time.Minute)
+
+	_, ok := c.Get("short")
+	assert.False(t, ok, "Expected the short-lived entry to expire")
+	_, ok = c.Get("long")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Stats().Entries)
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", []byte("a"), time.Minute)
+	c.Set("b", []byte("b"), time.Minute)
+	c.Get("a")
+	c.Set("c", []byte("c"), time.Minute)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok, "Expected the least recently used entry to be evicted")
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+	assert.Equal(t, 2, c.Stats().Entries)
+}
+
+func TestLRUDisabled(t *testing.T) {
+	c := NewLRU(0)
+	c.Set("a", []byte("a"), time.Minute)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
+
+func TestHashSecret(t *testing.T) {
+	assert.Equal(t, HashSecret("key"), HashSecret("key"))
+	assert.NotEqual(t, HashSecret("key"), HashSecret("other key"))
+	assert.NotContains(t, HashSecret("key"), "key")
+}
@@ -92,6 +92,76 @@ cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/util
 go test -v -coverprofile=$root/util.cov github.com/venicegeo/dg-bf-ia-broker/util
 go tool cover -func=$root/util.cov -o $root/util.cov.txt
 
+# Auth package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/auth
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/auth.cov github.com/venicegeo/dg-bf-ia-broker/auth
+go tool cover -func=$root/auth.cov -o $root/auth.cov.txt
+
+# Cache package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/cache
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/cache.cov github.com/venicegeo/dg-bf-ia-broker/cache
+go tool cover -func=$root/cache.cov -o $root/cache.cov.txt
+
+# Encoder package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/encoder
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/encoder.cov github.com/venicegeo/dg-bf-ia-broker/encoder
+go tool cover -func=$root/encoder.cov -o $root/encoder.cov.txt
+
+# STAC package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/stac
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/stac.cov github.com/venicegeo/dg-bf-ia-broker/stac
+go tool cover -func=$root/stac.cov -o $root/stac.cov.txt
+
+# OGC package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/ogc
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/ogc.cov github.com/venicegeo/dg-bf-ia-broker/ogc
+go tool cover -func=$root/ogc.cov -o $root/ogc.cov.txt
+
+# Ratelimit package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/ratelimit
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/ratelimit.cov github.com/venicegeo/dg-bf-ia-broker/ratelimit
+go tool cover -func=$root/ratelimit.cov -o $root/ratelimit.cov.txt
+
+# Config package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/config
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/config.cov github.com/venicegeo/dg-bf-ia-broker/config
+go tool cover -func=$root/config.cov -o $root/config.cov.txt
+
+# Lifecycle package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/lifecycle
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/lifecycle.cov github.com/venicegeo/dg-bf-ia-broker/lifecycle
+go tool cover -func=$root/lifecycle.cov -o $root/lifecycle.cov.txt
+
+# Metrics package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/metrics
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/metrics.cov github.com/venicegeo/dg-bf-ia-broker/metrics
+go tool cover -func=$root/metrics.cov -o $root/metrics.cov.txt
+
+# Trace package
+cd $GOPATH/src/github.com/venicegeo/dg-bf-ia-broker/trace
+
+# run unit tests w/ coverage collection
+go test -v -coverprofile=$root/trace.cov github.com/venicegeo/dg-bf-ia-broker/trace
+go tool cover -func=$root/trace.cov -o $root/trace.cov.txt
+
 # gather some data about the repo
 
 cd $root
@@ -103,7 +173,27 @@ tar cvzf $APP.$EXT \
     tides.cov \
     tides.cov.txt \
     util.cov \
-    util.cov.txt
+    util.cov.txt \
+    cache.cov \
+    cache.cov.txt \
+    encoder.cov \
+    encoder.cov.txt \
+    stac.cov \
+    stac.cov.txt \
+    ogc.cov \
+    ogc.cov.txt \
+    auth.cov \
+    auth.cov.txt \
+    ratelimit.cov \
+    ratelimit.cov.txt \
+    config.cov \
+    config.cov.txt \
+    lifecycle.cov \
+    lifecycle.cov.txt \
+    metrics.cov \
+    metrics.cov.txt \
+    trace.cov \
+    trace.cov.txt
 #    tides-lint.txt \
 #    util-lint.txt \
 #    planet-lint.txt \
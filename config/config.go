@@ -0,0 +1,597 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/venicegeo/dg-bf-ia-broker/landsat"
+	"github.com/venicegeo/dg-bf-ia-broker/lifecycle"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/ratelimit"
+	"github.com/venicegeo/dg-bf-ia-broker/tides"
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// DefaultRequestTimeout is long enough for a search with tides
+const DefaultRequestTimeout = 2 * time.Minute
+
+// FileFlag names the flag, and FileEnv the environment variable, giving the
+// configuration file
+const (
+	FileFlag = "config"
+	FileEnv  = "BF_CONFIG_FILE"
+)
+
+// Config is the configuration of the broker. Each setting is taken from, in
+// increasing order of precedence: its default, the configuration file, its
+// environment variable and its command-line flag. Durations are in seconds.
+// A section's env tag prefixes the environment variables of its settings.
+type Config struct {
+	Server       Server     `json:"server"`
+	Planet       Planet     `json:"planet"`
+	Tides        Tides      `json:"tides"`
+	Landsat      Landsat    `json:"landsat"`
+	Auth         Auth       `json:"auth"`
+	RateLimit    RateLimit  `json:"rateLimit"`
+	Retry        Retry      `json:"retry"`
+	Redaction    Redaction  `json:"redaction"`
+	Log          Log        `json:"log"`
+	Trace        Trace      `json:"trace"`
+	HTTP         HTTPClient `json:"http" env:"BF_HTTP_"`
+	HTTPPlanet   HTTPClient `json:"httpPlanet" env:"BF_HTTP_PLANET_"`
+	HTTPTides    HTTPClient `json:"httpTides" env:"BF_HTTP_TIDES_"`
+	HTTPLandsat  HTTPClient `json:"httpLandsat" env:"BF_HTTP_LANDSAT_"`
+	HTTPSentinel HTTPClient `json:"httpSentinel" env:"BF_HTTP_SENTINEL_"`
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port            int           `json:"port" env:"PORT" help:"Port to listen on"`
+	ShutdownTimeout time.Duration `json:"shutdownTimeout" env:"BF_SHUTDOWN_TIMEOUT" help:"Seconds that requests in flight may take to finish when shutting down"`
+	ShutdownDelay   time.Duration `json:"shutdownDelay" env:"BF_SHUTDOWN_DELAY" help:"Seconds to report not ready before refusing new requests when shutting down"`
+	RequestTimeout  time.Duration `json:"requestTimeout" env:"BF_REQUEST_TIMEOUT" help:"Seconds a request may take before its upstream requests are abandoned; 0 for no limit"`
+}
+
+// Planet configures requests to Planet Labs
+type Planet struct {
+	APIURL                  string        `json:"apiURL" env:"PL_API_URL" help:"Planet Labs API URL"`
+	ServerKey               string        `json:"serverKey" env:"PL_SERVER_API_KEY" secret:"true" help:"Planet Labs key used for every client"`
+	ClientTokens            []string      `json:"clientTokens" env:"BF_CLIENT_TOKENS" secret:"true" help:"Bearer tokens that clients present to use the server key"`
+	AllowQueryKey           bool          `json:"allowQueryKey" env:"PL_ALLOW_QUERY_KEY" help:"Accept the deprecated PL_API_KEY query parameter"`
+	DisablePermissionsCheck bool          `json:"disablePermissionsCheck" env:"PL_DISABLE_PERMISSIONS_CHECK" help:"Return scenes the key cannot download"`
+	CacheSize               int           `json:"cacheSize" env:"PL_CACHE_SIZE" help:"Planet Labs responses to cache; 0 disables caching"`
+	CacheTTL                time.Duration `json:"cacheTTL" env:"PL_CACHE_TTL" help:"Seconds to cache search and metadata responses"`
+	AssetCacheTTL           time.Duration `json:"assetCacheTTL" env:"PL_CACHE_ASSET_TTL" help:"Seconds to cache asset responses"`
+	RateLimit               float64       `json:"rateLimit" env:"PL_RATE_LIMIT" help:"Requests per second to Planet Labs; 0 disables the limit"`
+	RateBurst               int           `json:"rateBurst" env:"PL_RATE_BURST" help:"Requests to Planet Labs allowed at once"`
+	RateMaxWait             time.Duration `json:"rateMaxWait" env:"PL_RATE_MAX_WAIT" help:"Seconds a request may wait for its turn"`
+}
+
+// Tides configures tide predictions
+type Tides struct {
+	URL                string  `json:"url" env:"BF_TIDE_PREDICTION_URL" help:"Tide prediction service URL"`
+	Source             string  `json:"source" env:"BF_TIDE_SOURCE" help:"Tide sources to try, comma-separated: service, harmonic or noaa"`
+	NOAAURL            string  `json:"noaaURL" env:"BF_TIDE_NOAA_URL" help:"NOAA CO-OPS data API URL"`
+	ConstituentsFile   string  `json:"constituentsFile" env:"BF_TIDE_CONSTITUENTS_FILE" help:"JSON file of tide stations and their constituents"`
+	MaxStationDistance float64 `json:"maxStationDistance" env:"BF_TIDE_MAX_STATION_DISTANCE" help:"Kilometers to the farthest usable station; 0 means no limit"`
+}
+
+// Landsat configures the Landsat scene list
+type Landsat struct {
+	Host            string        `json:"host" env:"LANDSAT_HOST" help:"Host serving the Landsat 8 scene list"`
+	RefreshInterval time.Duration `json:"refreshInterval" env:"BF_LANDSAT_REFRESH_INTERVAL" help:"Seconds between scene list updates"`
+}
+
+// Auth configures authentication of broker users
+type Auth struct {
+	ConfigFile string `json:"configFile" env:"BF_AUTH_CONFIG" help:"JSON file configuring authentication; without one it is disabled"`
+}
+
+// RateLimit configures the limit on each client
+type RateLimit struct {
+	Rate  float64 `json:"rate" env:"BF_RATE_LIMIT" help:"Requests per second allowed to each client; 0 disables the limit"`
+	Burst int     `json:"burst" env:"BF_RATE_BURST" help:"Requests a client may make at once"`
+}
+
+// Retry configures retries and circuit breaking for upstream requests
+type Retry struct {
+	Attempts        int           `json:"attempts" env:"BF_RETRY_ATTEMPTS" help:"Attempts at a request that fails transiently, including the first"`
+	Delay           time.Duration `json:"delay" env:"BF_RETRY_DELAY" help:"Seconds before the first retry"`
+	MaxDelay        time.Duration `json:"maxDelay" env:"BF_RETRY_MAX_DELAY" help:"Longest delay between retries, in seconds"`
+	BreakerFailures int           `json:"breakerFailures" env:"BF_BREAKER_FAILURES" help:"Consecutive failures that open a circuit; 0 disables circuit breaking"`
+	BreakerCooldown time.Duration `json:"breakerCooldown" env:"BF_BREAKER_COOLDOWN" help:"Seconds before an open circuit is tested"`
+}
+
+// Redaction lists what is masked in logs, in addition to the defaults
+type Redaction struct {
+	Headers    []string `json:"headers" env:"BF_REDACT_HEADERS" help:"Headers whose values are masked in logs"`
+	Parameters []string `json:"parameters" env:"BF_REDACT_PARAMETERS" help:"Query parameters whose values are masked in logs"`
+	Fields     []string `json:"fields" env:"BF_REDACT_FIELDS" help:"JSON fields whose values are masked in logs"`
+}
+
+// Log configures where log entries go and which are kept
+type Log struct {
+	Level          string `json:"level" env:"BF_LOG_LEVEL" help:"Least severe level logged: debug, info, notice, warn, error, critical, alert or fatal"`
+	Format         string `json:"format" env:"BF_LOG_FORMAT" help:"Format of log entries: json, logfmt or text"`
+	Stdout         bool   `json:"stdout" env:"BF_LOG_STDOUT" help:"Write log entries to standard output"`
+	File           string `json:"file" env:"BF_LOG_FILE" help:"File to append log entries to"`
+	FileMaxSize    int    `json:"fileMaxSize" env:"BF_LOG_FILE_MAX_SIZE" help:"Megabytes the log file may reach before it is rotated; 0 never rotates it"`
+	FileMaxBackups int    `json:"fileMaxBackups" env:"BF_LOG_FILE_MAX_BACKUPS" help:"Rotated log files to keep"`
+	Syslog         string `json:"syslog" env:"BF_LOG_SYSLOG" help:"Syslog server to send log entries to, as udp://host:port or tcp://host:port"`
+}
+
+// Trace configures where the spans of traced requests go
+type Trace struct {
+	Exporter     string  `json:"exporter" env:"BF_TRACE_EXPORTER" help:"Where spans go: none, stdout, file or otlp"`
+	File         string  `json:"file" env:"BF_TRACE_FILE" help:"File to append spans to, with the file exporter"`
+	OTLPEndpoint string  `json:"otlpEndpoint" env:"BF_TRACE_OTLP_ENDPOINT" help:"OpenTelemetry collector to send spans to over HTTP, with the otlp exporter"`
+	SampleRatio  float64 `json:"sampleRatio" env:"BF_TRACE_SAMPLE_RATIO" help:"Fraction of requests to trace, unless the caller decides"`
+}
+
+// HTTPClient configures the client for requests to an upstream service. The
+// http section is the default profile, and the settings in it apply to every
+// service whose own section does not set them.
+type HTTPClient struct {
+	ConnectTimeout      time.Duration `json:"connectTimeout" env:"CONNECT_TIMEOUT" help:"Seconds to connect and complete a TLS handshake"`
+	ReadTimeout         time.Duration `json:"readTimeout" env:"READ_TIMEOUT" help:"Seconds to wait for response headers"`
+	Timeout             time.Duration `json:"timeout" env:"TIMEOUT" help:"Seconds for the whole request, including the body"`
+	MaxIdleConns        int           `json:"maxIdleConns" env:"MAX_IDLE_CONNS" help:"Idle connections kept in the pool"`
+	MaxIdleConnsPerHost int           `json:"maxIdleConnsPerHost" env:"MAX_IDLE_CONNS_PER_HOST" help:"Idle connections kept for each host"`
+	MaxConnsPerHost     int           `json:"maxConnsPerHost" env:"MAX_CONNS_PER_HOST" help:"Connections allowed to each host; 0 means no limit"`
+	CAFile              string        `json:"caFile" env:"CA_FILE" help:"PEM certificates to trust in addition to the system's"`
+	CertFile            string        `json:"certFile" env:"CERT_FILE" help:"PEM client certificate for mutual TLS"`
+	KeyFile             string        `json:"keyFile" env:"KEY_FILE" help:"PEM key of the client certificate"`
+	Proxy               string        `json:"proxy" env:"PROXY" help:"http, https or socks5 proxy URL; otherwise HTTP_PROXY, HTTPS_PROXY and NO_PROXY apply"`
+	Insecure            bool          `json:"insecure" env:"INSECURE" help:"Skip TLS certificate verification"`
+}
+
+// httpSection names the section that the other HTTP client sections fall
+// back to
+const httpSection = "http"
+
+func newHTTPClient(profile util.ClientProfile) HTTPClient {
+	return HTTPClient{
+		ConnectTimeout:      profile.ConnectTimeout,
+		ReadTimeout:         profile.ReadTimeout,
+		Timeout:             profile.Timeout,
+		MaxIdleConns:        profile.MaxIdleConns,
+		MaxIdleConnsPerHost: profile.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     profile.MaxConnsPerHost,
+		CAFile:              profile.CAFile,
+		CertFile:            profile.CertFile,
+		KeyFile:             profile.KeyFile,
+		Proxy:               profile.Proxy,
+		Insecure:            profile.InsecureSkipVerify,
+	}
+}
+
+func (h HTTPClient) profile() util.ClientProfile {
+	return util.ClientProfile{
+		ConnectTimeout:      h.ConnectTimeout,
+		ReadTimeout:         h.ReadTimeout,
+		Timeout:             h.Timeout,
+		MaxIdleConns:        h.MaxIdleConns,
+		MaxIdleConnsPerHost: h.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     h.MaxConnsPerHost,
+		CAFile:              h.CAFile,
+		CertFile:            h.CertFile,
+		KeyFile:             h.KeyFile,
+		Proxy:               h.Proxy,
+		InsecureSkipVerify:  h.Insecure,
+	}
+}
+
+// Default returns the configuration used when nothing else is set
+func Default() Config {
+	retry, breaker := util.DefaultRetrySettings(), util.DefaultBreakerSettings()
+	return Config{
+		Server: Server{Port: 8080, ShutdownTimeout: lifecycle.DefaultShutdownTimeout, RequestTimeout: DefaultRequestTimeout},
+		Planet: Planet{
+			APIURL:        planet.DefaultAPIURL,
+			AllowQueryKey: true,
+			CacheSize:     planet.DefaultCacheSize,
+			CacheTTL:      planet.DefaultCacheTTL,
+			AssetCacheTTL: planet.DefaultAssetCacheTTL,
+			RateLimit:     planet.DefaultPlanetRate,
+			RateBurst:     planet.DefaultPlanetBurst,
+			RateMaxWait:   planet.DefaultPlanetMaxWait,
+		},
+		Tides:     Tides{URL: planet.DefaultTidesURL, Source: tides.ServiceSourceName, NOAAURL: tides.DefaultNOAAURL},
+		Landsat:   Landsat{Host: landsat.DefaultLandSatHost, RefreshInterval: 30 * time.Minute},
+		RateLimit: RateLimit{Rate: ratelimit.DefaultRate, Burst: ratelimit.DefaultBurst},
+		Retry: Retry{
+			Attempts:        retry.Attempts,
+			Delay:           retry.BaseDelay,
+			MaxDelay:        retry.MaxDelay,
+			BreakerFailures: breaker.Failures,
+			BreakerCooldown: breaker.Cooldown,
+		},
+		Log:          Log{Level: util.LevelName(util.DefaultLogLevel), Format: util.JSONFormat, Stdout: true, FileMaxSize: 100, FileMaxBackups: 5},
+		Trace:        Trace{Exporter: trace.ExportNone, SampleRatio: 1},
+		HTTP:         newHTTPClient(util.DefaultClientProfile(util.DefaultProfile)),
+		HTTPPlanet:   newHTTPClient(util.DefaultClientProfile(util.PlanetProfile)),
+		HTTPTides:    newHTTPClient(util.DefaultClientProfile(util.TidesProfile)),
+		HTTPLandsat:  newHTTPClient(util.DefaultClientProfile(util.LandsatProfile)),
+		HTTPSentinel: newHTTPClient(util.DefaultClientProfile(util.SentinelProfile)),
+	}
+}
+
+// clientProfiles returns the HTTP client profile of each upstream service
+func (c Config) clientProfiles() map[string]util.ClientProfile {
+	return map[string]util.ClientProfile{
+		util.DefaultProfile:  c.HTTP.profile(),
+		util.PlanetProfile:   c.HTTPPlanet.profile(),
+		util.TidesProfile:    c.HTTPTides.profile(),
+		util.LandsatProfile:  c.HTTPLandsat.profile(),
+		util.SentinelProfile: c.HTTPSentinel.profile(),
+	}
+}
+
+// AddFlags adds a flag for each setting, and one for the configuration file
+func AddFlags(flags *pflag.FlagSet) {
+	flags.String(FileFlag, "", "JSON configuration file (env "+FileEnv+")")
+	defaults := Default()
+	for _, field := range defaults.fields() {
+		usage := fmt.Sprintf("%v (env %v)", field.help, field.env)
+		if field.value.Kind() == reflect.Bool {
+			flags.Bool(field.flag, field.value.Bool(), usage)
+		} else {
+			flags.String(field.flag, field.format(), usage)
+		}
+	}
+}
+
+// Load reads the configuration from the file, environment and flags, which
+// may be nil, and validates it
+func Load(flags *pflag.FlagSet) (Config, error) {
+	result := Default()
+	filename := os.Getenv(FileEnv)
+	if flags != nil && flags.Changed(FileFlag) {
+		filename = flags.Lookup(FileFlag).Value.String()
+	}
+	set := make(map[string]bool)
+	if filename != "" {
+		if err := result.loadFile(filename, set); err != nil {
+			return result, err
+		}
+	}
+	for _, field := range result.fields() {
+		if value := os.Getenv(field.env); value != "" {
+			if err := field.set(value); err != nil {
+				return result, fmt.Errorf("%v: %v", field.env, err)
+			}
+			set[field.path] = true
+		}
+		if flags != nil && flags.Changed(field.flag) {
+			if err := field.set(flags.Lookup(field.flag).Value.String()); err != nil {
+				return result, fmt.Errorf("--%v: %v", field.flag, err)
+			}
+			set[field.path] = true
+		}
+	}
+	result.inheritHTTP(set)
+	return result, result.Validate()
+}
+
+// inheritHTTP gives each upstream service the settings from the http
+// section that its own section does not set
+func (c *Config) inheritHTTP(set map[string]bool) {
+	shared := make(map[string]field)
+	fields := c.fields()
+	for _, field := range fields {
+		if field.section == httpSection {
+			shared[field.name] = field
+		}
+	}
+	for _, field := range fields {
+		if field.section != httpSection && strings.HasPrefix(field.section, httpSection) && !set[field.path] && set[httpSection+"."+field.name] {
+			field.value.Set(shared[field.name].value)
+		}
+	}
+}
+
+// loadFile reads a JSON file, noting the settings it sets
+func (c *Config) loadFile(filename string, set map[string]bool) error {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(filename)) != ".json" {
+		return fmt.Errorf("Configuration file %v must be .json", filename)
+	}
+	var values map[string]interface{}
+	if err = json.Unmarshal(bytes, &values); err == nil {
+		err = c.setValues(values, set)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read configuration file %v: %v", filename, err)
+	}
+	return nil
+}
+
+// Validate reports every setting that cannot work
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535")
+	for _, item := range []struct{ path, value string }{
+		{"planet.apiURL", c.Planet.APIURL}, {"tides.url", c.Tides.URL}, {"tides.noaaURL", c.Tides.NOAAURL}, {"landsat.host", c.Landsat.Host},
+	} {
+		parsed, err := url.Parse(item.value)
+		check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "", "%v must be an http or https URL", item.path)
+	}
+	for _, field := range c.fields() {
+		switch field.value.Kind() {
+		case reflect.Int, reflect.Int64:
+			check(field.value.Int() >= 0, "%v must not be negative", field.path)
+		case reflect.Float64:
+			check(field.value.Float() >= 0, "%v must not be negative", field.path)
+		}
+	}
+	check(c.Retry.Attempts >= 1, "retry.attempts must be at least 1")
+	check(c.Planet.RateLimit == 0 || c.Planet.RateBurst >= 1, "planet.rateBurst must be at least 1")
+	check(c.RateLimit.Rate == 0 || c.RateLimit.Burst >= 1, "rateLimit.burst must be at least 1")
+	check(c.Landsat.RefreshInterval > 0, "landsat.refreshInterval must be positive")
+	for _, name := range strings.Split(c.Tides.Source, ",") {
+		switch strings.TrimSpace(name) {
+		case "", tides.ServiceSourceName:
+		case tides.HarmonicSourceName, tides.NOAASourceName:
+			check(c.Tides.ConstituentsFile != "", "tides.constituentsFile is needed by the %v tide source", strings.TrimSpace(name))
+		default:
+			check(false, "tides.source %#v is not a tide source", strings.TrimSpace(name))
+		}
+	}
+	_, err := util.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level: %v", err)
+	switch c.Log.Format {
+	case util.JSONFormat, util.LogfmtFormat, util.TextFormat:
+	default:
+		check(false, "log.format %#v is not json, logfmt or text", c.Log.Format)
+	}
+	if c.Log.Syslog != "" {
+		_, _, err = util.ParseSyslogAddress(c.Log.Syslog)
+		check(err == nil, "log.syslog: %v", err)
+	}
+	switch c.Trace.Exporter {
+	case trace.ExportNone, trace.ExportStdout:
+	case trace.ExportFile:
+		check(c.Trace.File != "", "trace.file is needed by the file exporter")
+	case trace.ExportOTLP:
+		_, err = trace.OTLPURL(c.Trace.OTLPEndpoint)
+		check(err == nil, "trace.otlpEndpoint: %v", err)
+	default:
+		check(false, "trace.exporter %#v is not none, stdout, file or otlp", c.Trace.Exporter)
+	}
+	check(c.Trace.SampleRatio >= 0 && c.Trace.SampleRatio <= 1, "trace.sampleRatio must be from 0 to 1")
+	for _, item := range []struct{ path, value string }{{"tides.constituentsFile", c.Tides.ConstituentsFile}, {"auth.configFile", c.Auth.ConfigFile}} {
+		if item.value != "" {
+			_, err := os.Stat(item.value)
+			check(err == nil, "%v: %v", item.path, err)
+		}
+	}
+	// Creating the clients reads their certificates and checks their proxies
+	for _, name := range util.ClientProfiles {
+		_, err := util.NewClient(c.clientProfiles()[name])
+		check(err == nil, "HTTP client profile %v: %v", name, err)
+	}
+	if len(problems) > 0 {
+		return errors.New("Invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Apply configures the packages that keep settings of their own. It fails
+// if an HTTP client cannot be created, or if the log file, syslog server or
+// trace file cannot be opened.
+func (c Config) Apply() error {
+	if err := util.SetClientProfiles(c.clientProfiles()); err != nil {
+		return err
+	}
+	logger, err := c.logger()
+	if err != nil {
+		return err
+	}
+	exporter, err := c.traceExporter()
+	if err != nil {
+		logger.Close()
+		return err
+	}
+	util.SetLogger(logger)
+	trace.SetExporter(exporter, c.Trace.SampleRatio)
+	c.applyRedaction()
+	util.SetResilience(c.retrySettings())
+	planet.Configure(c.planetSettings(
+		planet.NewCacheSettings(c.Planet.CacheSize, c.Planet.CacheTTL, c.Planet.AssetCacheTTL),
+		planet.NewRateLimitSettings(c.Planet.RateLimit, c.Planet.RateBurst, c.Planet.RateMaxWait),
+	))
+	landsat.SetLandSatHost(c.Landsat.Host)
+	landsat.SetRefreshInterval(c.Landsat.RefreshInterval)
+	return nil
+}
+
+// ApplyChanges applies c in place of the previous configuration. State that
+// the changes leave alone, such as cached responses, rate limits already
+// used and open circuits, is kept. Settings that only take effect when the
+// broker starts cannot change.
+func (c Config) ApplyChanges(previous Config) error {
+	startup, previousStartup := c.Server, previous.Server
+	startup.RequestTimeout, previousStartup.RequestTimeout = 0, 0
+	if startup != previousStartup {
+		return errors.New("server settings other than requestTimeout cannot change without a restart")
+	}
+	var logger *util.Logger
+	if c.Log != previous.Log {
+		var err error
+		if logger, err = c.logger(); err != nil {
+			return err
+		}
+	}
+	var exporter trace.Exporter
+	if c.Trace != previous.Trace {
+		var err error
+		if exporter, err = c.traceExporter(); err != nil {
+			if logger != nil {
+				logger.Close()
+			}
+			return err
+		}
+	}
+	// Only the clients whose settings change are replaced, so that the
+	// others keep their pooled connections
+	profiles, previousProfiles := c.clientProfiles(), previous.clientProfiles()
+	for name, profile := range profiles {
+		if profile == previousProfiles[name] {
+			delete(profiles, name)
+		}
+	}
+	if err := util.SetClientProfiles(profiles); err != nil {
+		if logger != nil {
+			logger.Close()
+		}
+		if exporter != nil {
+			exporter.Close()
+		}
+		return err
+	}
+	current := planet.CurrentSettings()
+	caching, rateLimit := current.Caching, current.RateLimit
+	if c.Planet.CacheSize != previous.Planet.CacheSize {
+		caching = planet.NewCacheSettings(c.Planet.CacheSize, c.Planet.CacheTTL, c.Planet.AssetCacheTTL)
+	} else {
+		caching.TTL, caching.AssetTTL = c.Planet.CacheTTL, c.Planet.AssetCacheTTL
+	}
+	if c.Planet.RateLimit != previous.Planet.RateLimit || c.Planet.RateBurst != previous.Planet.RateBurst {
+		rateLimit = planet.NewRateLimitSettings(c.Planet.RateLimit, c.Planet.RateBurst, c.Planet.RateMaxWait)
+	} else {
+		rateLimit.MaxWait = c.Planet.RateMaxWait
+	}
+	c.applyRedaction()
+	if c.Retry != previous.Retry {
+		util.SetResilience(c.retrySettings())
+	}
+	planet.Configure(c.planetSettings(caching, rateLimit))
+	landsat.SetLandSatHost(c.Landsat.Host)
+	landsat.SetRefreshInterval(c.Landsat.RefreshInterval)
+	if logger != nil {
+		util.SetLogger(logger)
+	}
+	if c.Trace != previous.Trace {
+		trace.SetExporter(exporter, c.Trace.SampleRatio)
+	}
+	return nil
+}
+
+// logger opens the configured log sinks
+func (c Config) logger() (*util.Logger, error) {
+	level, err := util.ParseLevel(c.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	var sinks []util.Sink
+	if c.Log.Stdout {
+		sinks = append(sinks, util.NewWriterSink(os.Stdout, c.Log.Format))
+	}
+	if c.Log.File != "" {
+		sink, err := util.NewFileSink(c.Log.File, c.Log.Format, int64(c.Log.FileMaxSize)<<20, c.Log.FileMaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open log file: %v", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if c.Log.Syslog != "" {
+		network, address, err := util.ParseSyslogAddress(c.Log.Syslog)
+		var sink *util.SyslogSink
+		if err == nil {
+			sink, err = util.NewSyslogSink(network, address, c.Log.Format)
+		}
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("Failed to connect to syslog server: %v", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return util.NewLogger(level, sinks...), nil
+}
+
+// traceExporter opens the configured trace exporter, which is nil when
+// tracing is disabled
+func (c Config) traceExporter() (trace.Exporter, error) {
+	service := (&util.BasicLogContext{}).AppName()
+	switch c.Trace.Exporter {
+	case trace.ExportStdout:
+		return trace.NewWriterExporter(os.Stdout, service), nil
+	case trace.ExportFile:
+		exporter, err := trace.NewFileExporter(c.Trace.File, service)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open trace file: %v", err)
+		}
+		return exporter, nil
+	case trace.ExportOTLP:
+		exporter, err := trace.NewOTLPExporter(c.Trace.OTLPEndpoint, service)
+		if err != nil {
+			return nil, err
+		}
+		return exporter, nil
+	}
+	return nil, nil
+}
+
+func (c Config) applyRedaction() {
+	util.SetRedaction(util.RedactionSettings{
+		Headers:    append(util.DefaultRedactionSettings().Headers, c.Redaction.Headers...),
+		Parameters: append(util.DefaultRedactionSettings().Parameters, c.Redaction.Parameters...),
+		Fields:     append(util.DefaultRedactionSettings().Fields, c.Redaction.Fields...),
+	})
+}
+
+func (c Config) retrySettings() (util.RetrySettings, util.BreakerSettings) {
+	return util.RetrySettings{Attempts: c.Retry.Attempts, BaseDelay: c.Retry.Delay, MaxDelay: c.Retry.MaxDelay},
+		util.BreakerSettings{Failures: c.Retry.BreakerFailures, Cooldown: c.Retry.BreakerCooldown}
+}
+
+func (c Config) planetSettings(caching planet.CacheSettings, rateLimit planet.RateLimitSettings) planet.Settings {
+	return planet.Settings{
+		APIURL:     c.Planet.APIURL,
+		TidesURL:   c.Tides.URL,
+		TideSource: c.Tides.Source,
+		TideOptions: tides.SourceOptions{
+			NOAAURL:      c.Tides.NOAAURL,
+			StationsFile: c.Tides.ConstituentsFile,
+			MaxDistance:  c.Tides.MaxStationDistance,
+		},
+		Credentials:             planet.CredentialSettings{ServerKey: c.Planet.ServerKey, ClientTokens: c.Planet.ClientTokens, AllowQueryKey: c.Planet.AllowQueryKey},
+		Caching:                 caching,
+		RateLimit:               rateLimit,
+		DisablePermissionsCheck: c.Planet.DisablePermissionsCheck,
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+const testingJSON = `{
+  "server": {"port": 9090},
+  "planet": {
+    "apiURL": "https://planet.example.com",
+    "serverKey": "server-key",
+    "clientTokens": ["one", "two"],
+    "cacheTTL": "2m",
+    "rateLimit": 2.5
+  },
+  "tides": {
+    "source": "service, harmonic",
+    "constituentsFile": "../tides/testdata/constituents.json"
+  },
+  "redaction": {"headers": ["X-Secret", "X-Other"]}
+}`
+
+func writeTestingFile(t *testing.T, name, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, name)
+	ioutil.WriteFile(filename, []byte(content), 0600)
+	return filename, func() { os.RemoveAll(dir) }
+}
+
+func createTestFlags(args ...string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	AddFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	return flags
+}
+
+func TestDefault(t *testing.T) {
+	config, err := Load(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Default(), config)
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.True(t, config.Planet.AllowQueryKey)
+}
+
+func TestLoadFile(t *testing.T) {
+	filename, cleanup := writeTestingFile(t, "broker.json", testingJSON)
+	defer cleanup()
+	config, err := Load(createTestFlags("--config", filename))
+	if assert.Nil(t, err) {
+		assert.Equal(t, 9090, config.Server.Port)
+		assert.Equal(t, "https://planet.example.com", config.Planet.APIURL)
+		assert.Equal(t, "server-key", config.Planet.ServerKey)
+		assert.Equal(t, []string{"one", "two"}, config.Planet.ClientTokens)
+		assert.Equal(t, 2*time.Minute, config.Planet.CacheTTL)
+		assert.Equal(t, 2.5, config.Planet.RateLimit)
+		assert.Equal(t, "service, harmonic", config.Tides.Source)
+		assert.Equal(t, []string{"X-Secret", "X-Other"}, config.Redaction.Headers)
+		assert.Equal(t, planet.DefaultCacheSize, config.Planet.CacheSize)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	filename, cleanup := writeTestingFile(t, "broker.json", `{"server": {"port": 9091}, "planet": {"cacheTTL": 1.5, "allowQueryKey": false, "clientTokens": ["a"]}}`)
+	defer cleanup()
+	os.Setenv(FileEnv, filename)
+	defer os.Unsetenv(FileEnv)
+	config, err := Load(nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 9091, config.Server.Port)
+		assert.Equal(t, 1500*time.Millisecond, config.Planet.CacheTTL)
+		assert.False(t, config.Planet.AllowQueryKey)
+		assert.Equal(t, []string{"a"}, config.Planet.ClientTokens)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	filename, cleanup := writeTestingFile(t, "broker.json", `{"server": {"port": 9090}, "planet": {"cacheSize": 10, "rateBurst": 3}}`)
+	defer cleanup()
+	os.Setenv("PORT", "9091")
+	os.Setenv("PL_CACHE_SIZE", "20")
+	defer os.Unsetenv("PORT")
+	defer os.Unsetenv("PL_CACHE_SIZE")
+
+	config, err := Load(createTestFlags("--config", filename, "--server.port", "9092", "--planet.disable-permissions-check"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, 9092, config.Server.Port, "Expected the flag to win")
+		assert.Equal(t, 20, config.Planet.CacheSize, "Expected the environment to beat the file")
+		assert.Equal(t, 3, config.Planet.RateBurst, "Expected the file to beat the default")
+		assert.True(t, config.Planet.DisablePermissionsCheck)
+	}
+}
+
+func TestLoadHTTP(t *testing.T) {
+	filename, cleanup := writeTestingFile(t, "broker.json", `{"http": {"insecure": true}, "httpPlanet": {"timeout": 2.5}}`)
+	defer cleanup()
+	os.Setenv("BF_HTTP_TIMEOUT", "20")
+	os.Setenv("BF_HTTP_PLANET_PROXY", "socks5://proxy.example.com:1080")
+	defer os.Unsetenv("BF_HTTP_TIMEOUT")
+	defer os.Unsetenv("BF_HTTP_PLANET_PROXY")
+
+	config, err := Load(createTestFlags("--config", filename, "--httpTides.max-conns-per-host", "4"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, 2500*time.Millisecond, config.HTTPPlanet.Timeout, "Expected the planet setting to beat the shared one")
+		assert.Equal(t, "socks5://proxy.example.com:1080", config.HTTPPlanet.Proxy)
+		assert.True(t, config.HTTPPlanet.Insecure, "Expected the shared setting from the file")
+		assert.Equal(t, 20*time.Second, config.HTTPTides.Timeout, "Expected the shared setting from the environment")
+		assert.Equal(t, 4, config.HTTPTides.MaxConnsPerHost)
+		assert.Equal(t, "", config.HTTPTides.Proxy)
+		assert.Equal(t, Default().HTTPLandsat.ReadTimeout, config.HTTPLandsat.ReadTimeout, "Expected the landsat default to be kept")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown.json": `{"planet": {"apiKey": "x"}}`,
+		"section.json": `{"planet": 3}`,
+		"type.json":    `{"server": {"port": "eighty"}}`,
+		"list.json":    `{"server": {"port": [1, 2]}}`,
+		"broken.json":  `{"server": `,
+		"broker.yaml":  "server:\n  port: 1\n",
+		"broker.toml":  "port = 1",
+	} {
+		filename, cleanup := writeTestingFile(t, name, content)
+		_, err := Load(createTestFlags("--config", filename))
+		assert.NotNil(t, err, "Expected %v to fail", name)
+		cleanup()
+	}
+	_, err := Load(createTestFlags("--config", "/does/not/exist.json"))
+	assert.NotNil(t, err)
+
+	os.Setenv("PL_ALLOW_QUERY_KEY", "maybe")
+	_, err = Load(nil)
+	os.Unsetenv("PL_ALLOW_QUERY_KEY")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "PL_ALLOW_QUERY_KEY")
+	}
+	_, err = Load(createTestFlags("--retry.delay", "soon"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "--retry.delay")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config := Default()
+	config.Server.Port = 0
+	config.Planet.APIURL = "ftp://planet.example.com"
+	config.Planet.CacheSize = -1
+	config.Retry.Attempts = 0
+	config.Tides.Source = "harmonic,crystal-ball"
+	config.Auth.ConfigFile = "/does/not/exist.json"
+	config.Log.Level = "loud"
+	config.Log.Format = "xml"
+	config.Log.Syslog = "http://logs.example.com"
+	config.Trace.Exporter = trace.ExportOTLP
+	config.Trace.OTLPEndpoint = "collector:4318"
+	config.Trace.SampleRatio = 2
+	config.HTTPSentinel.CAFile = "/does/not/exist.pem"
+	config.HTTPTides.Proxy = "ftp://proxy.example.com"
+	err := config.Validate()
+	if assert.NotNil(t, err) {
+		for _, expected := range []string{"server.port", "planet.apiURL", "planet.cacheSize", "retry.attempts", "tides.constituentsFile", "crystal-ball", "auth.configFile", "log.level", "log.format", "log.syslog", "trace.otlpEndpoint", "trace.sampleRatio", "profile sentinel", "profile tides"} {
+			assert.Contains(t, err.Error(), expected)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	config := Default()
+	config.Planet.ServerKey = "server-key"
+	config.Planet.ClientTokens = []string{"token"}
+	config.Planet.CacheTTL = 90 * time.Second
+	config.Redaction.Fields = []string{"quoted \"field\""}
+
+	var buffer bytes.Buffer
+	assert.Nil(t, config.Print(&buffer))
+	assert.NotContains(t, buffer.String(), "server-key")
+	assert.NotContains(t, buffer.String(), "token\"")
+
+	// What is printed can be loaded again
+	filename, cleanup := writeTestingFile(t, "printed.json", buffer.String())
+	defer cleanup()
+	printed, err := Load(createTestFlags("--config", filename))
+	if assert.Nil(t, err, "Failed to load printed configuration: %v", err) {
+		assert.Equal(t, util.Redacted, printed.Planet.ServerKey)
+		assert.Equal(t, []string{util.Redacted}, printed.Planet.ClientTokens)
+		printed.Planet.ServerKey, printed.Planet.ClientTokens = config.Planet.ServerKey, config.Planet.ClientTokens
+		assert.Equal(t, config, printed)
+	}
+}
+
+func TestApply(t *testing.T) {
+	config := Default()
+	config.Planet.APIURL = "https://planet.example.com"
+	config.Tides.MaxStationDistance = 50
+	config.Planet.ServerKey = "applied-server-key"
+	config.Redaction.Headers = []string{"X-Applied"}
+	config.Apply()
+
+	settings := planet.CurrentSettings()
+	assert.Equal(t, "https://planet.example.com", settings.APIURL)
+	assert.Equal(t, 50.0, settings.TideOptions.MaxDistance)
+	assert.Equal(t, "applied-server-key", settings.Credentials.ServerKey)
+	assert.NotContains(t, util.Redact("key applied-server-key"), "applied-server-key")
+	assert.Equal(t, "X-Applied: "+util.Redacted, util.Redact("X-Applied: value"))
+}
+
+func TestKebab(t *testing.T) {
+	for name, expected := range map[string]string{"apiURL": "api-url", "noaaURL": "noaa-url", "cacheTTL": "cache-ttl", "port": "port", "maxStationDistance": "max-station-distance"} {
+		assert.Equal(t, expected, kebab(name))
+	}
+}
+
+func TestChanges(t *testing.T) {
+	previous := Default()
+	config := Default()
+	assert.Empty(t, config.Changes(previous))
+
+	config.Planet.APIURL = "https://planet.example.com"
+	config.Planet.ServerKey = "changed-server-key"
+	config.Redaction.Headers = []string{"X-Secret"}
+	changes := config.Changes(previous)
+	assert.Equal(t, []string{
+		`planet.apiURL: "https://api.planet.com" -> "https://planet.example.com"`,
+		"planet.serverKey changed",
+		`redaction.headers: "" -> "X-Secret"`,
+	}, changes)
+}
+
+func TestApplyChanges(t *testing.T) {
+	previous := Default()
+	previous.Apply()
+	before := planet.CurrentSettings()
+	before.Caching.Cache.Set("key", []byte("value"), time.Minute)
+
+	config := previous
+	config.Planet.APIURL = "https://planet.example.com"
+	config.Planet.CacheTTL = time.Hour
+	assert.Nil(t, config.ApplyChanges(previous))
+	after := planet.CurrentSettings()
+	assert.Equal(t, "https://planet.example.com", after.APIURL)
+	assert.Equal(t, time.Hour, after.Caching.TTL)
+	_, ok := after.Caching.Cache.Get("key")
+	assert.True(t, ok, "Expected the cache to be kept")
+	assert.True(t, before.RateLimit.Bucket == after.RateLimit.Bucket, "Expected the rate limit to be kept")
+
+	next := config
+	next.Planet.CacheSize = 5
+	next.Planet.RateLimit = 1
+	assert.Nil(t, next.ApplyChanges(config))
+	after = planet.CurrentSettings()
+	_, ok = after.Caching.Cache.Get("key")
+	assert.False(t, ok, "Expected a new cache")
+	assert.True(t, before.RateLimit.Bucket != after.RateLimit.Bucket, "Expected a new rate limit")
+
+	planetClient, tidesClient := util.Client(util.PlanetProfile), util.Client(util.TidesProfile)
+	clients := next
+	clients.HTTPPlanet.Timeout = time.Second
+	assert.Nil(t, clients.ApplyChanges(next))
+	assert.True(t, planetClient != util.Client(util.PlanetProfile), "Expected a new planet client")
+	assert.Equal(t, time.Second, util.Client(util.PlanetProfile).Timeout)
+	assert.True(t, tidesClient == util.Client(util.TidesProfile), "Expected the tides client to be kept")
+
+	restart := clients
+	restart.Server.Port = 9999
+	restart.Planet.APIURL = "https://other.example.com"
+	assert.NotNil(t, restart.ApplyChanges(clients))
+	assert.Equal(t, "https://planet.example.com", planet.CurrentSettings().APIURL)
+	Default().Apply()
+}
+
+func TestApplyLog(t *testing.T) {
+	defer Default().Apply()
+	dir, err := ioutil.TempDir("", "config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	previous := Default()
+	require.Nil(t, previous.Apply())
+	logger := util.CurrentLogger()
+	config := previous
+	config.Planet.CacheTTL = time.Hour
+	require.Nil(t, config.ApplyChanges(previous))
+	assert.True(t, logger == util.CurrentLogger(), "Expected the logger to be kept")
+
+	next := config
+	next.Log.Level = "debug"
+	next.Log.File = filepath.Join(dir, "broker.log")
+	require.Nil(t, next.ApplyChanges(config))
+	assert.Equal(t, util.DEBUG, util.CurrentLogger().Level)
+	util.LogInfo(&util.BasicLogContext{}, "Written to the file")
+	util.FlushLogs()
+	contents, err := ioutil.ReadFile(next.Log.File)
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), `"msg":"Written to the file"`)
+
+	broken := next
+	broken.Log.File = filepath.Join(dir, "missing", "broker.log")
+	assert.NotNil(t, broken.ApplyChanges(next))
+	assert.NotNil(t, broken.Apply())
+	assert.Equal(t, util.DEBUG, util.CurrentLogger().Level, "Expected the logger to be kept")
+}
+
+func TestApplyTrace(t *testing.T) {
+	defer Default().Apply()
+	dir, err := ioutil.TempDir("", "config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	previous := Default()
+	require.Nil(t, previous.Apply())
+	assert.False(t, trace.Enabled())
+	config := previous
+	config.Trace.Exporter = trace.ExportFile
+	assert.NotNil(t, config.Validate(), "Expected the file exporter to need a file")
+	config.Trace.File = filepath.Join(dir, "spans.json")
+	require.Nil(t, config.ApplyChanges(previous))
+	assert.True(t, trace.Enabled())
+	_, span := trace.Start(context.Background(), "configured")
+	span.End()
+	contents, err := ioutil.ReadFile(config.Trace.File)
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), `"name":"configured"`)
+
+	broken := config
+	broken.Trace.File = filepath.Join(dir, "missing", "spans.json")
+	assert.NotNil(t, broken.ApplyChanges(config))
+	assert.True(t, trace.Enabled(), "Expected the exporter to be kept")
+	require.Nil(t, previous.ApplyChanges(config))
+	assert.False(t, trace.Enabled())
+}
@@ -0,0 +1,250 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// field is one setting, found by reflection on Config
+type field struct {
+	section string
+	name    string
+	path    string // section.name, as in configuration files
+	flag    string // section.kebab-case-name
+	env     string
+	help    string
+	secret  bool
+	value   reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (c *Config) fields() []field {
+	var result []field
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		sectionName := sections.Type().Field(i).Tag.Get("json")
+		envPrefix := sections.Type().Field(i).Tag.Get("env")
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			structField := section.Type().Field(j)
+			name := structField.Tag.Get("json")
+			result = append(result, field{
+				section: sectionName,
+				name:    name,
+				path:    sectionName + "." + name,
+				flag:    sectionName + "." + kebab(name),
+				env:     envPrefix + structField.Tag.Get("env"),
+				help:    structField.Tag.Get("help"),
+				secret:  structField.Tag.Get("secret") == "true",
+				value:   section.Field(j),
+			})
+		}
+	}
+	return result
+}
+
+// kebab turns a camel case name such as apiURL into api-url
+func kebab(name string) string {
+	runes := []rune(name)
+	var result []rune
+	for inx, r := range runes {
+		if unicode.IsUpper(r) && inx > 0 && (unicode.IsLower(runes[inx-1]) || inx+1 < len(runes) && unicode.IsLower(runes[inx+1])) {
+			result = append(result, '-')
+		}
+		result = append(result, unicode.ToLower(r))
+	}
+	return string(result)
+}
+
+// set parses a setting from an environment variable or flag. Durations
+// are seconds, though Go durations such as 1m30s are accepted too, and
+// lists are comma-separated.
+func (f field) set(text string) error {
+	text = strings.TrimSpace(text)
+	if f.value.Type() == durationType {
+		if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+			f.value.SetInt(int64(seconds * float64(time.Second)))
+			return nil
+		}
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("%#v is not a number of seconds", text)
+		}
+		f.value.SetInt(int64(duration))
+		return nil
+	}
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(text)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%#v is not true or false", text)
+		}
+		f.value.SetBool(value)
+	case reflect.Int:
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("%#v is not an integer", text)
+		}
+		f.value.SetInt(int64(value))
+	case reflect.Float64:
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("%#v is not a number", text)
+		}
+		f.value.SetFloat(value)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
+
+// setValues sets the settings found in a parsed configuration file,
+// noting each in set
+func (c *Config) setValues(values map[string]interface{}, set map[string]bool) error {
+	fields := make(map[string]field)
+	for _, field := range c.fields() {
+		fields[field.path] = field
+	}
+	var sections []string
+	for section := range values {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		settings, ok := values[section].(map[string]interface{})
+		if !ok {
+			if values[section] == nil {
+				continue
+			}
+			return fmt.Errorf("%v must be a mapping of settings", section)
+		}
+		for name, value := range settings {
+			field, ok := fields[section+"."+name]
+			if !ok {
+				return fmt.Errorf("%v.%v is not a setting", section, name)
+			}
+			if err := field.setValue(value); err != nil {
+				return fmt.Errorf("%v: %v", field.path, err)
+			}
+			set[field.path] = value != nil
+		}
+	}
+	return nil
+}
+
+func (f field) setValue(value interface{}) error {
+	switch typed := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		if f.value.Kind() != reflect.Slice {
+			return fmt.Errorf("a list is not allowed")
+		}
+		var items []string
+		for _, item := range typed {
+			text, err := scalarText(item)
+			if err != nil {
+				return err
+			}
+			items = append(items, text)
+		}
+		f.value.Set(reflect.ValueOf(items))
+		return nil
+	}
+	text, err := scalarText(value)
+	if err != nil {
+		return err
+	}
+	return f.set(text)
+}
+
+func scalarText(value interface{}) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("%v is not a single value", value)
+}
+
+// format returns the setting as it would be set, with secrets redacted
+func (f field) format() string {
+	if f.value.Type() == durationType {
+		return strconv.FormatFloat(time.Duration(f.value.Int()).Seconds(), 'f', -1, 64)
+	}
+	switch f.value.Kind() {
+	case reflect.String:
+		if f.secret && f.value.String() != "" {
+			return util.Redacted
+		}
+		return f.value.String()
+	case reflect.Slice:
+		items := f.list()
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// Changes lists the settings that differ from those in previous, as
+// "section.name: old -> new", without revealing secrets
+func (c Config) Changes(previous Config) []string {
+	var result []string
+	before := previous.fields()
+	for inx, field := range c.fields() {
+		if fmt.Sprint(field.value.Interface()) == fmt.Sprint(before[inx].value.Interface()) {
+			continue
+		}
+		if field.secret {
+			result = append(result, field.path+" changed")
+		} else {
+			result = append(result, fmt.Sprintf("%v: %#v -> %#v", field.path, before[inx].format(), field.format()))
+		}
+	}
+	return result
+}
+
+// list returns a list setting, with secrets redacted
+func (f field) list() []string {
+	items := []string{}
+	for inx := 0; inx < f.value.Len(); inx++ {
+		item := f.value.Index(inx).String()
+		if f.secret {
+			item = util.Redacted
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,61 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// Print writes the configuration as JSON, in a form that Load can read
+// back, with secrets redacted
+func (c Config) Print(writer io.Writer) error {
+	var buffer bytes.Buffer
+	buffer.WriteString("{")
+	section := ""
+	for _, field := range c.fields() {
+		if field.section != section {
+			if section != "" {
+				buffer.WriteString("\n  },")
+			}
+			section = field.section
+			fmt.Fprintf(&buffer, "\n  %q: {", section)
+		} else {
+			buffer.WriteString(",")
+		}
+		value, _ := json.Marshal(field.jsonValue())
+		fmt.Fprintf(&buffer, "\n    %q: %s", field.name, value)
+	}
+	buffer.WriteString("\n  }\n}\n")
+	_, err := buffer.WriteTo(writer)
+	return err
+}
+
+func (f field) jsonValue() interface{} {
+	switch {
+	case f.value.Type() == durationType || f.value.Kind() == reflect.Float64:
+		value, _ := strconv.ParseFloat(f.format(), 64)
+		return value
+	case f.value.Kind() == reflect.Slice:
+		return f.list()
+	case f.value.Kind() == reflect.String:
+		return f.format()
+	}
+	return f.value.Interface()
+}
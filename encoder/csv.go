@@ -0,0 +1,82 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+// CSVEncoder writes one row per feature: the ID, the geometry as WKT,
+// and the flattened properties. Since features may have different
+// properties (e.g., only some have bands), the header cannot be known
+// until every feature has been seen, so rows are held until Close.
+type CSVEncoder struct {
+	writer  io.Writer
+	rows    []map[string]string
+	columns map[string]bool
+}
+
+// NewCSVEncoder creates a CSVEncoder
+func NewCSVEncoder(writer io.Writer) *CSVEncoder {
+	return &CSVEncoder{writer: writer, columns: make(map[string]bool)}
+}
+
+// Encode flattens a single feature into a row
+func (e *CSVEncoder) Encode(feature *geojson.Feature) error {
+	row := FlattenProperties(feature.Properties)
+	for column := range row {
+		e.columns[column] = true
+	}
+	row[csvIDColumn] = feature.IDStr()
+	row[csvGeometryColumn] = FeatureWKT(feature)
+	e.rows = append(e.rows, row)
+	return nil
+}
+
+const (
+	csvIDColumn       = "id"
+	csvGeometryColumn = "geometry"
+)
+
+// Close writes the header and all of the rows
+func (e *CSVEncoder) Close() error {
+	var columns []string
+	for column := range e.columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	header := append([]string{csvIDColumn, csvGeometryColumn}, columns...)
+
+	writer := csv.NewWriter(e.writer)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range e.rows {
+		record := make([]string, len(header))
+		for inx, column := range header {
+			record[inx] = row[column]
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	e.rows = nil
+	return writer.Error()
+}
@@ -0,0 +1,71 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+func TestCSVEncoder(t *testing.T) {
+	var buffer bytes.Buffer
+	fc := testingFeatureCollection()
+	fc.Features[1].Properties["bands"] = map[string]string{"red": "https://example.com/red.TIF"}
+
+	err := EncodeFeatureCollection(NewCSVEncoder(&buffer), fc)
+	assert.Nil(t, err)
+
+	records, err := csv.NewReader(&buffer).ReadAll()
+	assert.Nil(t, err, "Expected to parse CSV but received: %v", err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, []string{"id", "geometry", "bands.red", "cloudCover"}, records[0])
+	assert.Equal(t, "a", records[1][0])
+	assert.True(t, strings.HasPrefix(records[1][1], "POINT"), "Expected WKT geometry but received %v", records[1][1])
+	assert.Equal(t, "", records[1][2])
+	assert.Equal(t, "10", records[1][3])
+	assert.Equal(t, "https://example.com/red.TIF", records[2][2])
+}
+
+func TestWKTEncoder(t *testing.T) {
+	var buffer bytes.Buffer
+	fc := testingFeatureCollection()
+	fc.Features = append(fc.Features, geojson.NewFeature(nil, "c", nil))
+
+	err := EncodeFeatureCollection(NewWKTEncoder(&buffer), fc)
+	assert.Nil(t, err)
+	assert.Equal(t, "POINT (1.000000 2.000000)\nPOINT (3.000000 4.000000)\n\n", buffer.String())
+}
+
+func TestFlattenProperties(t *testing.T) {
+	properties := map[string]interface{}{
+		"acquiredDate": "2017-01-01T00:00:00Z",
+		"bands":        map[string]interface{}{"red": "r", "nested": map[string]interface{}{"x": 1.5}},
+		"permissions":  []string{"a", "b"},
+		"missing":      nil,
+		"ok":           true,
+	}
+	flat := FlattenProperties(properties)
+	assert.Equal(t, "2017-01-01T00:00:00Z", flat["acquiredDate"])
+	assert.Equal(t, "r", flat["bands.red"])
+	assert.Equal(t, "1.5", flat["bands.nested.x"])
+	assert.Equal(t, `["a","b"]`, flat["permissions"])
+	assert.Equal(t, "", flat["missing"])
+	assert.Equal(t, "true", flat["ok"])
+}
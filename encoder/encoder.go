@@ -0,0 +1,101 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+// Names of the supported output formats
+const (
+	GeoJSON    = "geojson"
+	GeoJSONSeq = "geojsonseq"
+	KML        = "kml"
+	CSV        = "csv"
+	WKT        = "wkt"
+	STAC       = "stac"
+)
+
+var contentTypes = map[string]string{
+	GeoJSON:    "application/json",
+	GeoJSONSeq: "application/geo+json-seq",
+	KML:        "application/vnd.google-earth.kml+xml",
+	CSV:        "text/csv",
+	WKT:        "text/plain",
+	STAC:       "application/geo+json",
+}
+
+// mediaTypes maps the media types accepted in an Accept header to formats.
+// WKT is served as text/plain, but only negotiated by its own media type,
+// since browsers and other clients accept text/plain without meaning WKT.
+var mediaTypes = map[string]string{
+	"application/json":                     GeoJSON,
+	"application/geo+json":                 GeoJSON,
+	"application/geo+json-seq":             GeoJSONSeq,
+	"application/vnd.google-earth.kml+xml": KML,
+	"text/csv":                             CSV,
+	"application/wkt":                      WKT,
+	"application/stac+json":                STAC,
+}
+
+// FeatureEncoder writes features one at a time, so that streaming formats
+// never have to hold a whole response in memory in its encoded form
+type FeatureEncoder interface {
+	// Encode writes a single feature
+	Encode(feature *geojson.Feature) error
+	// Close finishes the document; it does not close the underlying writer
+	Close() error
+}
+
+// NewEncoder returns an encoder for the named format
+func NewEncoder(format string, writer io.Writer) (FeatureEncoder, error) {
+	switch format {
+	case "", GeoJSON:
+		return NewGeoJSONEncoder(writer), nil
+	case GeoJSONSeq:
+		return NewGeoJSONSeqEncoder(writer), nil
+	case KML:
+		return NewKMLEncoder(writer), nil
+	case CSV:
+		return NewCSVEncoder(writer), nil
+	case WKT:
+		return NewWKTEncoder(writer), nil
+	case STAC:
+		return NewSTACEncoder(writer), nil
+	default:
+		return nil, fmt.Errorf("The format value of %v is invalid", format)
+	}
+}
+
+// ContentType returns the MIME type of the named format
+func ContentType(format string) string {
+	if format == "" {
+		format = GeoJSON
+	}
+	return contentTypes[format]
+}
+
+// EncodeFeatureCollection writes each of the features and closes the encoder
+func EncodeFeatureCollection(encoder FeatureEncoder, fc *geojson.FeatureCollection) error {
+	for _, feature := range fc.Features {
+		if err := encoder.Encode(feature); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,109 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+const (
+	featureCollectionStart = `{"type":"FeatureCollection","features":[`
+	featureCollectionEnd   = `]}`
+	recordSeparator        = "\x1e"
+)
+
+// GeoJSONEncoder writes a GeoJSON FeatureCollection one feature at a time.
+// The output matches what geojson.Write produces for the whole collection.
+type GeoJSONEncoder struct {
+	writer  io.Writer
+	started bool
+	count   int
+}
+
+// NewGeoJSONEncoder creates a GeoJSONEncoder
+func NewGeoJSONEncoder(writer io.Writer) *GeoJSONEncoder {
+	return &GeoJSONEncoder{writer: writer}
+}
+
+// Encode writes a single feature, preceded by the start of the
+// collection if this is the first one
+func (e *GeoJSONEncoder) Encode(feature *geojson.Feature) error {
+	bytes, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+	if err = e.start(); err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err = io.WriteString(e.writer, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.writer.Write(bytes)
+	return err
+}
+
+// Close writes the end of the collection
+func (e *GeoJSONEncoder) Close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.writer, featureCollectionEnd)
+	return err
+}
+
+func (e *GeoJSONEncoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	_, err := io.WriteString(e.writer, featureCollectionStart)
+	return err
+}
+
+// GeoJSONSeqEncoder writes a GeoJSON text sequence (RFC 8142): one feature
+// per line, each preceded by an ASCII record separator
+type GeoJSONSeqEncoder struct {
+	writer io.Writer
+}
+
+// NewGeoJSONSeqEncoder creates a GeoJSONSeqEncoder
+func NewGeoJSONSeqEncoder(writer io.Writer) *GeoJSONSeqEncoder {
+	return &GeoJSONSeqEncoder{writer: writer}
+}
+
+// Encode writes a single feature
+func (e *GeoJSONSeqEncoder) Encode(feature *geojson.Feature) error {
+	bytes, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 0, len(bytes)+2)
+	record = append(record, recordSeparator...)
+	record = append(record, bytes...)
+	record = append(record, '\n')
+	_, err = e.writer.Write(record)
+	return err
+}
+
+// Close does nothing, since a sequence has no terminator
+func (e *GeoJSONSeqEncoder) Close() error {
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+func testingFeatureCollection() *geojson.FeatureCollection {
+	return geojson.NewFeatureCollection([]*geojson.Feature{
+		geojson.NewFeature(geojson.NewPoint([]float64{1, 2}), "a", map[string]interface{}{"cloudCover": 10.0}),
+		geojson.NewFeature(geojson.NewPoint([]float64{3, 4}), "b", map[string]interface{}{"cloudCover": 20.0}),
+	})
+}
+
+func TestGeoJSONEncoder(t *testing.T) {
+	for _, fc := range []*geojson.FeatureCollection{testingFeatureCollection(), geojson.NewFeatureCollection(nil)} {
+		var buffer bytes.Buffer
+		err := EncodeFeatureCollection(NewGeoJSONEncoder(&buffer), fc)
+		assert.Nil(t, err)
+
+		expected, _ := geojson.Write(fc)
+		assert.Equal(t, string(expected), buffer.String())
+	}
+}
+
+func TestGeoJSONSeqEncoder(t *testing.T) {
+	var buffer bytes.Buffer
+	err := EncodeFeatureCollection(NewGeoJSONSeqEncoder(&buffer), testingFeatureCollection())
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	assert.Equal(t, 2, len(lines))
+	for _, line := range lines {
+		assert.True(t, strings.HasPrefix(line, recordSeparator), "Expected a record separator before %v", line)
+		feature, err := geojson.FeatureFromBytes([]byte(strings.TrimPrefix(line, recordSeparator)))
+		assert.Nil(t, err, "Expected to parse a feature but received: %v", err)
+		assert.NotEmpty(t, feature.IDStr())
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	var buffer bytes.Buffer
+	for _, format := range []string{"", GeoJSON, GeoJSONSeq} {
+		_, err := NewEncoder(format, &buffer)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, ContentType(format))
+	}
+	_, err := NewEncoder("shapefile", &buffer)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,154 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+const (
+	kmlStart = xml.Header + `<kml xmlns="http://www.opengis.net/kml/2.2"><Document>`
+	kmlEnd   = `</Document></kml>`
+)
+
+// KMLEncoder writes a KML Document containing one Placemark per feature,
+// with the footprint as its geometry and the flattened properties as
+// its ExtendedData
+type KMLEncoder struct {
+	writer  io.Writer
+	started bool
+}
+
+// NewKMLEncoder creates a KMLEncoder
+func NewKMLEncoder(writer io.Writer) *KMLEncoder {
+	return &KMLEncoder{writer: writer}
+}
+
+// Encode writes a single feature as a Placemark
+func (e *KMLEncoder) Encode(feature *geojson.Feature) error {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("<Placemark><name>")
+	xml.EscapeText(&buffer, []byte(feature.IDStr()))
+	buffer.WriteString("</name><ExtendedData>")
+	properties := FlattenProperties(feature.Properties)
+	for _, key := range sortedKeys(properties) {
+		buffer.WriteString(`<Data name="`)
+		xml.EscapeText(&buffer, []byte(key))
+		buffer.WriteString(`"><value>`)
+		xml.EscapeText(&buffer, []byte(properties[key]))
+		buffer.WriteString("</value></Data>")
+	}
+	buffer.WriteString("</ExtendedData>")
+	writeKMLGeometry(&buffer, feature.Geometry)
+	buffer.WriteString("</Placemark>")
+
+	if err := e.start(); err != nil {
+		return err
+	}
+	_, err := e.writer.Write(buffer.Bytes())
+	return err
+}
+
+// Close writes the end of the document
+func (e *KMLEncoder) Close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.writer, kmlEnd)
+	return err
+}
+
+func (e *KMLEncoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	_, err := io.WriteString(e.writer, kmlStart)
+	return err
+}
+
+// writeKMLGeometry writes the KML equivalent of a GeoJSON geometry.
+// Geometries that KML cannot represent are omitted.
+func writeKMLGeometry(buffer *bytes.Buffer, geometry interface{}) {
+	switch typed := geometry.(type) {
+	case *geojson.Point:
+		buffer.WriteString("<Point><coordinates>")
+		writeKMLCoordinates(buffer, [][]float64{typed.Coordinates})
+		buffer.WriteString("</coordinates></Point>")
+	case *geojson.LineString:
+		writeKMLLineString(buffer, typed.Coordinates)
+	case *geojson.Polygon:
+		writeKMLPolygon(buffer, typed.Coordinates)
+	case *geojson.MultiPoint:
+		buffer.WriteString("<MultiGeometry>")
+		for _, point := range typed.Coordinates {
+			writeKMLGeometry(buffer, geojson.NewPoint(point))
+		}
+		buffer.WriteString("</MultiGeometry>")
+	case *geojson.MultiLineString:
+		buffer.WriteString("<MultiGeometry>")
+		for _, lineString := range typed.Coordinates {
+			writeKMLLineString(buffer, lineString)
+		}
+		buffer.WriteString("</MultiGeometry>")
+	case *geojson.MultiPolygon:
+		buffer.WriteString("<MultiGeometry>")
+		for _, polygon := range typed.Coordinates {
+			writeKMLPolygon(buffer, polygon)
+		}
+		buffer.WriteString("</MultiGeometry>")
+	}
+}
+
+func writeKMLLineString(buffer *bytes.Buffer, coordinates [][]float64) {
+	buffer.WriteString("<LineString><coordinates>")
+	writeKMLCoordinates(buffer, coordinates)
+	buffer.WriteString("</coordinates></LineString>")
+}
+
+func writeKMLPolygon(buffer *bytes.Buffer, rings [][][]float64) {
+	buffer.WriteString("<Polygon>")
+	for inx, ring := range rings {
+		boundary := "innerBoundaryIs"
+		if inx == 0 {
+			boundary = "outerBoundaryIs"
+		}
+		buffer.WriteString("<" + boundary + "><LinearRing><coordinates>")
+		writeKMLCoordinates(buffer, ring)
+		buffer.WriteString("</coordinates></LinearRing></" + boundary + ">")
+	}
+	buffer.WriteString("</Polygon>")
+}
+
+// writeKMLCoordinates writes space-separated lon,lat[,alt] tuples
+func writeKMLCoordinates(buffer *bytes.Buffer, coordinates [][]float64) {
+	for inx, coordinate := range coordinates {
+		if inx > 0 {
+			buffer.WriteString(" ")
+		}
+		for cinx := 0; cinx < len(coordinate) && cinx < 3; cinx++ {
+			if cinx > 0 {
+				buffer.WriteString(",")
+			}
+			buffer.WriteString(strconv.FormatFloat(coordinate[cinx], 'f', -1, 64))
+		}
+	}
+}
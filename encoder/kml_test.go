@@ -0,0 +1,77 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+type testKML struct {
+	Placemarks []struct {
+		Name string `xml:"name"`
+		Data []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value"`
+		} `xml:"ExtendedData>Data"`
+		Point   *struct{} `xml:"Point"`
+		Polygon *struct {
+			Outer string   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+			Inner []string `xml:"innerBoundaryIs>LinearRing>coordinates"`
+		} `xml:"Polygon"`
+	} `xml:"Document>Placemark"`
+}
+
+func TestKMLEncoder(t *testing.T) {
+	var (
+		buffer bytes.Buffer
+		result testKML
+	)
+	fc := testingFeatureCollection()
+	polygon := geojson.NewPolygon([][][]float64{
+		{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+		{{2, 2}, {3, 2}, {3, 3}, {2, 2}},
+	})
+	fc.Features = append(fc.Features, geojson.NewFeature(polygon, "<c&d>", map[string]interface{}{"note": "a < b"}))
+
+	err := EncodeFeatureCollection(NewKMLEncoder(&buffer), fc)
+	assert.Nil(t, err)
+
+	err = xml.Unmarshal(buffer.Bytes(), &result)
+	assert.Nil(t, err, "Expected to parse KML but received: %v\n%v", err, buffer.String())
+	assert.Equal(t, 3, len(result.Placemarks))
+	assert.Equal(t, "a", result.Placemarks[0].Name)
+	assert.NotNil(t, result.Placemarks[0].Point)
+	assert.Equal(t, "cloudCover", result.Placemarks[0].Data[0].Name)
+	assert.Equal(t, "10", result.Placemarks[0].Data[0].Value)
+
+	placemark := result.Placemarks[2]
+	assert.Equal(t, "<c&d>", placemark.Name)
+	assert.Equal(t, "a < b", placemark.Data[0].Value)
+	assert.NotNil(t, placemark.Polygon)
+	assert.Equal(t, "0,0 10,0 10,10 0,10 0,0", placemark.Polygon.Outer)
+	assert.Equal(t, 1, len(placemark.Polygon.Inner))
+}
+
+func TestKMLEncoderEmpty(t *testing.T) {
+	var buffer bytes.Buffer
+	err := EncodeFeatureCollection(NewKMLEncoder(&buffer), geojson.NewFeatureCollection(nil))
+	assert.Nil(t, err)
+	assert.Nil(t, xml.Unmarshal(buffer.Bytes(), &testKML{}))
+}
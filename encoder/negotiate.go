@@ -0,0 +1,78 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type acceptedType struct {
+	mediaType string
+	quality   float64
+}
+
+// Negotiate picks the output format for a request. An explicit format
+// parameter wins; otherwise the most preferred supported media type in the
+// Accept header is used. Anything else, including a missing or wildcard
+// Accept header, gets GeoJSON.
+func Negotiate(format, accept string) (string, error) {
+	if format != "" {
+		if _, ok := contentTypes[format]; !ok {
+			return "", fmt.Errorf("The format value of %v is invalid", format)
+		}
+		return format, nil
+	}
+	for _, accepted := range parseAccept(accept) {
+		if result, ok := mediaTypes[accepted.mediaType]; ok {
+			return result, nil
+		}
+	}
+	return GeoJSON, nil
+}
+
+// parseAccept returns the media types of an Accept header, most preferred
+// first. Types with a quality of zero are not acceptable and are dropped.
+func parseAccept(accept string) []acceptedType {
+	var result []acceptedType
+	for _, mediaRange := range strings.Split(accept, ",") {
+		parts := strings.Split(mediaRange, ";")
+		accepted := acceptedType{mediaType: strings.ToLower(strings.TrimSpace(parts[0])), quality: 1}
+		if accepted.mediaType == "" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if quality, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					accepted.quality = quality
+				}
+			}
+		}
+		if accepted.quality > 0 {
+			result = append(result, accepted)
+		}
+	}
+	sort.Stable(byQuality(result))
+	return result
+}
+
+type byQuality []acceptedType
+
+func (a byQuality) Len() int           { return len(a) }
+func (a byQuality) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byQuality) Less(i, j int) bool { return a[i].quality > a[j].quality }
@@ -0,0 +1,46 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		format, accept, expected string
+	}{
+		{"", "", GeoJSON},
+		{"", "*/*", GeoJSON},
+		{"", "text/html,application/xhtml+xml,*/*;q=0.8", GeoJSON},
+		{"", "text/csv", CSV},
+		{"", "application/geo+json;q=0.5, application/vnd.google-earth.kml+xml", KML},
+		{"", "text/csv;q=0, application/wkt", WKT},
+		{"", "text/plain", GeoJSON},
+		{"wkt", "", WKT},
+		{"", "application/geo+json-seq", GeoJSONSeq},
+		{"kml", "text/csv", KML},
+	}
+	for _, test := range tests {
+		format, err := Negotiate(test.format, test.accept)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, format, "Unexpected format for %v, %v", test.format, test.accept)
+	}
+
+	_, err := Negotiate("shapefile", "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,88 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+// FlattenProperties turns nested objects into dotted names,
+// e.g., bands.red, and renders every value as a string.
+// Arrays are rendered as JSON.
+func FlattenProperties(properties map[string]interface{}) map[string]string {
+	result := make(map[string]string)
+	flatten("", properties, result)
+	return result
+}
+
+func flatten(prefix string, properties map[string]interface{}, result map[string]string) {
+	for key, value := range properties {
+		name := prefix + key
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			flatten(name+".", typed, result)
+		case map[string]string:
+			for subKey, subValue := range typed {
+				result[name+"."+subKey] = subValue
+			}
+		default:
+			result[name] = propertyString(value)
+		}
+	}
+}
+
+func propertyString(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(typed)
+	case int:
+		return strconv.Itoa(typed)
+	default:
+		if bytes, err := json.Marshal(value); err == nil {
+			return string(bytes)
+		}
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// sortedKeys returns the names of the properties in a stable order
+func sortedKeys(properties map[string]string) []string {
+	result := make([]string, 0, len(properties))
+	for key := range properties {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// FeatureWKT returns the Well Known Text representation of the feature's
+// geometry, or an empty string if it has none that can be represented
+func FeatureWKT(feature *geojson.Feature) string {
+	if wkter, ok := feature.Geometry.(geojson.WKTer); ok {
+		return wkter.WKT()
+	}
+	return ""
+}
@@ -0,0 +1,250 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+// STAC constants
+const (
+	STACVersion          = "1.0.0"
+	STACEOExtension      = "https://stac-extensions.github.io/eo/v1.0.0/schema.json"
+	STACTidesExtension   = "https://venicegeo.github.io/dg-bf-ia-broker/stac/tides/v1.0.0/schema.json"
+	stacGeoTIFFMediaType = "image/tiff; application=geotiff"
+	stacJPEG2000         = "image/jp2"
+)
+
+// STACLink is a STAC link object. Method and Body describe
+// links that must be followed with a POST, as in STAC API search paging.
+type STACLink struct {
+	Rel    string      `json:"rel"`
+	Href   string      `json:"href"`
+	Type   string      `json:"type,omitempty"`
+	Title  string      `json:"title,omitempty"`
+	Method string      `json:"method,omitempty"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+// STACBand is an entry in an asset's eo:bands
+type STACBand struct {
+	Name       string `json:"name"`
+	CommonName string `json:"common_name,omitempty"`
+}
+
+// STACAsset is a STAC asset object
+type STACAsset struct {
+	Href    string     `json:"href"`
+	Type    string     `json:"type,omitempty"`
+	Roles   []string   `json:"roles,omitempty"`
+	EOBands []STACBand `json:"eo:bands,omitempty"`
+}
+
+// STACItem is a STAC 1.0 Item
+type STACItem struct {
+	Type           string                 `json:"type"`
+	STACVersion    string                 `json:"stac_version"`
+	STACExtensions []string               `json:"stac_extensions"`
+	ID             string                 `json:"id"`
+	Geometry       interface{}            `json:"geometry"`
+	Bbox           geojson.BoundingBox    `json:"bbox,omitempty"`
+	Properties     map[string]interface{} `json:"properties"`
+	Links          []STACLink             `json:"links"`
+	Assets         map[string]STACAsset   `json:"assets"`
+	Collection     string                 `json:"collection,omitempty"`
+}
+
+// The common names of the bands produced for Landsat and Sentinel-2 scenes
+var stacCommonNames = map[string]string{
+	"coastal":      "coastal",
+	"blue":         "blue",
+	"green":        "green",
+	"red":          "red",
+	"nir":          "nir",
+	"swir1":        "swir16",
+	"swir2":        "swir22",
+	"panchromatic": "pan",
+	"cirrus":       "cirrus",
+	"tirs1":        "lwir11",
+	"tirs2":        "lwir12",
+}
+
+// Properties placed under the tides extension
+var stacTideProperties = map[string]string{
+	"CurrentTide":         "tides:current",
+	"MinimumTide24Hours":  "tides:minimum_24h",
+	"MaximumTide24Hours":  "tides:maximum_24h",
+	"TideSource":          "tides:source",
+	"TideStation":         "tides:station",
+	"TideStationDistance": "tides:station_distance",
+	"TideSeries":          "tides:series",
+}
+
+// NewSTACItem converts a Beachfront feature into a STAC Item. Bands become
+// assets, cloud cover becomes eo:cloud_cover, and tides are placed under
+// the tides extension. Other properties are carried over unchanged.
+func NewSTACItem(feature *geojson.Feature, collection string) *STACItem {
+	result := STACItem{
+		Type:           "Feature",
+		STACVersion:    STACVersion,
+		STACExtensions: []string{STACEOExtension},
+		ID:             feature.IDStr(),
+		Geometry:       feature.Geometry,
+		Bbox:           feature.Bbox,
+		Properties:     make(map[string]interface{}),
+		Links:          []STACLink{},
+		Assets:         make(map[string]STACAsset),
+		Collection:     collection,
+	}
+	if result.Geometry != nil && len(result.Bbox) == 0 {
+		result.Bbox = feature.ForceBbox()
+	}
+
+	mediaType := stacGeoTIFFMediaType
+	if feature.PropertyString("fileFormat") == "jpeg2000" {
+		mediaType = stacJPEG2000
+	}
+	hasTides := false
+	result.Properties["datetime"] = nil
+	for key, value := range feature.Properties {
+		if name, ok := stacTideProperties[key]; ok {
+			result.Properties[name] = value
+			hasTides = true
+			continue
+		}
+		switch key {
+		case "acquiredDate":
+			if date, _ := value.(string); date != "" {
+				result.Properties["datetime"] = date
+			}
+		case "cloudCover":
+			if cloudCover := feature.PropertyFloat(key); !math.IsNaN(cloudCover) && cloudCover >= 0 {
+				result.Properties["eo:cloud_cover"] = cloudCover
+			}
+		case "resolution":
+			if gsd := feature.PropertyFloat(key); !math.IsNaN(gsd) && gsd > 0 {
+				result.Properties["gsd"] = gsd
+			}
+		case "sensorName":
+			if platform, _ := value.(string); platform != "" {
+				result.Properties["platform"] = platform
+			}
+		case "bands":
+			for band, href := range bandHrefs(value) {
+				result.Assets[band] = STACAsset{
+					Href:    href,
+					Type:    mediaType,
+					Roles:   []string{"data"},
+					EOBands: []STACBand{{Name: band, CommonName: stacCommonNames[band]}},
+				}
+			}
+		case "location":
+			if href, _ := value.(string); href != "" {
+				result.Assets["analytic"] = STACAsset{Href: href, Type: stacGeoTIFFMediaType, Roles: []string{"data"}}
+			}
+		case "fileFormat":
+			// conveyed by the asset media types
+		default:
+			result.Properties[key] = value
+		}
+	}
+	if hasTides {
+		result.STACExtensions = append(result.STACExtensions, STACTidesExtension)
+	}
+	return &result
+}
+
+// bandHrefs reads the bands property, which is a map of strings when
+// freshly made but a map of interfaces once it has been through JSON
+func bandHrefs(bands interface{}) map[string]string {
+	switch typed := bands.(type) {
+	case map[string]string:
+		return typed
+	case map[string]interface{}:
+		result := make(map[string]string)
+		for band, href := range typed {
+			if hrefStr, ok := href.(string); ok {
+				result[band] = hrefStr
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// STACEncoder writes a STAC ItemCollection one Item at a time.
+// Links and Collection may be set at any time before Close.
+type STACEncoder struct {
+	Collection string
+	Links      []STACLink
+	writer     io.Writer
+	started    bool
+	count      int
+}
+
+// NewSTACEncoder creates a STACEncoder
+func NewSTACEncoder(writer io.Writer) *STACEncoder {
+	return &STACEncoder{writer: writer}
+}
+
+// Encode converts a single feature and writes it as a STAC Item
+func (e *STACEncoder) Encode(feature *geojson.Feature) error {
+	bytes, err := json.Marshal(NewSTACItem(feature, e.Collection))
+	if err != nil {
+		return err
+	}
+	if err = e.start(); err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err = io.WriteString(e.writer, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.writer.Write(bytes)
+	return err
+}
+
+// Close writes the links and the end of the collection
+func (e *STACEncoder) Close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	links := e.Links
+	if links == nil {
+		links = []STACLink{}
+	}
+	bytes, err := json.Marshal(links)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.writer, `],"links":`+string(bytes)+`}`)
+	return err
+}
+
+func (e *STACEncoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	_, err := io.WriteString(e.writer, `{"type":"FeatureCollection","stac_version":"`+STACVersion+`","features":[`)
+	return err
+}
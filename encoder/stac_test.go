@@ -0,0 +1,88 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+func TestNewSTACItem(t *testing.T) {
+	polygon := geojson.NewPolygon([][][]float64{{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}})
+	feature := geojson.NewFeature(polygon, "LC80090472014280LGN00", map[string]interface{}{
+		"acquiredDate": "2014-10-07T15:00:00Z",
+		"cloudCover":   12.5,
+		"resolution":   30.0,
+		"sensorName":   "Landsat8",
+		"fileFormat":   "geotiff",
+		"bands":        map[string]string{"red": "https://example.com/B4.TIF", "swir1": "https://example.com/B6.TIF"},
+		"CurrentTide":  1.5,
+	})
+
+	item := NewSTACItem(feature, "Landsat8L1G")
+	assert.Equal(t, "Feature", item.Type)
+	assert.Equal(t, "Landsat8L1G", item.Collection)
+	assert.Equal(t, []string{STACEOExtension, STACTidesExtension}, item.STACExtensions)
+	assert.Equal(t, 4, len(item.Bbox))
+	assert.Equal(t, "2014-10-07T15:00:00Z", item.Properties["datetime"])
+	assert.Equal(t, 12.5, item.Properties["eo:cloud_cover"])
+	assert.Equal(t, 30.0, item.Properties["gsd"])
+	assert.Equal(t, "Landsat8", item.Properties["platform"])
+	assert.Equal(t, 1.5, item.Properties["tides:current"])
+	assert.Nil(t, item.Properties["CurrentTide"])
+	assert.Nil(t, item.Properties["bands"])
+
+	asset := item.Assets["swir1"]
+	assert.Equal(t, "https://example.com/B6.TIF", asset.Href)
+	assert.Equal(t, stacGeoTIFFMediaType, asset.Type)
+	assert.Equal(t, []STACBand{{Name: "swir1", CommonName: "swir16"}}, asset.EOBands)
+
+	// Unknown cloud cover is left out, and no tides means no tides extension
+	item = NewSTACItem(geojson.NewFeature(polygon, "a", map[string]interface{}{"cloudCover": -1.0}), "")
+	assert.Nil(t, item.Properties["eo:cloud_cover"])
+	assert.Equal(t, []string{STACEOExtension}, item.STACExtensions)
+	assert.Nil(t, item.Properties["datetime"])
+	_, ok := item.Properties["datetime"]
+	assert.True(t, ok, "Expected a null datetime")
+}
+
+func TestSTACEncoder(t *testing.T) {
+	var (
+		buffer bytes.Buffer
+		result struct {
+			Type        string     `json:"type"`
+			STACVersion string     `json:"stac_version"`
+			Features    []STACItem `json:"features"`
+			Links       []STACLink `json:"links"`
+		}
+	)
+	stacEncoder := NewSTACEncoder(&buffer)
+	stacEncoder.Collection = "test"
+	stacEncoder.Links = []STACLink{{Rel: "self", Href: "http://localhost/self"}}
+
+	err := EncodeFeatureCollection(stacEncoder, testingFeatureCollection())
+	assert.Nil(t, err)
+	err = json.Unmarshal(buffer.Bytes(), &result)
+	assert.Nil(t, err, "Expected to parse the ItemCollection but received: %v\n%v", err, buffer.String())
+	assert.Equal(t, "FeatureCollection", result.Type)
+	assert.Equal(t, STACVersion, result.STACVersion)
+	assert.Equal(t, 2, len(result.Features))
+	assert.Equal(t, "test", result.Features[1].Collection)
+	assert.Equal(t, "self", result.Links[0].Rel)
+}
@@ -0,0 +1,44 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoder
+
+import (
+	"io"
+
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+// WKTEncoder writes the Well Known Text of each feature's geometry,
+// one per line. Features without a geometry produce an empty line
+// so that lines still correspond to features.
+type WKTEncoder struct {
+	writer io.Writer
+}
+
+// NewWKTEncoder creates a WKTEncoder
+func NewWKTEncoder(writer io.Writer) *WKTEncoder {
+	return &WKTEncoder{writer: writer}
+}
+
+// Encode writes a single feature's geometry
+func (e *WKTEncoder) Encode(feature *geojson.Feature) error {
+	_, err := io.WriteString(e.writer, FeatureWKT(feature)+"\n")
+	return err
+}
+
+// Close does nothing, since the output has no terminator
+func (e *WKTEncoder) Close() error {
+	return nil
+}
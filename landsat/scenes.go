@@ -2,14 +2,19 @@ package landsat
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"math"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/venicegeo/dg-bf-ia-broker/metrics"
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
 	"github.com/venicegeo/dg-bf-ia-broker/util"
 )
 
@@ -18,23 +23,101 @@ type sceneMapRecord struct {
 	filePrefix   string
 }
 
-const defaultLandSatHost = "http://landsat-pds.s3.amazonaws.com"
+// DefaultLandSatHost serves the Landsat 8 scene list
+const DefaultLandSatHost = "http://landsat-pds.s3.amazonaws.com"
 
-var sceneMap = map[string]sceneMapRecord{}
+var (
+	landSatHost      string
+	landSatHostMutex sync.RWMutex
+	refreshIntervals = make(chan time.Duration, 1)
+)
+
+// The scene map is replaced whole by each update, which may be abandoned
+// while requests are reading it
+var (
+	sceneMap        = map[string]sceneMapRecord{}
+	sceneMapUpdated time.Time // zero until the map is first loaded
+	sceneMapMutex   sync.RWMutex
+)
+
+// The metrics of the scene map
+var (
+	sceneMapSize            = metrics.NewGauge("bf_landsat_scene_map_size", "Scenes in the Landsat scene map.")
+	sceneMapRefreshFailures = metrics.NewCounter("bf_landsat_scene_map_refresh_failures_total", "Failed updates of the Landsat scene map.")
+)
+
+func init() {
+	metrics.NewGaugeFunc("bf_landsat_scene_map_age_seconds", "Seconds since the Landsat scene map was updated; NaN until it is first loaded.", func() float64 {
+		if age, ok := SceneMapAge(); ok {
+			return age.Seconds()
+		}
+		return math.NaN()
+	})
+}
 
-// SceneMapIsReady contains a flag of whether the scene map has been loaded yet
-var SceneMapIsReady = false
+// SceneMapAge returns the time since the scene map was last updated, and
+// false if it has not been loaded yet
+func SceneMapAge() (time.Duration, bool) {
+	sceneMapMutex.RLock()
+	defer sceneMapMutex.RUnlock()
+	if sceneMapUpdated.IsZero() {
+		return 0, false
+	}
+	return time.Since(sceneMapUpdated), true
+}
+
+// SceneMapIsReady reports whether the scene map has been loaded yet
+func SceneMapIsReady() bool {
+	_, ok := SceneMapAge()
+	return ok
+}
+
+// SetLandSatHost sets the host from which the scene list is read,
+// in place of DefaultLandSatHost
+func SetLandSatHost(host string) {
+	landSatHostMutex.Lock()
+	defer landSatHostMutex.Unlock()
+	landSatHost = host
+}
+
+// SetRefreshInterval changes the delay between updates made by
+// UpdateSceneMapOnTicker
+func SetRefreshInterval(d time.Duration) {
+	for {
+		select {
+		case refreshIntervals <- d:
+			return
+		case <-refreshIntervals:
+			// Replace an interval that has not been picked up yet
+		}
+	}
+}
 
-// UpdateSceneMap updates the global scene map from a remote source
-func UpdateSceneMap() (err error) {
-	landSatHost := os.Getenv("LANDSAT_HOST")
+// UpdateSceneMap updates the global scene map from a remote source,
+// giving up once ctx is done
+func UpdateSceneMap(ctx context.Context) (err error) {
+	ctx, span := trace.Start(ctx, "landsat.UpdateSceneMap")
+	defer func() {
+		// An abandoned update has not failed
+		if err != nil && ctx.Err() == nil {
+			sceneMapRefreshFailures.Inc()
+		}
+		span.SetError(err)
+		span.End()
+	}()
+	landSatHostMutex.RLock()
+	landSatHost := landSatHost
+	landSatHostMutex.RUnlock()
 	if landSatHost == "" {
-		landSatHost = defaultLandSatHost
+		landSatHost = DefaultLandSatHost
 	}
 	sceneListURL := fmt.Sprintf("%s/c1/L8/scene_list.gz", landSatHost)
 
-	c := util.HTTPClient()
-	response, err := c.Get(sceneListURL)
+	request, err := http.NewRequestWithContext(ctx, "GET", sceneListURL, nil)
+	if err != nil {
+		return
+	}
+	response, err := util.Do(util.LandsatProfile, util.WithEndpoint(request, "scene-list"))
 	if err != nil {
 		return
 	}
@@ -76,18 +159,21 @@ doneReading:
 		}
 	}
 
-	sceneMap = newSceneMap
-	SceneMapIsReady = true
+	sceneMapMutex.Lock()
+	sceneMap, sceneMapUpdated = newSceneMap, time.Now()
+	sceneMapMutex.Unlock()
+	sceneMapSize.Set(float64(len(newSceneMap)))
+	span.SetAttribute("landsat.scene_count", len(newSceneMap))
 	return nil
 }
 
 // UpdateSceneMapAsync runs UpdateSceneMap asynchronously, returning
 // completion signals via channels
-func UpdateSceneMapAsync() (done chan bool, errored chan error) {
+func UpdateSceneMapAsync(ctx context.Context) (done chan bool, errored chan error) {
 	done = make(chan bool)
 	errored = make(chan error)
 	go func() {
-		err := UpdateSceneMap()
+		err := UpdateSceneMap(ctx)
 		if err == nil {
 			done <- true
 		} else {
@@ -100,17 +186,49 @@ func UpdateSceneMapAsync() (done chan bool, errored chan error) {
 }
 
 // UpdateSceneMapOnTicker updates the scene map on a loop with a delay of
-// a given duration. It logs any errors using the given LogContext
+// a given duration, which SetRefreshInterval may change. It logs any errors
+// using the given LogContext
 func UpdateSceneMapOnTicker(d time.Duration, ctx util.LogContext) {
+	RunSceneMapUpdates(d, nil, ctx)
+}
+
+// RunSceneMapUpdates is UpdateSceneMapOnTicker, returning once stop is
+// closed and abandoning any update still in progress
+func RunSceneMapUpdates(d time.Duration, stop <-chan struct{}, logContext util.LogContext) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	ticker := time.NewTicker(d)
+	defer ticker.Stop()
 	for {
-		done, errored := UpdateSceneMapAsync()
+		done, errored := UpdateSceneMapAsync(ctx)
 		select {
 		case <-done:
 		case err := <-errored:
-			util.LogAlert(ctx, "Failed to update scene ID to URL map: "+err.Error())
+			util.LogAlert(logContext, "Failed to update scene ID to URL map: "+err.Error())
+		case <-stop:
+			// Let the abandoned update finish without waiting for it
+			go func() {
+				select {
+				case <-done:
+				case <-errored:
+				}
+			}()
+			return
+		}
+		for waiting := true; waiting; {
+			select {
+			case <-ticker.C:
+				waiting = false
+			case next := <-refreshIntervals:
+				if next != d {
+					d = next
+					ticker.Reset(d)
+					util.LogInfo(logContext, fmt.Sprintf("Updating the scene map every %v", d))
+				}
+			case <-stop:
+				return
+			}
 		}
-		<-ticker.C
 	}
 }
 
@@ -128,10 +246,13 @@ func GetSceneFolderURL(sceneID string, dataType string) (folderURL string, fileP
 		return "", "", errors.New("Unknown LandSat data type: " + dataType)
 	}
 
-	if !SceneMapIsReady {
+	sceneMapMutex.RLock()
+	ready := !sceneMapUpdated.IsZero()
+	record, ok := sceneMap[sceneID]
+	sceneMapMutex.RUnlock()
+	if !ready {
 		return "", "", errors.New("Scene map is not ready yet")
 	}
-	record, ok := sceneMap[sceneID]
 	if !ok {
 		return "", "", errors.New("Scene not found with ID: " + sceneID)
 	}
@@ -2,6 +2,7 @@ package landsat
 
 import (
 	"compress/gzip"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -40,7 +41,7 @@ func (h mockAWSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func TestMain(m *testing.M) {
 	mockAWSServer := httptest.NewServer(mockAWSHandler{})
 	defer mockAWSServer.Close()
-	os.Setenv("LANDSAT_HOST", mockAWSServer.URL)
+	SetLandSatHost(mockAWSServer.URL)
 	code := m.Run()
 	os.Exit(code)
 }
@@ -54,14 +55,14 @@ func TestGetSceneFolderURL_BadIDs(t *testing.T) {
 	assert.NotNil(t, err, "Scene map not ready did not cause an error")
 	assert.Contains(t, err.Error(), "not ready")
 
-	UpdateSceneMap()
+	UpdateSceneMap(context.Background())
 	_, _, err = GetSceneFolderURL(missingLandSatID, l1tpDataType)
 	assert.NotNil(t, err, "Missing scene ID did not cause an error")
 	assert.Contains(t, err.Error(), "not found")
 }
 
 func TestGetSceneFolderURL_BadDataType(t *testing.T) {
-	UpdateSceneMap()
+	UpdateSceneMap(context.Background())
 	_, _, err := GetSceneFolderURL(goodLandSatID, badDataType)
 	assert.NotNil(t, err, "Invalid scene data type did not cause an error")
 	assert.Contains(t, err.Error(), "Unknown LandSat data type")
@@ -79,7 +80,7 @@ func TestGetSceneFolderURL_L1TSceneID(t *testing.T) {
 }
 
 func TestGetSceneFolderURL_L1TPSceneID(t *testing.T) {
-	UpdateSceneMap()
+	UpdateSceneMap(context.Background())
 	url, prefix, err := GetSceneFolderURL(goodLandSatID, l1tpDataType)
 	assert.Nil(t, err, "%v", err)
 	assert.Equal(t, "https://s3-us-west-2.fakeamazonaws.dummy/thisiscorrect/", url)
@@ -87,7 +88,7 @@ func TestGetSceneFolderURL_L1TPSceneID(t *testing.T) {
 }
 
 func TestUpdateSceneMapAsync_Success(t *testing.T) {
-	done, errored := UpdateSceneMapAsync()
+	done, errored := UpdateSceneMapAsync(context.Background())
 	select {
 	case <-done:
 		return
@@ -103,9 +104,28 @@ func TestUpdateSceneMapOnTicker(t *testing.T) {
 	go UpdateSceneMapOnTicker(500*time.Millisecond, ctx)
 
 	<-time.After(100 * time.Millisecond)
-	assert.True(t, SceneMapIsReady, "Scene map not ready immediately after scene map ticker update")
+	assert.True(t, SceneMapIsReady(), "Scene map not ready immediately after scene map ticker update")
 
-	SceneMapIsReady = false
+	sceneMapMutex.Lock()
+	sceneMapUpdated = time.Time{}
+	sceneMapMutex.Unlock()
 	<-time.After(600 * time.Millisecond)
-	assert.True(t, SceneMapIsReady, "Scene map not ready again after ticker should have gone off")
+	assert.True(t, SceneMapIsReady(), "Scene map not ready again after ticker should have gone off")
+}
+
+func TestRunSceneMapUpdates_Stops(t *testing.T) {
+	stop := make(chan struct{})
+	stopped := make(chan bool)
+	go func() {
+		RunSceneMapUpdates(time.Hour, stop, &util.BasicLogContext{})
+		stopped <- true
+	}()
+
+	<-time.After(100 * time.Millisecond)
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(1 * time.Second):
+		assert.Fail(t, "Scene map updates did not stop")
+	}
 }
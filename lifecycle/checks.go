@@ -0,0 +1,117 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The health a readiness report gives the broker's dependencies
+const (
+	Healthy  = "ok"
+	Degraded = "degraded" // the broker is up, but something it depends on is not
+)
+
+// Defaults for dependency checks
+const (
+	DefaultCheckTimeout = 5 * time.Second
+	DefaultCheckTTL     = 10 * time.Second
+)
+
+// A Check tests something the broker depends on. It returns details worth
+// reporting, which may be nil, and an error if the dependency is unusable.
+type Check func(ctx context.Context) (map[string]interface{}, error)
+
+// CheckResult is the outcome of a Check
+type CheckResult struct {
+	Status          string                 `json:"status"`
+	Error           string                 `json:"error,omitempty"`
+	Details         map[string]interface{} `json:"details,omitempty"`
+	DurationSeconds float64                `json:"durationSeconds"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// checks runs dependency checks, reusing their results for a while so
+// that frequent readiness requests do not flood the dependencies
+type checks struct {
+	timeout   time.Duration
+	ttl       time.Duration
+	mutex     sync.Mutex // held while checks run, so that they run once at a time
+	list      []namedCheck
+	results   map[string]CheckResult
+	checkedAt time.Time
+}
+
+func (c *checks) add(name string, check Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.list = append(c.list, namedCheck{name, check})
+	c.results = nil
+}
+
+// run returns the results of every check, running them in parallel if the
+// last results are too old
+func (c *checks) run() map[string]CheckResult {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.results != nil && time.Since(c.checkedAt) < c.ttl {
+		return c.results
+	}
+	results := make(map[string]CheckResult, len(c.list))
+	var resultsMutex sync.Mutex
+	var wait sync.WaitGroup
+	for _, item := range c.list {
+		wait.Add(1)
+		go func(item namedCheck) {
+			defer wait.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			defer cancel()
+			start := time.Now()
+			details, err := item.check(ctx)
+			result := CheckResult{Status: Healthy, Details: details, DurationSeconds: time.Since(start).Seconds()}
+			if err != nil {
+				result.Status, result.Error = Degraded, err.Error()
+			}
+			resultsMutex.Lock()
+			results[item.name] = result
+			resultsMutex.Unlock()
+		}(item)
+	}
+	wait.Wait()
+	c.results, c.checkedAt = results, time.Now()
+	return results
+}
+
+// health summarizes check results
+func health(results map[string]CheckResult) (string, []string) {
+	var failed []string
+	for name, result := range results {
+		if result.Status != Healthy {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	if len(failed) > 0 {
+		return Degraded, failed
+	}
+	return Healthy, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadyHandlerChecks(t *testing.T) {
+	manager, result := startTestManager(t, time.Second, 0, http.NotFoundHandler())
+	var calls int32
+	manager.AddCheck("up", func(ctx context.Context) (map[string]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[string]interface{}{"answer": 42}, nil
+	})
+	manager.AddCheck("down", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("unreachable")
+	})
+	manager.AddCheck("slow", func(ctx context.Context) (map[string]interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	manager.checks.timeout = 50 * time.Millisecond
+
+	ready := func() map[string]interface{} {
+		writer := httptest.NewRecorder()
+		manager.ReadyHandler().ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+		require.Equal(t, http.StatusOK, writer.Code, writer.Body.String())
+		var report map[string]interface{}
+		require.Nil(t, json.Unmarshal(writer.Body.Bytes(), &report))
+		return report
+	}
+	report := ready()
+	assert.Equal(t, Running, report["status"])
+	assert.Equal(t, Degraded, report["health"])
+	assert.Equal(t, []interface{}{"down", "slow"}, report["failing"])
+	checks := report["checks"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"answer": 42.0}, checks["up"].(map[string]interface{})["details"])
+	assert.Equal(t, "unreachable", checks["down"].(map[string]interface{})["error"])
+	assert.Equal(t, context.DeadlineExceeded.Error(), checks["slow"].(map[string]interface{})["error"])
+
+	// Results are reused until they expire
+	ready()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	manager.checks.mutex.Lock()
+	manager.checks.checkedAt = time.Now().Add(-DefaultCheckTTL)
+	manager.checks.mutex.Unlock()
+	ready()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	manager.Shutdown()
+	assert.Nil(t, <-result)
+}
+
+func TestReadyHandlerHealthy(t *testing.T) {
+	manager, result := startTestManager(t, time.Second, 0, http.NotFoundHandler())
+	manager.AddCheck("up", func(ctx context.Context) (map[string]interface{}, error) { return nil, nil })
+	writer := httptest.NewRecorder()
+	manager.ReadyHandler().ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, writer.Code)
+	var report map[string]interface{}
+	require.Nil(t, json.Unmarshal(writer.Body.Bytes(), &report))
+	assert.Equal(t, Healthy, report["health"])
+	assert.NotContains(t, report, "failing")
+
+	manager.Shutdown()
+	assert.Nil(t, <-result)
+}
@@ -0,0 +1,244 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// The states a Manager passes through
+const (
+	Starting = "starting"
+	Running  = "running"
+	Stopping = "stopping"
+	Stopped  = "stopped"
+)
+
+// DefaultShutdownTimeout leaves time to stop before Cloud Foundry, which
+// waits ten seconds after SIGTERM, kills the process
+const DefaultShutdownTimeout = 8 * time.Second
+
+// Manager runs an HTTP server and the background workers that go with it.
+// When told to stop, it stops taking new requests, lets those in flight
+// finish within a deadline, and then stops the workers.
+type Manager struct {
+	ShutdownTimeout time.Duration // how long requests in flight may take to finish
+	ShutdownDelay   time.Duration // how long to report not ready before closing the listener
+	context         util.LogContext
+	mutex           sync.Mutex
+	state           string
+	server          *http.Server
+	listener        net.Listener
+	stop            chan struct{}
+	workers         sync.WaitGroup
+	hooks           []func()
+	shutdown        sync.Once
+	shutdownErr     error
+	checks          checks
+}
+
+// New creates a Manager that gives requests in flight the given time to
+// finish when it stops
+func New(shutdownTimeout time.Duration) *Manager {
+	logContext := &util.BasicLogContext{}
+	logContext.SessionID() // created now, as the context is shared between goroutines
+	return &Manager{
+		ShutdownTimeout: shutdownTimeout,
+		context:         logContext,
+		state:           Starting,
+		stop:            make(chan struct{}),
+		checks:          checks{timeout: DefaultCheckTimeout, ttl: DefaultCheckTTL},
+	}
+}
+
+// AddCheck adds a test of a dependency to the readiness report. A failing
+// dependency degrades the broker but leaves it ready, since sending
+// requests elsewhere, or restarting it, would not bring the dependency back.
+func (m *Manager) AddCheck(name string, check Check) {
+	m.checks.add(name, check)
+}
+
+// Go runs a background worker, which must return soon after stop is closed
+func (m *Manager) Go(name string, worker func(stop <-chan struct{})) {
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		worker(m.stop)
+		util.LogInfo(m.context, "Stopped "+name)
+	}()
+}
+
+// OnStop adds a function to call once the server and workers have stopped
+func (m *Manager) OnStop(hook func()) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// Run serves HTTP requests until one of the given signals arrives, then
+// shuts down. It returns an error if the server could not listen or did
+// not shut down cleanly.
+func (m *Manager) Run(server *http.Server, signals ...os.Signal) error {
+	addr := server.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		m.Shutdown()
+		return err
+	}
+	terminate := make(chan os.Signal, 1)
+	signal.Notify(terminate, signals...)
+	defer signal.Stop(terminate)
+
+	served := make(chan error, 1)
+	m.mutex.Lock()
+	m.server, m.listener = server, listener
+	m.state = Running
+	m.mutex.Unlock()
+	go func() { served <- server.Serve(listener) }()
+	util.LogInfo(m.context, "Listening on "+listener.Addr().String())
+
+	select {
+	case err = <-served:
+		if err == http.ErrServerClosed {
+			// Shutdown was called directly; wait for it to finish
+			return m.Shutdown()
+		}
+		m.Shutdown()
+		return err
+	case received := <-terminate:
+		util.LogInfo(m.context, fmt.Sprintf("Received %v; shutting down", received))
+		return m.Shutdown()
+	}
+}
+
+// Shutdown stops the server and workers. It may be called more than once;
+// every call waits for the shutdown to finish and returns the same result.
+func (m *Manager) Shutdown() error {
+	m.shutdown.Do(func() {
+		m.mutex.Lock()
+		m.state = Stopping
+		server := m.server
+		m.mutex.Unlock()
+
+		if m.ShutdownDelay > 0 && server != nil {
+			// Give load balancers time to notice that we are not ready
+			time.Sleep(m.ShutdownDelay)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), m.ShutdownTimeout)
+		defer cancel()
+		if server != nil {
+			if err := server.Shutdown(ctx); err != nil {
+				m.shutdownErr = fmt.Errorf("Requests still in flight after %v: %v", m.ShutdownTimeout, err)
+				util.LogAlert(m.context, m.shutdownErr.Error())
+				server.Close()
+			}
+		}
+
+		close(m.stop)
+		stopped := make(chan struct{})
+		go func() {
+			m.workers.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			util.LogAlert(m.context, "Background workers did not stop in time")
+		}
+
+		m.mutex.Lock()
+		hooks := m.hooks
+		m.state = Stopped
+		m.mutex.Unlock()
+		for _, hook := range hooks {
+			hook()
+		}
+		util.LogInfo(m.context, "Shut down")
+		util.FlushLogs()
+	})
+	return m.shutdownErr
+}
+
+// State returns the state the Manager is in
+func (m *Manager) State() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.state
+}
+
+// Addr returns the address the server is listening on, or nil before it is
+func (m *Manager) Addr() net.Addr {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.listener == nil {
+		return nil
+	}
+	return m.listener.Addr()
+}
+
+// LiveHandler reports whether the process is alive, which it is until it
+// has stopped
+func (m *Manager) LiveHandler() http.Handler {
+	return m.stateHandler(func(state string) bool { return state != Stopped })
+}
+
+// ReadyHandler reports whether new requests should be sent here, which
+// they should only while the server is running. While it is, the report
+// includes the results of the checks, and whether any failed.
+func (m *Manager) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		state := m.State()
+		if state != Running {
+			writeState(writer, map[string]interface{}{"status": state}, http.StatusServiceUnavailable)
+			return
+		}
+		results := m.checks.run()
+		summary, failing := health(results)
+		report := map[string]interface{}{"status": state, "health": summary, "checks": results}
+		if len(failing) > 0 {
+			report["failing"] = failing
+		}
+		writeState(writer, report, http.StatusOK)
+	})
+}
+
+func (m *Manager) stateHandler(healthy func(string) bool) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		state := m.State()
+		status := http.StatusOK
+		if !healthy(state) {
+			status = http.StatusServiceUnavailable
+		}
+		writeState(writer, map[string]interface{}{"status": state}, status)
+	})
+}
+
+func writeState(writer http.ResponseWriter, report map[string]interface{}, status int) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	util.PrintJSON(writer, report, status)
+}
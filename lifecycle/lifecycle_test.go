@@ -0,0 +1,120 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startTestManager(t *testing.T, timeout, delay time.Duration, handler http.Handler) (*Manager, chan error) {
+	manager := New(timeout)
+	manager.ShutdownDelay = delay
+	result := make(chan error, 1)
+	go func() {
+		result <- manager.Run(&http.Server{Addr: "127.0.0.1:0", Handler: handler}, syscall.SIGUSR1)
+	}()
+	for start := time.Now(); manager.State() != Running; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("Server did not start")
+		}
+	}
+	return manager, result
+}
+
+func slowHandler(delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(delay)
+		writer.Write([]byte("done"))
+	})
+}
+
+func TestRunDrainsRequests(t *testing.T) {
+	manager, result := startTestManager(t, time.Second, 0, slowHandler(300*time.Millisecond))
+	stopped := make(chan bool, 1)
+	manager.Go("worker", func(stop <-chan struct{}) {
+		<-stop
+		stopped <- true
+	})
+	hooked := false
+	manager.OnStop(func() { hooked = true })
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, err := http.Get("http://" + manager.Addr().String() + "/")
+		assert.Nil(t, err)
+		responses <- response
+	}()
+	time.Sleep(100 * time.Millisecond)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+
+	assert.Nil(t, <-result)
+	response := <-responses
+	if assert.NotNil(t, response) {
+		assert.Equal(t, http.StatusOK, response.StatusCode, "Expected the request in flight to finish")
+	}
+	assert.True(t, <-stopped)
+	assert.True(t, hooked)
+	assert.Equal(t, Stopped, manager.State())
+	assert.Nil(t, manager.Shutdown(), "Expected Shutdown to be repeatable")
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	manager, result := startTestManager(t, 100*time.Millisecond, 0, slowHandler(time.Second))
+	go http.Get("http://" + manager.Addr().String() + "/")
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	assert.NotNil(t, manager.Shutdown())
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "Expected the shutdown to give up at its deadline")
+	assert.NotNil(t, <-result)
+}
+
+func TestHealthHandlers(t *testing.T) {
+	manager, result := startTestManager(t, time.Second, 200*time.Millisecond, http.NotFoundHandler())
+	check := func(handler http.Handler, expected int) {
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, expected, writer.Code, writer.Body.String())
+	}
+	check(manager.LiveHandler(), http.StatusOK)
+	check(manager.ReadyHandler(), http.StatusOK)
+
+	go manager.Shutdown()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, Stopping, manager.State())
+	check(manager.LiveHandler(), http.StatusOK)
+	check(manager.ReadyHandler(), http.StatusServiceUnavailable)
+
+	assert.Nil(t, <-result)
+	check(manager.LiveHandler(), http.StatusServiceUnavailable)
+	check(manager.ReadyHandler(), http.StatusServiceUnavailable)
+}
+
+func TestRunListenFailure(t *testing.T) {
+	manager, result := startTestManager(t, time.Second, 0, http.NotFoundHandler())
+	defer func() {
+		manager.Shutdown()
+		<-result
+	}()
+	other := New(time.Second)
+	assert.NotNil(t, other.Run(&http.Server{Addr: manager.Addr().String()}))
+	assert.Equal(t, Stopped, other.State())
+}
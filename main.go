@@ -23,8 +23,10 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/venicegeo/dg-bf-ia-broker/config"
 	"github.com/venicegeo/dg-bf-ia-broker/util"
 )
 
@@ -42,11 +44,41 @@ var versionCmd = &cobra.Command{
 	},
 }
 
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the Broker configuration",
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration, with secrets redacted",
+	Long: `
+Print the configuration that serve would use, given the same configuration
+file, environment and flags`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load(cmd.Flags())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err = cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	config.AddFlags(configPrintCmd.Flags())
+	configCmd.AddCommand(configPrintCmd)
+}
+
 // Execute adds all child commands to the root command PlanetCmd and sets flags
 // appropriately.
 func Execute() {
 	rootCommand.AddCommand(serveCmd)
 	rootCommand.AddCommand(versionCmd)
+	rootCommand.AddCommand(configCmd)
 	rootCommand.Execute()
 }
 
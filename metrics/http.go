@@ -0,0 +1,76 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The metrics of requests made to the broker
+var (
+	requests         = NewCounter("bf_http_requests_total", "Requests handled, by route, method and status.", "route", "method", "status")
+	requestDurations = NewHistogram("bf_http_request_duration_seconds", "Time taken to handle requests, by route, method and status.", DefaultBuckets, "route", "method", "status")
+	requestsInFlight = NewGauge("bf_http_requests_in_flight", "Requests being handled.")
+)
+
+// statusRecorder notes the status a handler writes
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(bytes []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(bytes)
+}
+
+// Flush lets handlers that stream their responses keep doing so
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// InstrumentHandler counts and times the requests a handler serves. The
+// route, such as /planet/{itemType}/{id}, labels them, so that the number
+// of series stays small.
+func InstrumentHandler(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+		recorder := &statusRecorder{ResponseWriter: writer}
+		start := time.Now()
+		defer func() {
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			status := strconv.Itoa(recorder.status)
+			requests.Inc(route, request.Method, status)
+			requestDurations.Observe(time.Since(start).Seconds(), route, request.Method, status)
+		}()
+		handler.ServeHTTP(recorder, request)
+	})
+}
@@ -0,0 +1,362 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is that of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms.
+// They reach further than Prometheus's defaults, since a discovery with
+// tides can take tens of seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// A collector writes the samples of one metric family
+type collector interface {
+	name() string
+	write(writer *bufio.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]collector{}
+)
+
+// register adds a metric family, panicking if its name is taken, as that
+// is a programming error
+func register(c collector) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[c.name()]; ok {
+		panic("metrics: " + c.name() + " is already registered")
+	}
+	registry[c.name()] = c
+}
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", ContentType)
+		buffered := bufio.NewWriter(writer)
+		Write(buffered)
+		buffered.Flush()
+	})
+}
+
+// Write writes every registered metric in the Prometheus text format
+func Write(writer *bufio.Writer) {
+	registryMutex.Lock()
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, len(names))
+	for index, name := range names {
+		collectors[index] = registry[name]
+	}
+	registryMutex.Unlock()
+	for _, c := range collectors {
+		c.write(writer)
+	}
+}
+
+// family holds what every kind of metric has in common
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+}
+
+func (f family) name() string {
+	return f.metricName
+}
+
+func (f family) writeHeader(writer *bufio.Writer) {
+	fmt.Fprintf(writer, "# HELP %v %v\n# TYPE %v %v\n", f.metricName, helpEscaper.Replace(f.help), f.metricName, f.kind)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// labelPairs renders label names and values, with any extra pairs after
+func labelPairs(names, values []string, extra ...string) string {
+	var pairs []string
+	for index, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[index])+`"`)
+	}
+	for index := 0; index+1 < len(extra); index += 2 {
+		pairs = append(pairs, extra[index]+`="`+labelEscaper.Replace(extra[index+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// seriesKey identifies the series for a set of label values
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// checkValues panics unless a value is given for every label, as a
+// mismatch is a programming error
+func (f family) checkValues(values []string) {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %v takes %d label values, not %d", f.metricName, len(f.labels), len(values)))
+	}
+}
+
+// values holds a float for each series of a counter or gauge
+type values struct {
+	family
+	mutex  sync.Mutex
+	series map[string]*sample
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+func newValues(kind, name, help string, labels []string) *values {
+	return &values{family: family{metricName: name, help: help, kind: kind, labels: labels}, series: map[string]*sample{}}
+}
+
+func (v *values) add(delta float64, set bool, labels []string) {
+	v.checkValues(labels)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	key := seriesKey(labels)
+	s, ok := v.series[key]
+	if !ok {
+		s = &sample{labels: append([]string(nil), labels...)}
+		v.series[key] = s
+	}
+	if set {
+		s.value = delta
+	} else {
+		s.value += delta
+	}
+}
+
+// Value returns the value of a series, or 0 if it has none yet
+func (v *values) Value(labels ...string) float64 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if s, ok := v.series[seriesKey(labels)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (v *values) write(writer *bufio.Writer) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.writeHeader(writer)
+	var keys []string
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		fmt.Fprintf(writer, "%v%v %v\n", v.metricName, labelPairs(v.labels, s.labels), formatValue(s.value))
+	}
+}
+
+// Counter is a count that only goes up, kept for each combination of its
+// labels' values
+type Counter struct {
+	*values
+}
+
+// NewCounter registers a counter
+func NewCounter(name, help string, labels ...string) Counter {
+	result := Counter{newValues("counter", name, help, labels)}
+	register(result)
+	return result
+}
+
+// Inc adds one to the series with the given label values
+func (c Counter) Inc(labels ...string) {
+	c.add(1, false, labels)
+}
+
+// Add adds a non-negative amount to the series with the given label values
+func (c Counter) Add(delta float64, labels ...string) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.add(delta, false, labels)
+}
+
+// Gauge is a value that goes up and down, kept for each combination of its
+// labels' values
+type Gauge struct {
+	*values
+}
+
+// NewGauge registers a gauge
+func NewGauge(name, help string, labels ...string) Gauge {
+	result := Gauge{newValues("gauge", name, help, labels)}
+	register(result)
+	return result
+}
+
+// Set sets the series with the given label values
+func (g Gauge) Set(value float64, labels ...string) {
+	g.add(value, true, labels)
+}
+
+// Add changes the series with the given label values by delta
+func (g Gauge) Add(delta float64, labels ...string) {
+	g.add(delta, false, labels)
+}
+
+// Inc adds one to the series with the given label values
+func (g Gauge) Inc(labels ...string) {
+	g.add(1, false, labels)
+}
+
+// Dec subtracts one from the series with the given label values
+func (g Gauge) Dec(labels ...string) {
+	g.add(-1, false, labels)
+}
+
+// function is a metric whose single value is read when it is collected
+type function struct {
+	family
+	read func() float64
+}
+
+func (f function) write(writer *bufio.Writer) {
+	f.writeHeader(writer)
+	fmt.Fprintf(writer, "%v %v\n", f.metricName, formatValue(f.read()))
+}
+
+// NewGaugeFunc registers a gauge whose value is read from a function
+func NewGaugeFunc(name, help string, read func() float64) {
+	register(function{family{metricName: name, help: help, kind: "gauge"}, read})
+}
+
+// NewCounterFunc registers a counter whose value is read from a function,
+// for counts kept elsewhere
+func NewCounterFunc(name, help string, read func() float64) {
+	register(function{family{metricName: name, help: help, kind: "counter"}, read})
+}
+
+// Histogram counts observations, such as latencies, in buckets, for each
+// combination of its labels' values
+type Histogram struct {
+	*histogram
+}
+
+type histogram struct {
+	family
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*distribution
+}
+
+type distribution struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds,
+// which must be increasing
+func NewHistogram(name, help string, buckets []float64, labels ...string) Histogram {
+	result := Histogram{&histogram{family: family{metricName: name, help: help, kind: "histogram", labels: labels}, buckets: buckets, series: map[string]*distribution{}}}
+	register(result)
+	return result
+}
+
+// Observe records a value in the series with the given label values
+func (h Histogram) Observe(value float64, labels ...string) {
+	h.checkValues(labels)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	key := seriesKey(labels)
+	d, ok := h.series[key]
+	if !ok {
+		d = &distribution{labels: append([]string(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = d
+	}
+	if index := sort.SearchFloat64s(h.buckets, value); index < len(h.buckets) {
+		d.counts[index]++
+	}
+	d.count++
+	d.sum += value
+}
+
+// Count returns the number of observations in a series
+func (h Histogram) Count(labels ...string) uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if d, ok := h.series[seriesKey(labels)]; ok {
+		return d.count
+	}
+	return 0
+}
+
+func (h *histogram) write(writer *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.writeHeader(writer)
+	var keys []string
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		d := h.series[key]
+		var cumulative uint64
+		for index, bound := range h.buckets {
+			cumulative += d.counts[index]
+			fmt.Fprintf(writer, "%v_bucket%v %d\n", h.metricName, labelPairs(h.labels, d.labels, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(writer, "%v_bucket%v %d\n", h.metricName, labelPairs(h.labels, d.labels, "le", "+Inf"), d.count)
+		fmt.Fprintf(writer, "%v_sum%v %v\n", h.metricName, labelPairs(h.labels, d.labels), formatValue(d.sum))
+		fmt.Fprintf(writer, "%v_count%v %d\n", h.metricName, labelPairs(h.labels, d.labels), d.count)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collect returns what a collector writes
+func collect(c collector) string {
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+	c.write(writer)
+	writer.Flush()
+	return buffer.String()
+}
+
+func TestCounter(t *testing.T) {
+	counter := NewCounter("test_counter_total", "A test\\counter.", "route", "status")
+	counter.Inc("/b", "200")
+	counter.Add(2, "/a", "500")
+	counter.Inc("/a", "500")
+	counter.Inc("/c\"\n", "200")
+	assert.Equal(t, 3.0, counter.Value("/a", "500"))
+	assert.Equal(t, 0.0, counter.Value("/d", "200"))
+	assert.Equal(t, `# HELP test_counter_total A test\\counter.
+# TYPE test_counter_total counter
+test_counter_total{route="/a",status="500"} 3
+test_counter_total{route="/b",status="200"} 1
+test_counter_total{route="/c\"\n",status="200"} 1
+`, collect(counter))
+	assert.Panics(t, func() { counter.Inc("/a") }, "Expected a missing label value to panic")
+	assert.Panics(t, func() { counter.Add(-1, "/a", "500") }, "Expected a counter not to decrease")
+	assert.Panics(t, func() { NewCounter("test_counter_total", "Again.") }, "Expected a duplicate name to panic")
+}
+
+func TestGauge(t *testing.T) {
+	gauge := NewGauge("test_gauge", "A test gauge.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	gauge.Add(0.5)
+	assert.Equal(t, 1.5, gauge.Value())
+	gauge.Set(7)
+	assert.Contains(t, collect(gauge), "\ntest_gauge 7\n")
+
+	NewGaugeFunc("test_gauge_func", "A test gauge function.", func() float64 { return math.NaN() })
+	NewCounterFunc("test_counter_func_total", "A test counter function.", func() float64 { return 12 })
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+	Write(writer)
+	writer.Flush()
+	assert.Contains(t, buffer.String(), "# TYPE test_gauge_func gauge\ntest_gauge_func NaN\n")
+	assert.Contains(t, buffer.String(), "# TYPE test_counter_func_total counter\ntest_counter_func_total 12\n")
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram("test_duration_seconds", "A test histogram.", []float64{0.1, 1}, "route")
+	histogram.Observe(0.05, "/a")
+	histogram.Observe(0.1, "/a")
+	histogram.Observe(0.5, "/a")
+	histogram.Observe(5, "/a")
+	assert.Equal(t, uint64(4), histogram.Count("/a"))
+	assert.Equal(t, `# HELP test_duration_seconds A test histogram.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/a",le="0.1"} 2
+test_duration_seconds_bucket{route="/a",le="1"} 3
+test_duration_seconds_bucket{route="/a",le="+Inf"} 4
+test_duration_seconds_sum{route="/a"} 5.65
+test_duration_seconds_count{route="/a"} 4
+`, collect(histogram))
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	handler := InstrumentHandler("/things/{id}", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, 1.0, requestsInFlight.Value())
+		if request.URL.Path == "/things/missing" {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Write([]byte("thing"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things/2", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things/missing", nil))
+	assert.Equal(t, 2.0, requests.Value("/things/{id}", "GET", "200"))
+	assert.Equal(t, 1.0, requests.Value("/things/{id}", "GET", "404"))
+	assert.Equal(t, uint64(2), requestDurations.Count("/things/{id}", "GET", "200"))
+	assert.Equal(t, 0.0, requestsInFlight.Value())
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), `bf_http_requests_total{route="/things/{id}",method="GET",status="404"} 1`)
+}
@@ -0,0 +1,223 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogc
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/venicegeo/dg-bf-ia-broker/encoder"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/stac"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 250 // the largest page Planet Labs provides
+)
+
+// featureCollection is a page of items. Links are omitted for WFS.
+type featureCollection struct {
+	Type           string             `json:"type"`
+	Features       []*geojson.Feature `json:"features"`
+	Links          []encoder.STACLink `json:"links,omitempty"`
+	NumberReturned int                `json:"numberReturned"`
+	TimeStamp      string             `json:"timeStamp"`
+}
+
+func newFeatureCollection(fc *geojson.FeatureCollection) featureCollection {
+	result := featureCollection{
+		Type:      "FeatureCollection",
+		Features:  fc.Features,
+		TimeStamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	if result.Features == nil {
+		result.Features = []*geojson.Feature{}
+	}
+	result.NumberReturned = len(result.Features)
+	return result
+}
+
+// writeSearchError reports a failed search
+func writeSearchError(request *http.Request, writer http.ResponseWriter, context *planet.Context, err error) {
+	switch herr := err.(type) {
+	case util.HTTPErr:
+		util.WriteHTTPErr(request, writer, context, herr)
+	default:
+		err = util.LogSimpleErr(context, "Failed to search Planet Labs scenes. ", err)
+		util.HTTPError(request, writer, context, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parseLimit reads a limit, which is capped at the largest page available
+func parseLimit(limitStr string) (int, error) {
+	if limitStr == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("The limit value of %v is invalid", limitStr)
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, nil
+}
+
+// parseBbox reads a bbox of four or six longitudes and latitudes
+func parseBbox(bboxStr string) (geojson.BoundingBox, error) {
+	var result geojson.BoundingBox
+	if bboxStr == "" {
+		return result, nil
+	}
+	for _, coordStr := range strings.Split(bboxStr, ",") {
+		coord, err := strconv.ParseFloat(coordStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("The bbox value of %v is invalid", bboxStr)
+		}
+		result = append(result, coord)
+	}
+	switch len(result) {
+	case 4:
+		return result, nil
+	case 6:
+		return geojson.BoundingBox{result[0], result[1], result[3], result[4]}, nil
+	default:
+		return nil, fmt.Errorf("The bbox value of %v is invalid", bboxStr)
+	}
+}
+
+// ItemsHandler is a handler for the features of an OGC API - Features collection
+// @Title ogcItemsHandler
+// @Description discovers scenes from Planet Labs, as OGC API - Features items
+// @Param   X-Planet-Key    header  string  false        "Planet Labs API Key, unless the broker holds the key"
+// @Param   PL_API_KEY      query   string  false        "Planet Labs API Key (deprecated)"
+// @Param   itemType        path    string  true         "Planet Labs Item Type, e.g., REOrthoTile"
+// @Param   bbox            query   string  false        "The bounding box (x1,y1,x2,y2)"
+// @Param   datetime        query   string  false        "An RFC 3339 date-time or interval, e.g., 2017-01-01T00:00:00Z/.."
+// @Param   limit           query   number  false        "The maximum number of items per page (default 10)"
+// @Param   page            query   string  false        "A token for a further page of results, from the next link"
+// @Param   f               query   string  false        "The output format: json (default), or any discovery format"
+// @Success 200 {object}  geojson.FeatureCollection
+// @Failure 400 {object}  string
+// @Router /ogc/collections/{itemType}/items [get]
+type ItemsHandler struct {
+	Context planet.Context
+}
+
+// NewItemsHandler creates a new handler using the current
+// planet Settings
+func NewItemsHandler() ItemsHandler {
+	return ItemsHandler{Context: planet.NewContext()}
+}
+
+// ServeHTTP implements the http.Handler interface for the ItemsHandler type
+func (h ItemsHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	var (
+		options planet.SearchOptions
+		fc      *geojson.FeatureCollection
+		next    string
+		err     error
+	)
+	util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method, Actee: request.URL.String(), Message: "Receiving /ogc items request", Severity: util.INFO})
+
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+
+	if err = h.Context.SetPlanetKey(writer, request); err != nil {
+		herr := err.(util.HTTPErr)
+		util.LogSimpleErr(&h.Context, herr.Message, nil)
+		util.WriteHTTPErr(request, writer, &h.Context, herr)
+		return
+	}
+
+	options.ItemType = mux.Vars(request)["itemType"]
+	if _, found := stac.FindCollection(options.ItemType, ""); !found {
+		util.HTTPError(request, writer, &h.Context, "No collection named "+options.ItemType, http.StatusNotFound)
+		return
+	}
+
+	// Responses from here on, errors included, depend on the Accept header
+	writer.Header().Set("Vary", "Accept")
+	format := request.FormValue("f")
+	if format == "json" {
+		format = encoder.GeoJSON
+	}
+	if format, err = encoder.Negotiate(format, request.Header.Get("Accept")); err == nil {
+		if options.Bbox, err = parseBbox(request.FormValue("bbox")); err == nil {
+			if options.AcquiredDate, options.MaxAcquiredDate, err = stac.ParseDatetime(request.FormValue("datetime")); err == nil {
+				options.PageSize, err = parseLimit(request.FormValue("limit"))
+			}
+		}
+	}
+	if err != nil {
+		util.LogSimpleErr(&h.Context, err.Error(), nil)
+		util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options.PageToken = request.FormValue("page")
+
+	if fc, next, err = planet.SearchScenes(request.Context(), options, &h.Context); err != nil {
+		writeSearchError(request, writer, &h.Context, err)
+		return
+	}
+
+	if format == encoder.GeoJSON {
+		result := newFeatureCollection(fc)
+		result.Links = itemsLinks(request, options.ItemType, next)
+		writer.Header().Set("Content-Type", geoJSONMediaType)
+		util.PrintJSON(writer, result, http.StatusOK)
+	} else {
+		featureEncoder, _ := encoder.NewEncoder(format, writer)
+		if stacEncoder, ok := featureEncoder.(*encoder.STACEncoder); ok {
+			stacEncoder.Collection = options.ItemType
+			stacEncoder.Links = itemsLinks(request, options.ItemType, next)
+		}
+		writer.Header().Set("Content-Type", encoder.ContentType(format))
+		if err = encoder.EncodeFeatureCollection(featureEncoder, fc); err != nil {
+			util.LogSimpleErr(&h.Context, "Failed to write output features", err)
+			return
+		}
+	}
+	util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method + " response", Actee: request.URL.String(), Message: "Sending /ogc items response", Severity: util.INFO})
+}
+
+// itemsLinks returns the self, collection and, if there are more results,
+// next links for a page of items
+func itemsLinks(request *http.Request, itemType, next string) []encoder.STACLink {
+	baseURL := util.BaseURL(request)
+	self := planet.LinkURL(request).String()
+	result := []encoder.STACLink{
+		{Rel: "self", Href: self, Type: geoJSONMediaType},
+		{Rel: "collection", Href: baseURL + Root + "/collections/" + itemType, Type: jsonMediaType},
+	}
+	if next != "" {
+		nextURL, _ := url.Parse(self)
+		query := nextURL.Query()
+		query.Set("page", next)
+		nextURL.RawQuery = query.Encode()
+		result = append(result, encoder.STACLink{Rel: "next", Href: nextURL.String(), Type: geoJSONMediaType})
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/encoder"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+)
+
+func TestItems(t *testing.T) {
+	var result struct {
+		featureCollection
+		Features []map[string]interface{} `json:"features"`
+	}
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	url := "/ogc/collections/REOrthoTile/items?PL_API_KEY=" + testingKey + "&bbox=-10,-10,10,10&datetime=2016-01-01T00:00:00Z/2017-01-01T00:00:00Z&limit=500"
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code, "Expected items to succeed but received: %v", recorder.Body.String())
+	assert.Equal(t, "application/geo+json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "250", planetServer.LastRequest().FormValue("_page_size"))
+	assert.Contains(t, planetServer.LastBody(), `"lte":"2017-01-01T00:00:00Z"`)
+
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, "FeatureCollection", result.Type)
+	assert.Equal(t, 1, result.NumberReturned)
+	assert.Equal(t, 1, len(result.Features))
+	assert.NotEmpty(t, result.TimeStamp)
+	if assert.Equal(t, 3, len(result.Links)) {
+		assert.Equal(t, "next", result.Links[2].Rel)
+		assert.NotContains(t, result.Links[0].Href, testingKey, "Expected the API key to be left out of links")
+		assert.NotContains(t, result.Links[2].Href, testingKey, "Expected the API key to be left out of links")
+
+		recorder = httptest.NewRecorder()
+		request := httptest.NewRequest("GET", result.Links[2].Href, nil)
+		request.Header.Set(planet.PlanetKeyHeader, testingKey)
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code, "Expected the next page to succeed but received: %v", recorder.Body.String())
+		assert.Equal(t, "2", planetServer.LastRequest().FormValue("_page"))
+	}
+}
+
+func TestItemsFormats(t *testing.T) {
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	base := "/ogc/collections/REOrthoTile/items?PL_API_KEY=" + testingKey
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", base+"&f=kml", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, encoder.ContentType(encoder.KML), recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "<Placemark>")
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", base+"&f=stac", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"collection":"REOrthoTile"`)
+}
+
+func TestItemsInvalid(t *testing.T) {
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	tests := map[string]int{
+		"/ogc/collections/REOrthoTile/items":                                         http.StatusBadRequest,
+		"/ogc/collections/nothing/items?PL_API_KEY=" + testingKey:                    http.StatusNotFound,
+		"/ogc/collections/REOrthoTile/items?bbox=1,2,3&PL_API_KEY=" + testingKey:     http.StatusBadRequest,
+		"/ogc/collections/REOrthoTile/items?datetime=today&PL_API_KEY=" + testingKey: http.StatusBadRequest,
+		"/ogc/collections/REOrthoTile/items?limit=0&PL_API_KEY=" + testingKey:        http.StatusBadRequest,
+		"/ogc/collections/REOrthoTile/items?f=nothing&PL_API_KEY=" + testingKey:      http.StatusBadRequest,
+		"/ogc/collections/REOrthoTile/items?page=nothing&PL_API_KEY=" + testingKey:   http.StatusBadRequest,
+	}
+	for url, status := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, status, recorder.Code, "Unexpected status for %v: %v", url, recorder.Body.String())
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogc
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/venicegeo/dg-bf-ia-broker/encoder"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/stac"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// Root is the path under which OGC API - Features is served
+const Root = "/ogc"
+
+const (
+	jsonMediaType    = "application/json"
+	geoJSONMediaType = "application/geo+json"
+	crs84            = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+)
+
+var conformsTo = []string{
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
+}
+
+// Collection is an OGC API - Features collection: the footprints
+// of the scenes of one item type
+type Collection struct {
+	ID          string             `json:"id"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Extent      stac.Extent        `json:"extent"`
+	ItemType    string             `json:"itemType"`
+	CRS         []string           `json:"crs"`
+	Links       []encoder.STACLink `json:"links"`
+}
+
+// newCollection describes the same item type as a STAC collection does
+func newCollection(source stac.Collection, baseURL string) Collection {
+	path := baseURL + Root + "/collections/" + source.ID
+	return Collection{
+		ID:          source.ID,
+		Title:       source.Title,
+		Description: source.Description,
+		Extent:      source.Extent,
+		ItemType:    "feature",
+		CRS:         []string{crs84},
+		Links: []encoder.STACLink{
+			{Rel: "self", Href: path, Type: jsonMediaType},
+			{Rel: "items", Href: path + "/items", Type: geoJSONMediaType},
+		},
+	}
+}
+
+// LandingHandler is a handler for the OGC API - Features landing page
+// @Title ogcLandingHandler
+// @Description the OGC API - Features landing page
+// @Router /ogc [get]
+type LandingHandler struct {
+	Context planet.Context
+}
+
+// NewLandingHandler creates a new handler
+func NewLandingHandler() LandingHandler {
+	return LandingHandler{}
+}
+
+// ServeHTTP implements the http.Handler interface for the LandingHandler type
+func (h LandingHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+	baseURL := util.BaseURL(request)
+	writeJSON(writer, map[string]interface{}{
+		"title":       "Beachfront Image Archive Broker",
+		"description": "Scene footprints from the image archives searched by Beachfront",
+		"links": []encoder.STACLink{
+			{Rel: "self", Href: baseURL + Root, Type: jsonMediaType},
+			{Rel: "conformance", Href: baseURL + Root + "/conformance", Type: jsonMediaType},
+			{Rel: "data", Href: baseURL + Root + "/collections", Type: jsonMediaType},
+		},
+	})
+}
+
+// ConformanceHandler is a handler for the OGC API - Features conformance classes
+// @Title ogcConformanceHandler
+// @Description the conformance classes implemented by OGC API - Features
+// @Router /ogc/conformance [get]
+type ConformanceHandler struct {
+	Context planet.Context
+}
+
+// NewConformanceHandler creates a new handler
+func NewConformanceHandler() ConformanceHandler {
+	return ConformanceHandler{}
+}
+
+// ServeHTTP implements the http.Handler interface for the ConformanceHandler type
+func (h ConformanceHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+	writeJSON(writer, map[string][]string{"conformsTo": conformsTo})
+}
+
+// CollectionsHandler is a handler for the OGC API - Features collections,
+// one per item type
+// @Title ogcCollectionsHandler
+// @Description lists the collections, or describes one
+// @Param   itemType        path    string  false        "The item type"
+// @Failure 404 {object}  string
+// @Router /ogc/collections/{itemType} [get]
+type CollectionsHandler struct {
+	Context planet.Context
+}
+
+// NewCollectionsHandler creates a new handler
+func NewCollectionsHandler() CollectionsHandler {
+	return CollectionsHandler{}
+}
+
+// ServeHTTP implements the http.Handler interface for the CollectionsHandler type
+func (h CollectionsHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+	baseURL := util.BaseURL(request)
+	if itemType, ok := mux.Vars(request)["itemType"]; ok {
+		source, found := stac.FindCollection(itemType, baseURL)
+		if !found {
+			util.HTTPError(request, writer, &h.Context, "No collection named "+itemType, http.StatusNotFound)
+			return
+		}
+		writeJSON(writer, newCollection(source, baseURL))
+		return
+	}
+	collections := []Collection{}
+	for _, source := range stac.Collections(baseURL) {
+		collections = append(collections, newCollection(source, baseURL))
+	}
+	writeJSON(writer, map[string]interface{}{
+		"collections": collections,
+		"links":       []encoder.STACLink{{Rel: "self", Href: baseURL + Root + "/collections", Type: jsonMediaType}},
+	})
+}
+
+func writeJSON(writer http.ResponseWriter, output interface{}) {
+	writer.Header().Set("Content-Type", jsonMediaType)
+	util.PrintJSON(writer, output, http.StatusOK)
+}
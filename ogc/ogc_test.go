@@ -0,0 +1,76 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanding(t *testing.T) {
+	var landing struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "http://broker.example.com/ogc", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &landing))
+	assert.Equal(t, 3, len(landing.Links))
+	assert.Equal(t, "http://broker.example.com/ogc/collections", landing.Links[2].Href)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/ogc/conformance", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "ogcapi-features-1/1.0/conf/geojson")
+}
+
+func TestCollections(t *testing.T) {
+	var (
+		collections struct {
+			Collections []Collection `json:"collections"`
+		}
+		collection Collection
+	)
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/ogc/collections", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &collections))
+	assert.Equal(t, 5, len(collections.Collections))
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "http://broker.example.com/ogc/collections/PSOrthoTile", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &collection))
+	assert.Equal(t, "PSOrthoTile", collection.ID)
+	assert.Equal(t, "feature", collection.ItemType)
+	assert.Equal(t, "http://broker.example.com/ogc/collections/PSOrthoTile/items", collection.Links[1].Href)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/ogc/collections/nothing", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,318 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/stac"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+const (
+	wfsVersion   = "2.0.0"
+	xmlMediaType = "application/xml"
+)
+
+// The WFS parameters, which are matched without regard to case
+var wfsParameters = map[string]bool{
+	"service": true, "version": true, "acceptversions": true, "request": true,
+	"typenames": true, "typename": true, "bbox": true, "count": true,
+	"maxfeatures": true, "startindex": true, "outputformat": true,
+}
+
+// The output formats GetFeature accepts, all of which produce GeoJSON
+var wfsOutputFormats = map[string]bool{
+	"": true, "application/json": true, "application/geo+json": true, "json": true, "geojson": true,
+}
+
+// wfsException is a WFS error, reported as an OWS ExceptionReport
+// with a status of 400 unless another is given
+type wfsException struct {
+	code    string
+	locator string
+	message string
+	status  int
+}
+
+func (e wfsException) Error() string {
+	return e.message
+}
+
+type owsExceptionReport struct {
+	XMLName   xml.Name `xml:"ows:ExceptionReport"`
+	XMLNSOWS  string   `xml:"xmlns:ows,attr"`
+	Version   string   `xml:"version,attr"`
+	Exception struct {
+		Code    string `xml:"exceptionCode,attr"`
+		Locator string `xml:"locator,attr,omitempty"`
+		Text    string `xml:"ows:ExceptionText"`
+	} `xml:"ows:Exception"`
+}
+
+type owsOperation struct {
+	Name       string  `xml:"name,attr"`
+	Get        owsLink `xml:"ows:DCP>ows:HTTP>ows:Get"`
+	Parameters []owsParameter
+}
+
+type owsLink struct {
+	Href string `xml:"xlink:href,attr"`
+}
+
+type owsParameter struct {
+	XMLName xml.Name `xml:"ows:Parameter"`
+	Name    string   `xml:"name,attr"`
+	Values  []string `xml:"ows:AllowedValues>ows:Value"`
+}
+
+type wfsFeatureType struct {
+	Name        string `xml:"wfs:Name"`
+	Title       string `xml:"wfs:Title"`
+	Abstract    string `xml:"wfs:Abstract"`
+	DefaultCRS  string `xml:"wfs:DefaultCRS"`
+	LowerCorner string `xml:"ows:WGS84BoundingBox>ows:LowerCorner"`
+	UpperCorner string `xml:"ows:WGS84BoundingBox>ows:UpperCorner"`
+}
+
+type wfsCapabilities struct {
+	XMLName      xml.Name         `xml:"wfs:WFS_Capabilities"`
+	XMLNSWFS     string           `xml:"xmlns:wfs,attr"`
+	XMLNSOWS     string           `xml:"xmlns:ows,attr"`
+	XMLNSXLink   string           `xml:"xmlns:xlink,attr"`
+	Version      string           `xml:"version,attr"`
+	Title        string           `xml:"ows:ServiceIdentification>ows:Title"`
+	ServiceType  string           `xml:"ows:ServiceIdentification>ows:ServiceType"`
+	TypeVersion  string           `xml:"ows:ServiceIdentification>ows:ServiceTypeVersion"`
+	Operations   []owsOperation   `xml:"ows:OperationsMetadata>ows:Operation"`
+	FeatureTypes []wfsFeatureType `xml:"wfs:FeatureTypeList>wfs:FeatureType"`
+}
+
+// WFSHandler is a WFS 2.0 adapter over discovery, for GIS clients
+// that do not speak OGC API - Features. It supports GetCapabilities and
+// GetFeature with GeoJSON output; only the first page of results is
+// available.
+// @Title ogcWFSHandler
+// @Description a WFS 2.0 GetCapabilities and GetFeature adapter over discovery
+// @Param   X-Planet-Key    header  string  false        "Planet Labs API Key, unless the broker holds the key"
+// @Param   PL_API_KEY      query   string  false        "Planet Labs API Key (deprecated)"
+// @Param   request         query   string  true         "GetCapabilities or GetFeature"
+// @Param   typeNames       query   string  false        "The item type, for GetFeature"
+// @Param   bbox            query   string  false        "The bounding box, with an optional CRS"
+// @Param   count           query   number  false        "The maximum number of features (default 10)"
+// @Failure 400 {object}  string
+// @Router /ogc/wfs [get]
+type WFSHandler struct {
+	Context planet.Context
+}
+
+// NewWFSHandler creates a new handler using the current
+// planet Settings
+func NewWFSHandler() WFSHandler {
+	return WFSHandler{Context: planet.NewContext()}
+}
+
+// ServeHTTP implements the http.Handler interface for the WFSHandler type
+func (h WFSHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method, Actee: request.URL.String(), Message: "Receiving /ogc/wfs request", Severity: util.INFO})
+
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+
+	params := make(map[string]string)
+	for key, values := range request.URL.Query() {
+		params[strings.ToLower(key)] = values[0]
+	}
+	if service := params["service"]; service != "" && !strings.EqualFold(service, "WFS") {
+		writeWFSException(writer, wfsException{code: "InvalidParameterValue", locator: "service", message: "Only the WFS service is supported"})
+		return
+	}
+
+	switch strings.ToLower(params["request"]) {
+	case "getcapabilities":
+		h.getCapabilities(writer, request)
+	case "getfeature":
+		if err := h.Context.SetPlanetKey(writer, request); err != nil {
+			herr := err.(util.HTTPErr)
+			util.LogSimpleErr(&h.Context, herr.Message, nil)
+			writeWFSException(writer, wfsException{code: "MissingParameterValue", locator: planet.PlanetKeyHeader, message: herr.Message, status: herr.Status})
+			return
+		}
+		h.getFeature(writer, request, params)
+	case "":
+		writeWFSException(writer, wfsException{code: "MissingParameterValue", locator: "request", message: "A request parameter is required"})
+	default:
+		writeWFSException(writer, wfsException{code: "OperationNotSupported", locator: "request", message: fmt.Sprintf("The %v request is not supported", params["request"])})
+	}
+}
+
+func (h WFSHandler) getCapabilities(writer http.ResponseWriter, request *http.Request) {
+	baseURL := util.BaseURL(request)
+	href := wfsHref(request)
+	capabilities := wfsCapabilities{
+		XMLNSWFS:    "http://www.opengis.net/wfs/2.0",
+		XMLNSOWS:    "http://www.opengis.net/ows/1.1",
+		XMLNSXLink:  "http://www.w3.org/1999/xlink",
+		Version:     wfsVersion,
+		Title:       "Beachfront Image Archive Broker",
+		ServiceType: "WFS",
+		TypeVersion: wfsVersion,
+		Operations: []owsOperation{
+			{Name: "GetCapabilities", Get: owsLink{Href: href}},
+			{Name: "GetFeature", Get: owsLink{Href: href}, Parameters: []owsParameter{{Name: "outputFormat", Values: []string{"application/json"}}}},
+		},
+	}
+	for _, collection := range stac.Collections(baseURL) {
+		capabilities.FeatureTypes = append(capabilities.FeatureTypes, wfsFeatureType{
+			Name:        collection.ID,
+			Title:       collection.Title,
+			Abstract:    collection.Description,
+			DefaultCRS:  "urn:ogc:def:crs:OGC:1.3:CRS84",
+			LowerCorner: "-180 -90",
+			UpperCorner: "180 90",
+		})
+	}
+	bytes, _ := xml.Marshal(capabilities)
+	writer.Header().Set("Content-Type", xmlMediaType)
+	writer.Write([]byte(xml.Header))
+	writer.Write(bytes)
+}
+
+func (h WFSHandler) getFeature(writer http.ResponseWriter, request *http.Request, params map[string]string) {
+	var (
+		options planet.SearchOptions
+		fc      *geojson.FeatureCollection
+		err     error
+	)
+	if options, err = getFeatureOptions(params); err != nil {
+		util.LogSimpleErr(&h.Context, err.Error(), nil)
+		writeWFSException(writer, err.(wfsException))
+		return
+	}
+	if fc, _, err = planet.SearchScenes(request.Context(), options, &h.Context); err != nil {
+		writeSearchError(request, writer, &h.Context, err)
+		return
+	}
+	writer.Header().Set("Content-Type", geoJSONMediaType)
+	util.PrintJSON(writer, newFeatureCollection(fc), http.StatusOK)
+	util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method + " response", Actee: request.URL.String(), Message: "Sending /ogc/wfs response", Severity: util.INFO})
+}
+
+// getFeatureOptions translates GetFeature parameters into search options
+func getFeatureOptions(params map[string]string) (planet.SearchOptions, error) {
+	var (
+		result planet.SearchOptions
+		err    error
+	)
+	result.ItemType = params["typenames"]
+	if result.ItemType == "" {
+		result.ItemType = params["typename"]
+	}
+	if _, found := stac.FindCollection(result.ItemType, ""); !found {
+		return result, wfsException{code: "InvalidParameterValue", locator: "typeNames", message: fmt.Sprintf("The type name %v is invalid", result.ItemType)}
+	}
+	if !wfsOutputFormats[strings.ToLower(params["outputformat"])] {
+		return result, wfsException{code: "InvalidParameterValue", locator: "outputFormat", message: "Only GeoJSON output is supported"}
+	}
+	if startIndex := params["startindex"]; startIndex != "" && startIndex != "0" {
+		return result, wfsException{code: "InvalidParameterValue", locator: "startIndex", message: "Only the first page of results is available"}
+	}
+
+	count := params["count"]
+	if count == "" {
+		count = params["maxfeatures"]
+	}
+	if result.PageSize, err = parseLimit(count); err != nil {
+		return result, wfsException{code: "InvalidParameterValue", locator: "count", message: err.Error()}
+	}
+	if result.Bbox, err = parseWFSBbox(params["bbox"]); err != nil {
+		return result, wfsException{code: "InvalidParameterValue", locator: "bbox", message: err.Error()}
+	}
+	return result, nil
+}
+
+// parseWFSBbox reads a WFS bbox: four coordinates and an optional CRS.
+// EPSG:4326 given as a URN or URI has latitude first; otherwise
+// longitude comes first, as in CRS84.
+func parseWFSBbox(bboxStr string) (geojson.BoundingBox, error) {
+	var result geojson.BoundingBox
+	if bboxStr == "" {
+		return result, nil
+	}
+	parts := strings.Split(bboxStr, ",")
+	crs := ""
+	if len(parts) == 5 {
+		crs = parts[4]
+		parts = parts[:4]
+	}
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("The bbox value of %v is invalid", bboxStr)
+	}
+	for _, coordStr := range parts {
+		coord, err := strconv.ParseFloat(coordStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("The bbox value of %v is invalid", bboxStr)
+		}
+		result = append(result, coord)
+	}
+	switch crs {
+	case "", "EPSG:4326", "urn:ogc:def:crs:OGC:1.3:CRS84", crs84:
+		return result, nil
+	case "urn:ogc:def:crs:EPSG::4326", "http://www.opengis.net/def/crs/EPSG/0/4326":
+		return geojson.BoundingBox{result[1], result[0], result[3], result[2]}, nil
+	default:
+		return nil, fmt.Errorf("The bbox CRS %v is not supported", crs)
+	}
+}
+
+// wfsHref is the URL for further WFS requests, which keeps any
+// parameters that are not part of WFS, except the API key
+func wfsHref(request *http.Request) string {
+	query := url.Values{}
+	for key, values := range request.URL.Query() {
+		if !wfsParameters[strings.ToLower(key)] && key != planet.PlanetKeyParameter {
+			query[key] = values
+		}
+	}
+	result := util.BaseURL(request) + request.URL.Path
+	if len(query) > 0 {
+		result += "?" + query.Encode()
+	}
+	return result
+}
+
+func writeWFSException(writer http.ResponseWriter, exception wfsException) {
+	report := owsExceptionReport{XMLNSOWS: "http://www.opengis.net/ows/1.1", Version: wfsVersion}
+	report.Exception.Code = exception.code
+	report.Exception.Locator = exception.locator
+	report.Exception.Text = exception.message
+	bytes, _ := xml.Marshal(report)
+	if exception.status == 0 {
+		exception.status = http.StatusBadRequest
+	}
+	writer.Header().Set("Content-Type", xmlMediaType)
+	writer.WriteHeader(exception.status)
+	writer.Write([]byte(xml.Header))
+	writer.Write(bytes)
+}
@@ -0,0 +1,87 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWFSGetCapabilities(t *testing.T) {
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "http://broker.example.com/ogc/wfs?SERVICE=WFS&REQUEST=GetCapabilities&PL_API_KEY="+testingKey, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, "<wfs:WFS_Capabilities")
+	assert.Contains(t, body, "<wfs:Name>Landsat8L1G</wfs:Name>")
+	assert.Contains(t, body, `xlink:href="http://broker.example.com/ogc/wfs"`)
+	assert.NotContains(t, body, testingKey, "Expected the API key to be left out of links")
+}
+
+func TestWFSGetFeature(t *testing.T) {
+	var result featureCollection
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	url := "/ogc/wfs?service=WFS&version=2.0.0&request=GetFeature&typeNames=REOrthoTile&count=20&outputFormat=application/json&PL_API_KEY=" + testingKey +
+		"&bbox=-5,-10,5,10,urn:ogc:def:crs:EPSG::4326"
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code, "Expected GetFeature to succeed but received: %v", recorder.Body.String())
+	assert.Equal(t, "20", planetServer.LastRequest().FormValue("_page_size"))
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.NumberReturned)
+	assert.Nil(t, result.Links)
+}
+
+func TestWFSBbox(t *testing.T) {
+	bbox, err := parseWFSBbox("1,2,3,4")
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{1, 2, 3, 4}, []float64(bbox))
+
+	bbox, err = parseWFSBbox("1,2,3,4,urn:ogc:def:crs:EPSG::4326")
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{2, 1, 4, 3}, []float64(bbox))
+
+	_, err = parseWFSBbox("1,2,3,4,EPSG:3857")
+	assert.NotNil(t, err)
+}
+
+func TestWFSExceptions(t *testing.T) {
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	tests := map[string]string{
+		"request=GetFeature&typeNames=REOrthoTile":                                            "MissingParameterValue",
+		"service=WMS&request=GetCapabilities":                                                 "InvalidParameterValue",
+		"request=DescribeFeatureType&PL_API_KEY=" + testingKey:                                "OperationNotSupported",
+		"request=GetFeature&typeNames=nothing&PL_API_KEY=" + testingKey:                       "InvalidParameterValue",
+		"request=GetFeature&typeNames=REOrthoTile&outputFormat=GML3&PL_API_KEY=" + testingKey: "InvalidParameterValue",
+		"request=GetFeature&typeNames=REOrthoTile&startIndex=10&PL_API_KEY=" + testingKey:     "InvalidParameterValue",
+		"": "MissingParameterValue",
+	}
+	for query, code := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/ogc/wfs?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `exceptionCode="`+code+`"`, "Unexpected exception for %v", query)
+	}
+}
@@ -15,6 +15,7 @@
 package planet
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"time"
@@ -31,7 +32,7 @@ type BestSceneInput struct {
 }
 
 // BestScene returns the best scene based on age, cloud cover, and tides
-func BestScene(options SearchOptions, context *Context) (string, error) {
+func BestScene(ctx context.Context, options SearchOptions, context *Context) (string, error) {
 	var (
 		result    string
 		err       error
@@ -39,7 +40,7 @@ func BestScene(options SearchOptions, context *Context) (string, error) {
 		bestScore float64
 		currScore float64
 	)
-	if scenes, err = GetScenes(options, context); err != nil {
+	if scenes, err = GetScenes(ctx, options, context); err != nil {
 		return result, err
 	}
 	for _, scene := range scenes.Features {
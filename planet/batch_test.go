@@ -15,6 +15,7 @@
 package planet
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -25,6 +26,7 @@ import (
 
 func TestBestScene(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 	options := SearchOptions{ItemType: "REOrthoTile"}
 
@@ -32,7 +34,7 @@ func TestBestScene(t *testing.T) {
 	point := geojson.NewPoint(coordinates)
 	options.Bbox = point.ForceBbox()
 
-	best, err := BestScene(options, &context)
+	best, err := BestScene(ctx, options, &context)
 	assert.Nil(t, err, "Retrieving best scene failed with %v", err)
 	if err == nil {
 		util.LogInfo(&context, fmt.Sprintf("Found best scene: %v", best))
@@ -0,0 +1,159 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planet
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/cache"
+	"github.com/venicegeo/dg-bf-ia-broker/metrics"
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// Defaults for the cache of Planet Labs responses
+const (
+	DefaultCacheSize     = 500
+	DefaultCacheTTL      = 60 * time.Second
+	DefaultAssetCacheTTL = 10 * time.Second
+)
+
+// CacheSettings controls the caching of Planet Labs responses.
+// Asset status changes during activation, so it gets its own, shorter TTL.
+type CacheSettings struct {
+	Cache    cache.Cache // if nil, nothing is cached
+	TTL      time.Duration
+	AssetTTL time.Duration
+}
+
+var (
+	defaultCaching     CacheSettings
+	defaultCachingOnce sync.Once
+)
+
+// defaultCacheSettings returns the cache used until Configure is called,
+// created the first time it is needed
+func defaultCacheSettings() CacheSettings {
+	defaultCachingOnce.Do(func() {
+		defaultCaching = NewCacheSettings(DefaultCacheSize, DefaultCacheTTL, DefaultAssetCacheTTL)
+	})
+	return defaultCaching
+}
+
+// NewCacheSettings creates a cache of the given number of entries; zero
+// disables caching, leaving Cache nil
+func NewCacheSettings(size int, ttl, assetTTL time.Duration) CacheSettings {
+	if size <= 0 {
+		util.LogInfo(&util.BasicLogContext{}, "Planet Labs response caching is disabled")
+		return CacheSettings{TTL: ttl, AssetTTL: assetTTL}
+	}
+	return CacheSettings{Cache: cache.NewLRU(size), TTL: ttl, AssetTTL: assetTTL}
+}
+
+// The cache's counts start again when a new cache replaces it, which
+// Prometheus treats as a counter reset. Without a cache they are all zero.
+func init() {
+	metrics.NewCounterFunc("bf_planet_cache_hits_total", "Planet Labs responses found in the cache.", func() float64 {
+		return float64(CacheStats().Hits)
+	})
+	metrics.NewCounterFunc("bf_planet_cache_misses_total", "Planet Labs responses not found in the cache.", func() float64 {
+		return float64(CacheStats().Misses)
+	})
+	metrics.NewGaugeFunc("bf_planet_cache_hit_ratio", "Fraction of cache lookups that were hits.", func() float64 {
+		return CacheStats().HitRatio()
+	})
+	metrics.NewGaugeFunc("bf_planet_cache_entries", "Planet Labs responses in the cache.", func() float64 {
+		return float64(CacheStats().Entries)
+	})
+}
+
+// CacheStats returns the usage counts of the shared cache, which are zero
+// when caching is disabled
+func CacheStats() cache.Stats {
+	caching := currentCaching()
+	if caching.Cache == nil {
+		return cache.Stats{}
+	}
+	return caching.Cache.Stats()
+}
+
+// cacheKey builds a key from the kind of request, the Planet Labs instance
+// and API key that made it (hashed, so that users never see each other's
+// results), and the options
+func cacheKey(kind string, context *Context, options interface{}) string {
+	bytes, _ := json.Marshal(options)
+	return kind + ":" + context.BasePlanetURL + ":" + cache.HashSecret(context.PlanetKey) + ":" + string(bytes)
+}
+
+// assetCacheKey is the key for the status of an item's analytic asset
+func assetCacheKey(context *Context, options MetadataOptions) string {
+	return cacheKey("asset", context, options.ItemType+"/"+options.ID)
+}
+
+// normalizeSearchOptions puts equivalent searches into the same form.
+// Pages are cached as Planet Labs sent them, before tides are added,
+// so searches with and without tides share them.
+func normalizeSearchOptions(options SearchOptions) SearchOptions {
+	options.Tides = false
+	options.AcquiredDate = normalizeDate(options.AcquiredDate)
+	options.MaxAcquiredDate = normalizeDate(options.MaxAcquiredDate)
+	return options
+}
+
+func normalizeDate(date string) string {
+	if parsed, err := time.Parse(time.RFC3339, date); err == nil {
+		return parsed.UTC().Format(time.RFC3339Nano)
+	}
+	return date
+}
+
+// cacheGet looks a response up, noting whether it was found on the span
+// in ctx
+func (c *Context) cacheGet(ctx context.Context, key string) ([]byte, bool) {
+	if c.Caching.Cache == nil {
+		return nil, false
+	}
+	value, ok := c.Caching.Cache.Get(key)
+	trace.FromContext(ctx).SetAttribute("cache_hit", ok)
+	return value, ok
+}
+
+func (c *Context) cacheSet(key string, value interface{}, ttl time.Duration) {
+	if c.Caching.Cache == nil {
+		return
+	}
+	if bytes, err := json.Marshal(value); err == nil {
+		c.Caching.Cache.Set(key, bytes, ttl)
+	}
+}
+
+// cacheDelete removes a response that is no longer current
+func (c *Context) cacheDelete(key string) {
+	if c.Caching.Cache == nil {
+		return
+	}
+	c.Caching.Cache.Delete(key)
+}
+
+// cacheSetBytes caches a response as it is
+func (c *Context) cacheSetBytes(key string, value []byte, ttl time.Duration) {
+	if c.Caching.Cache == nil {
+		return
+	}
+	c.Caching.Cache.Set(key, value, ttl)
+}
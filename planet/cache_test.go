@@ -0,0 +1,129 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/cache"
+)
+
+func TestGetScenesCached(t *testing.T) {
+	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
+	context := makeTestingContext(planetServer, tidesServer)
+	lru := cache.NewLRU(10)
+	context.Caching = CacheSettings{Cache: lru, TTL: time.Minute}
+
+	options := SearchOptions{ItemType: "REOrthoTile", AcquiredDate: "2016-01-01T00:00:00Z"}
+	first, err := GetScenes(ctx, options, &context)
+	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
+
+	options.AcquiredDate = "2016-01-01T00:00:00+00:00"
+	second, err := GetScenes(ctx, options, &context)
+	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
+	assert.Equal(t, uint64(1), lru.Stats().Hits, "Expected an equivalent search to hit the cache")
+	assert.Equal(t, len(first.Features), len(second.Features))
+	assert.Equal(t, first.Features[0].IDStr(), second.Features[0].IDStr())
+
+	context.PlanetKey = testingInvalidKey
+	_, err = GetScenes(ctx, options, &context)
+	assert.NotNil(t, err, "Expected a different API key not to share cached results")
+}
+
+func TestGetScenesCachesPlanetPage(t *testing.T) {
+	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
+	context := makeTestingContext(planetServer, tidesServer)
+	lru := cache.NewLRU(10)
+	context.Caching = CacheSettings{Cache: lru, TTL: time.Minute}
+
+	options := SearchOptions{ItemType: "REOrthoTile"}
+	_, err := GetScenes(ctx, options, &context)
+	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
+	cached, ok := lru.Get(cacheKey("scenes", &context, normalizeSearchOptions(options)))
+	if assert.True(t, ok, "Expected the page to be cached") {
+		assert.Contains(t, string(cached), "_permissions", "Expected the page to be cached as Planet Labs sent it")
+	}
+
+	hits := lru.Stats().Hits
+	options.Tides = true
+	withTides, err := GetScenes(ctx, options, &context)
+	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
+	assert.Equal(t, hits+1, lru.Stats().Hits, "Expected a search for tides to share the cached page")
+	if assert.NotEmpty(t, withTides.Features) {
+		assert.NotNil(t, withTides.Features[0].Properties["CurrentTide"], "Expected tides for a cached page")
+	}
+}
+
+func TestGetMetadataAndAssetCached(t *testing.T) {
+	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
+	context := makeTestingContext(planetServer, tidesServer)
+	lru := cache.NewLRU(10)
+	context.Caching = CacheSettings{Cache: lru, TTL: time.Minute, AssetTTL: 0}
+
+	options := MetadataOptions{ID: testingValidItemID, ItemType: "REOrthoTile"}
+	for inx := 0; inx < 2; inx++ {
+		feature, err := GetMetadata(ctx, options, &context)
+		assert.Nil(t, err, "Failed to get metadata; received: %v", err)
+		assert.Equal(t, testingValidItemID, feature.IDStr())
+		_, err = GetAsset(ctx, options, &context)
+		assert.Nil(t, err, "Failed to get asset; received: %v", err)
+	}
+	stats := lru.Stats()
+	assert.Equal(t, uint64(1), stats.Hits, "Expected only the metadata to be cached")
+	assert.Equal(t, 1, stats.Entries)
+}
+
+func TestActivateClearsCachedAsset(t *testing.T) {
+	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
+	context := makeTestingContext(planetServer, tidesServer)
+	lru := cache.NewLRU(10)
+	context.Caching = CacheSettings{Cache: lru, TTL: time.Minute, AssetTTL: time.Minute}
+
+	options := MetadataOptions{ID: testingValidItemID, ItemType: "REOrthoTile"}
+	_, err := GetAsset(ctx, options, &context)
+	assert.Nil(t, err, "Failed to get asset; received: %v", err)
+	_, ok := lru.Get(assetCacheKey(&context, options))
+	assert.True(t, ok, "Expected the asset to be cached")
+
+	response, err := Activate(ctx, options, &context)
+	if assert.Nil(t, err, "Failed to activate; received: %v", err) {
+		response.Body.Close()
+	}
+	_, ok = lru.Get(assetCacheKey(&context, options))
+	assert.False(t, ok, "Expected activation to clear the cached asset")
+}
+
+func TestCacheDisabled(t *testing.T) {
+	defer Configure(DefaultSettings())
+	settings := DefaultSettings()
+	settings.Caching = NewCacheSettings(0, time.Minute, time.Minute)
+	assert.Nil(t, settings.Caching.Cache, "Expected no cache when caching is disabled")
+	Configure(settings)
+	assert.Equal(t, cache.Stats{}, CacheStats())
+
+	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
+	context := makeTestingContext(planetServer, tidesServer)
+	context.Caching = settings.Caching
+	_, err := GetScenes(ctx, SearchOptions{ItemType: "REOrthoTile"}, &context)
+	assert.Nil(t, err, "Expected request to succeed without a cache; received: %v", err)
+}
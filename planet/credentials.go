@@ -0,0 +1,147 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planet
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/venicegeo/dg-bf-ia-broker/auth"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+const (
+	// PlanetKeyHeader is the header that carries a client's Planet Labs key
+	PlanetKeyHeader = "X-Planet-Key"
+	// PlanetKeyParameter is the deprecated query parameter for a client's Planet Labs key
+	PlanetKeyParameter = "PL_API_KEY"
+
+	queryKeyDeprecated = `299 - "The PL_API_KEY parameter is deprecated; use the X-Planet-Key header"`
+	queryKeyDisabled   = "Passing the Planet Labs key as PL_API_KEY is disabled; use the X-Planet-Key header."
+	invalidClientToken = "This operation requires a valid broker token."
+)
+
+// CredentialSettings decide where the Planet Labs key for a request
+// comes from. Normally each client supplies its own key. In server-side
+// mode, when ServerKey is set, the broker uses its own key for everyone
+// and clients authenticate to the broker with a bearer token instead.
+type CredentialSettings struct {
+	ServerKey     string
+	ClientTokens  []string
+	AllowQueryKey bool // the deprecated PL_API_KEY query parameter
+}
+
+// register keeps the credentials out of the logs
+func (c CredentialSettings) register() {
+	util.AddSecret(c.ServerKey)
+	for _, token := range c.ClientTokens {
+		util.AddSecret(token)
+	}
+	if c.ServerKey != "" && len(c.ClientTokens) == 0 {
+		util.LogAlert(&util.BasicLogContext{}, "A server Planet Labs key is set but no client tokens are; only users authenticated through BF_AUTH_CONFIG can use it.")
+	}
+}
+
+// SetPlanetKey sets the Planet Labs key for a request: for a user
+// authenticated by the broker, the key mapped to them; the server-side key
+// for an authenticated client; otherwise the X-Planet-Key or Authorization
+// header or, if still allowed, the PL_API_KEY parameter. Any error is a
+// util.HTTPErr.
+func (c *Context) SetPlanetKey(writer http.ResponseWriter, request *http.Request) error {
+	settings := c.Credentials
+	if principal, ok := auth.FromRequest(request); ok {
+		// The user has authenticated to the broker; a key mapped to them
+		// or the server-side key, in that order, replaces their own
+		if c.PlanetKey = principal.PlanetKey; c.PlanetKey == "" {
+			c.PlanetKey = settings.ServerKey
+		}
+		if c.PlanetKey != "" {
+			return nil
+		}
+	} else if settings.ServerKey != "" {
+		if !settings.validClientToken(request.Header.Get("Authorization")) {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="bf-ia-broker"`)
+			return util.HTTPErr{Status: http.StatusUnauthorized, Message: invalidClientToken}
+		}
+		c.PlanetKey = settings.ServerKey
+		return nil
+	}
+
+	if c.PlanetKey = request.Header.Get(PlanetKeyHeader); c.PlanetKey != "" {
+		return nil
+	}
+	if c.PlanetKey = keyFromAuthorization(request.Header.Get("Authorization")); c.PlanetKey != "" {
+		return nil
+	}
+	if key := request.FormValue(PlanetKeyParameter); key != "" {
+		if !settings.AllowQueryKey {
+			return util.HTTPErr{Status: http.StatusBadRequest, Message: queryKeyDisabled}
+		}
+		writer.Header().Add("Warning", queryKeyDeprecated)
+		c.PlanetKey = key
+		return nil
+	}
+	return util.HTTPErr{Status: http.StatusBadRequest, Message: noPlanetKey}
+}
+
+// keyFromAuthorization reads a Planet Labs key from an Authorization header,
+// in either of the forms Planet Labs accepts: "api-key KEY", or Basic
+// authentication with the key as the user name
+func keyFromAuthorization(authorization string) string {
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	switch strings.ToLower(parts[0]) {
+	case "api-key":
+		return strings.TrimSpace(parts[1])
+	case "basic":
+		bytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return ""
+		}
+		return strings.SplitN(string(bytes), ":", 2)[0]
+	}
+	return ""
+}
+
+// validClientToken checks a bearer token against the configured client tokens
+func (s CredentialSettings) validClientToken(authorization string) bool {
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return false
+	}
+	token := []byte(strings.TrimSpace(parts[1]))
+	for _, clientToken := range s.ClientTokens {
+		if subtle.ConstantTimeCompare(token, []byte(clientToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkURL returns the absolute URL of the request for links in the response,
+// without the PL_API_KEY parameter so that a client's key is never echoed
+func LinkURL(request *http.Request) *url.URL {
+	result, _ := url.Parse(util.BaseURL(request) + request.URL.RequestURI())
+	if query := result.Query(); query[PlanetKeyParameter] != nil {
+		query.Del(PlanetKeyParameter)
+		result.RawQuery = query.Encode()
+	}
+	return result
+}
@@ -0,0 +1,165 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planet
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/auth"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+func TestSetPlanetKeyClient(t *testing.T) {
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte(testingValidKey+":"))
+	tests := []struct {
+		header string
+		value  string
+	}{
+		{"X-Planet-Key", testingValidKey},
+		{"Authorization", "api-key " + testingValidKey},
+		{"Authorization", basic},
+	}
+	for _, test := range tests {
+		context := Context{Credentials: CredentialSettings{}}
+		request := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+		request.Header.Set(test.header, test.value)
+		recorder := httptest.NewRecorder()
+		assert.Nil(t, context.SetPlanetKey(recorder, request))
+		assert.Equal(t, testingValidKey, context.PlanetKey, "Expected the key from %v: %v", test.header, test.value)
+		assert.Empty(t, recorder.Header().Get("Warning"))
+	}
+
+	context := Context{}
+	err := context.SetPlanetKey(httptest.NewRecorder(), httptest.NewRequest("GET", "/planet/discover/rapideye", nil))
+	assert.Equal(t, http.StatusBadRequest, err.(util.HTTPErr).Status)
+}
+
+func TestSetPlanetKeyQuery(t *testing.T) {
+	request := httptest.NewRequest("GET", "/planet/discover/rapideye?PL_API_KEY="+testingValidKey, nil)
+
+	context := Context{Credentials: CredentialSettings{AllowQueryKey: true}}
+	recorder := httptest.NewRecorder()
+	assert.Nil(t, context.SetPlanetKey(recorder, request))
+	assert.Equal(t, testingValidKey, context.PlanetKey)
+	assert.Contains(t, recorder.Header().Get("Warning"), "deprecated")
+
+	context = Context{Credentials: CredentialSettings{AllowQueryKey: false}}
+	err := context.SetPlanetKey(httptest.NewRecorder(), request)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(util.HTTPErr).Status)
+	}
+	assert.Empty(t, context.PlanetKey)
+}
+
+func TestSetPlanetKeyServer(t *testing.T) {
+	context := Context{Credentials: CredentialSettings{ServerKey: testingValidKey, ClientTokens: []string{"token1", "token2"}}}
+
+	request := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+	request.Header.Set("Authorization", "Bearer token2")
+	assert.Nil(t, context.SetPlanetKey(httptest.NewRecorder(), request))
+	assert.Equal(t, testingValidKey, context.PlanetKey)
+
+	// A client's own key is no substitute for a broker token
+	for _, authorization := range []string{"", "Bearer token3", "api-key " + testingValidKey} {
+		context.PlanetKey = ""
+		request = httptest.NewRequest("GET", "/planet/discover/rapideye?PL_API_KEY="+testingValidKey, nil)
+		request.Header.Set("Authorization", authorization)
+		recorder := httptest.NewRecorder()
+		err := context.SetPlanetKey(recorder, request)
+		if assert.NotNil(t, err, "Expected %v to be refused", authorization) {
+			assert.Equal(t, http.StatusUnauthorized, err.(util.HTTPErr).Status)
+		}
+		assert.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+		assert.Empty(t, context.PlanetKey)
+	}
+}
+
+func TestSetPlanetKeyPrincipal(t *testing.T) {
+	authenticator, _ := auth.New(auth.Config{
+		Tokens: []auth.StaticToken{
+			{Token: "mapped-token", User: "alice", Roles: []string{auth.RoleRead}},
+			{Token: "unmapped-token", User: "bob", Roles: []string{auth.RoleRead}},
+		},
+		PlanetKeys: auth.PlanetKeys{Users: map[string]string{"alice": "ALICE_KEY"}},
+	})
+	tests := []struct {
+		token     string
+		serverKey string
+		clientKey string
+		expected  string
+	}{
+		{"mapped-token", "SERVER_KEY", testingValidKey, "ALICE_KEY"},
+		{"unmapped-token", "SERVER_KEY", testingValidKey, "SERVER_KEY"},
+		{"unmapped-token", "", testingValidKey, testingValidKey},
+		{"unmapped-token", "", "", ""},
+	}
+	for _, test := range tests {
+		var err error
+		context := Context{Credentials: CredentialSettings{ServerKey: test.serverKey}}
+		handler := authenticator.Require(auth.RoleRead, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			err = context.SetPlanetKey(writer, request)
+		}))
+		request := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+		request.Header.Set("Authorization", "Bearer "+test.token)
+		request.Header.Set(PlanetKeyHeader, test.clientKey)
+
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+		assert.Equal(t, test.expected, context.PlanetKey, "Unexpected key for %v", test)
+		assert.Equal(t, test.expected == "", err != nil)
+	}
+}
+
+func TestDiscoverHandlerKeyHeader(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	request := httptest.NewRequest("GET", makeDiscoverTestingURL(mockServer.URL, ""), nil)
+	request.Header.Set(PlanetKeyHeader, testingValidKey)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code,
+		"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	assert.NotContains(t, recorder.Header().Get("Link"), testingValidKey)
+}
+
+func TestHandlersDoNotLogKeys(t *testing.T) {
+	var output []string
+	oldFunc := util.SetLogFunc(func(message string) { output = append(output, message) })
+	defer util.SetLogFunc(oldFunc)
+
+	mockServer, _, router := createTestFixtures()
+	requests := []*http.Request{
+		httptest.NewRequest("GET", makeDiscoverTestingURL(mockServer.URL, testingValidKey), nil),
+		httptest.NewRequest("GET", makeMetadataTestingURL(mockServer.URL, testingValidKey, "rapideye", testingValidItemID), nil),
+		httptest.NewRequest("POST", makeActivateTestingURL(mockServer.URL, testingValidKey, "rapideye", testingValidItemID), nil),
+		httptest.NewRequest("GET", makeMetadataTestingURL(mockServer.URL, "", "rapideye", testingValidItemID), nil),
+	}
+	requests[3].Header.Set(PlanetKeyHeader, testingValidKey)
+	for _, request := range requests {
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	basic := base64.StdEncoding.EncodeToString([]byte(testingValidKey + ":"))
+	assert.NotEmpty(t, output)
+	for _, message := range output {
+		assert.False(t, strings.Contains(message, testingValidKey) || strings.Contains(message, basic),
+			"Expected no Planet Labs key in the log but received: %v", message)
+	}
+}
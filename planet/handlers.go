@@ -15,13 +15,19 @@
 package planet
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/venicegeo/dg-bf-ia-broker/encoder"
+	"github.com/venicegeo/dg-bf-ia-broker/metrics"
+	"github.com/venicegeo/dg-bf-ia-broker/tides"
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
 	"github.com/venicegeo/dg-bf-ia-broker/util"
 	"github.com/venicegeo/dg-geojson-go/geojson"
 )
@@ -30,17 +36,40 @@ const noPlanetKey = "This operation requires a Planet Labs API key."
 const noPlanetImageID = "This operation requires a Planet Labs image ID."
 const invalidCloudCover = "Cloud Cover value of %v is invalid."
 
+// flushInterval is the number of features streamed between flushes
+const flushInterval = 50
+
+// activations counts activation requests by the item type requested and
+// whether Planet Labs activated, refused or failed to answer them
+var activations = metrics.NewCounter("bf_planet_activations_total", "Activation requests, by item type and outcome.", "item_type", "outcome")
+
+// streamFailures counts discover responses that failed after their status
+// was sent, by the format requested
+var streamFailures = metrics.NewCounter("bf_planet_discover_stream_failures_total", "Discover responses that failed after the status was sent, by format.", "format")
+
 // DiscoverHandler is a handler for /planet/discover
+// Scenes are streamed, so a failure after the first one is written cannot
+// change the 200 status. It is counted, marked on the request span and
+// logged, and the response is cut short: GeoJSON and STAC bodies are left
+// without their closing brackets so that clients fail to parse them
+// rather than take them for a complete page.
 // @Title planetDiscoverHandler
 // @Description discovers scenes from Planet Labs
 // @Accept  plain
-// @Param   PL_API_KEY      query   string  true         "Planet Labs API Key"
+// @Param   X-Planet-Key    header  string  false        "Planet Labs API Key, unless the broker holds the key"
+// @Param   PL_API_KEY      query   string  false        "Planet Labs API Key (deprecated)"
 // @Param   itemType        path    string  true         "Planet Labs Item Type, e.g., rapideye or planetscope"
 // @Param   bbox            query   string  false        "The bounding box, as a GeoJSON Bounding box (x1,y1,x2,y2)"
 // @Param   cloudCover      query   string  false        "The maximum cloud cover, as a percentage (0-100)"
 // @Param   acquiredDate    query   string  false        "The minimum (earliest) acquired date, as RFC 3339"
 // @Param   maxAcquiredDate query   string  false        "The maximum acquired date, as RFC 3339"
 // @Param   tides           query   bool    false        "True: incorporate tide prediction in the output"
+// @Param   minTideFraction query   number  false        "The minimum current tide, as a fraction (0-1) of the 24 hour range"
+// @Param   maxTideFraction query   number  false        "The maximum current tide, as a fraction (0-1) of the 24 hour range"
+// @Param   minTide         query   number  false        "The minimum current tide height"
+// @Param   maxTide         query   number  false        "The maximum current tide height"
+// @Param   page            query   string  false        "A token for a further page of results, from the Link header or the STAC next link"
+// @Param   format          query   string  false        "The output format: geojson (default), geojsonseq, kml, csv, wkt or stac. Overrides the Accept header."
 // @Success 200 {object}  geojson.FeatureCollection
 // @Failure 400 {object}  string
 // @Router /planet/discover/{itemType} [get]
@@ -48,39 +77,51 @@ type DiscoverHandler struct {
 	Context Context
 }
 
-// NewDiscoverHandler creates a new handler using configuration
-// from environment variables
+// NewDiscoverHandler creates a new handler using the current
+// planet Settings
 func NewDiscoverHandler() DiscoverHandler {
-	planetBaseURL := os.Getenv("PL_API_URL")
-	if planetBaseURL == "" {
-		util.LogAlert(&util.BasicLogContext{}, "Didn't get Planet Labs API URL from the environment. Using default.")
-		planetBaseURL = "https://api.planet.com"
-	}
+	return DiscoverHandler{Context: NewContext()}
+}
 
-	tidesURL := os.Getenv("BF_TIDE_PREDICTION_URL")
-	if tidesURL == "" {
-		util.LogAlert(&util.BasicLogContext{}, "Didn't get Tide Prediction URL from the environment. Using default.")
-		tidesURL = "https://bf-tideprediction.int.geointservices.io/tides"
+// NewContext creates a Context using the current Settings
+func NewContext() Context {
+	settings := CurrentSettings()
+	return Context{
+		BasePlanetURL: settings.APIURL,
+		BaseTidesURL:  settings.TidesURL,
+		TideSource:    newTideSource(settings),
+		Caching:       settings.Caching,
+		Credentials:   settings.Credentials,
+		RateLimit:     settings.RateLimit,
 	}
+}
 
-	return DiscoverHandler{
-		Context: Context{
-			BasePlanetURL: planetBaseURL,
-			BaseTidesURL:  tidesURL,
-		},
+// newTideSource creates the tide source named in the settings,
+// falling back to the tide prediction service if that fails
+func newTideSource(settings Settings) tides.TideSource {
+	options := settings.TideOptions
+	options.TidesURL = settings.TidesURL
+	source, err := tides.NewSource(settings.TideSource, options)
+	if err != nil {
+		util.LogAlert(&util.BasicLogContext{}, "Failed to create tide source. Using the tide prediction service. "+err.Error())
+		return &tides.ServiceSource{URL: settings.TidesURL}
 	}
+	return source
 }
 
 // ServeHTTP implements the http.Handler interface for the DiscoverHandler type
 func (h DiscoverHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
 	var (
-		fc         *geojson.FeatureCollection
-		err        error
-		itemType   string
-		bytes      []byte
-		bbox       geojson.BoundingBox
-		ccStr      string
-		cloudCover float64
+		scenes         *Scenes
+		first          *geojson.Feature
+		err            error
+		itemType       string
+		bbox           geojson.BoundingBox
+		ccStr          string
+		cloudCover     float64
+		tideFilter     tides.Filter
+		featureEncoder encoder.FeatureEncoder
 	)
 	util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method, Actee: request.URL.String(), Message: "Receiving /discover request", Severity: util.INFO})
 
@@ -88,14 +129,33 @@ func (h DiscoverHandler) ServeHTTP(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	h.Context.PlanetKey = request.FormValue("PL_API_KEY")
-	if h.Context.PlanetKey == "" {
-		util.LogSimpleErr(&h.Context, noPlanetKey, nil)
-		util.HTTPError(request, writer, &h.Context, noPlanetKey, http.StatusBadRequest)
+	if err = h.Context.SetPlanetKey(writer, request); err != nil {
+		herr := err.(util.HTTPErr)
+		util.LogSimpleErr(&h.Context, herr.Message, nil)
+		util.WriteHTTPErr(request, writer, &h.Context, herr)
 		return
 	}
 
-	tides, _ := strconv.ParseBool(request.FormValue("tides"))
+	// Responses from here on, errors included, depend on the Accept header
+	writer.Header().Set("Vary", "Accept")
+	format, err := encoder.Negotiate(request.FormValue("format"), request.Header.Get("Accept"))
+	if err != nil {
+		util.LogSimpleErr(&h.Context, err.Error(), nil)
+		util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusBadRequest)
+		return
+	}
+	featureEncoder, _ = encoder.NewEncoder(format, writer)
+
+	includeTides, _ := strconv.ParseBool(request.FormValue("tides"))
+
+	if tideFilter, err = parseTideFilter(request); err != nil {
+		util.LogSimpleErr(&h.Context, err.Error(), nil)
+		util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !tideFilter.IsEmpty() {
+		includeTides = true
+	}
 
 	ccStr = request.FormValue("cloudCover")
 	if ccStr != "" {
@@ -142,37 +202,168 @@ func (h DiscoverHandler) ServeHTTP(writer http.ResponseWriter, request *http.Req
 		CloudCover:      cloudCover,
 		AcquiredDate:    request.FormValue("acquiredDate"),
 		MaxAcquiredDate: request.FormValue("maxAcquiredDate"),
-		Tides:           tides,
-		Bbox:            bbox}
+		Tides:           includeTides,
+		Bbox:            bbox,
+		PageToken:       request.FormValue("page")}
 
-	if fc, err = GetScenes(options, &h.Context); err == nil {
-		if bytes, err = geojson.Write(fc); err != nil {
-			err = util.LogSimpleErr(&h.Context, fmt.Sprintf("Failed to write output GeoJSON from:\n%#v", fc), err)
-			util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		writer.Header().Set("Content-Type", "application/json")
-		writer.Write(bytes)
-		util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method + " response", Actee: request.URL.String(), Message: "Sending /discover response", Severity: util.INFO})
+	if scenes, err = OpenScenes(request.Context(), options, &h.Context); err != nil {
+		writeSearchErr(request, writer, &h.Context, err)
+		return
+	}
+	defer scenes.Close()
+
+	// Read a scene before writing anything, so that a failure to read the
+	// page can still be reported properly
+	if first, err = scenes.Read(); err != nil && err != io.EOF {
+		writeSearchErr(request, writer, &h.Context, err)
+		return
+	}
+	links := []encoder.STACLink{{Rel: "self", Href: pageURL(request, options.PageToken), Type: encoder.ContentType(format)}}
+	if scenes.Next != "" {
+		links = append(links, encoder.STACLink{Rel: "next", Href: pageURL(request, scenes.Next), Type: encoder.ContentType(format)})
+		writer.Header().Set("Link", "<"+links[1].Href+">; rel=\"next\"")
+	}
+	if stacEncoder, ok := featureEncoder.(*encoder.STACEncoder); ok {
+		stacEncoder.Collection = itemType
+		stacEncoder.Links = links
+	}
+	writer.Header().Set("Content-Type", encoder.ContentType(format))
+	if err = streamScenes(first, scenes, tideFilter, featureEncoder, writer); err != nil {
+		streamFailures.Inc(format)
+		trace.FromContext(request.Context()).SetError(err)
+		util.LogSimpleErr(&h.Context, "Failed to write output features", err)
+		return
+	}
+	util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method + " response", Actee: request.URL.String(), Message: "Sending /discover response", Severity: util.INFO})
+}
+
+// writeSearchErr responds with a failure to search Planet Labs
+func writeSearchErr(request *http.Request, writer http.ResponseWriter, context *Context, err error) {
+	switch herr := err.(type) {
+	case util.HTTPErr:
+		util.WriteHTTPErr(request, writer, context, herr)
+	default:
+		err = util.LogSimpleErr(context, "Failed to get Planet Labs scenes. ", err)
+		util.HTTPError(request, writer, context, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// pageURL returns the absolute URL of the request with its page replaced
+func pageURL(request *http.Request, page string) string {
+	result := LinkURL(request)
+	query := result.Query()
+	if page == "" {
+		query.Del("page")
 	} else {
-		switch herr := err.(type) {
-		case util.HTTPErr:
-			util.HTTPError(request, writer, &h.Context, herr.Message, herr.Status)
-		default:
-			err = util.LogSimpleErr(&h.Context, "Failed to get Planet Labs scenes. ", err)
-			util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusInternalServerError)
+		query.Set("page", page)
+	}
+	result.RawQuery = query.Encode()
+	return result.String()
+}
+
+// streamScenes encodes the scenes that match the filter to the response as
+// they are read, starting with first (nil if there are none), and flushing
+// as it goes so that large responses are never held in memory.
+// Once the first feature is written the status can no longer change,
+// so on failure the encoder is deliberately not closed: the body is left
+// unterminated, which makes a GeoJSON or STAC response invalid.
+func streamScenes(first *geojson.Feature, scenes *Scenes, filter tides.Filter, featureEncoder encoder.FeatureEncoder, writer http.ResponseWriter) error {
+	var err error
+	flusher, _ := writer.(http.Flusher)
+	count := 0
+	for feature := first; feature != nil; {
+		if filter.Matches(feature) {
+			if err = featureEncoder.Encode(feature); err != nil {
+				return err
+			}
+			count++
+			if flusher != nil && count%flushInterval == 0 {
+				flusher.Flush()
+			}
+		}
+		if feature, err = scenes.Read(); err != nil && err != io.EOF {
+			return err
 		}
 	}
+	return featureEncoder.Close()
+}
+
+// parseTideFilter reads the optional tide stage parameters from the request
+func parseTideFilter(request *http.Request) (tides.Filter, error) {
+	var (
+		result tides.Filter
+		err    error
+	)
+	bounds := map[string]**float64{
+		"minTideFraction": &result.MinFraction,
+		"maxTideFraction": &result.MaxFraction,
+		"minTide":         &result.MinTide,
+		"maxTide":         &result.MaxTide,
+	}
+	for name, bound := range bounds {
+		valueStr := request.FormValue(name)
+		if valueStr == "" {
+			continue
+		}
+		var value float64
+		if value, err = strconv.ParseFloat(valueStr, 64); err != nil {
+			return result, fmt.Errorf("The %v value of %v is invalid", name, valueStr)
+		}
+		*bound = &value
+	}
+	return result, result.Validate()
+}
+
+const (
+	defaultTideWindow   = 24 * time.Hour
+	maxTideWindow       = 7 * 24 * time.Hour
+	defaultTideInterval = 30 * time.Minute
+	maxTideSamples      = 2000
+)
+
+// parseTideSeries reads the optional tide series parameters from the request,
+// returning nil if no series was requested
+func parseTideSeries(request *http.Request) (*tides.SeriesOptions, error) {
+	if series, _ := strconv.ParseBool(request.FormValue("tideSeries")); !series {
+		return nil, nil
+	}
+	result := tides.SeriesOptions{Window: defaultTideWindow, Interval: defaultTideInterval}
+	if windowStr := request.FormValue("tideWindow"); windowStr != "" {
+		hours, err := strconv.ParseFloat(windowStr, 64)
+		if err != nil || hours <= 0 {
+			return nil, fmt.Errorf("The tideWindow value of %v is invalid", windowStr)
+		}
+		result.Window = time.Duration(hours * float64(time.Hour))
+	}
+	if intervalStr := request.FormValue("tideInterval"); intervalStr != "" {
+		minutes, err := strconv.Atoi(intervalStr)
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("The tideInterval value of %v is invalid", intervalStr)
+		}
+		result.Interval = time.Duration(minutes) * time.Minute
+	}
+	if result.Window > maxTideWindow {
+		return nil, fmt.Errorf("The tideWindow may not exceed %v hours", maxTideWindow.Hours())
+	}
+	if result.Window/result.Interval > maxTideSamples {
+		return nil, fmt.Errorf("A tide series may not exceed %v samples", maxTideSamples)
+	}
+	return &result, nil
 }
 
 // MetadataHandler is a handler for /planet
 // @Title planetMetadataHandler
 // @Description Gets image metadata from Planet Labs
 // @Accept  plain
-// @Param   PL_API_KEY      query   string  true         "Planet Labs API Key"
+// @Param   X-Planet-Key    header  string  false        "Planet Labs API Key, unless the broker holds the key"
+// @Param   PL_API_KEY      query   string  false        "Planet Labs API Key (deprecated)"
 // @Param   itemType        path    string  true         "Planet Labs Item Type, e.g., rapideye or planetscope"
 // @Param   id              path    string  true         "Planet Labs image ID"
 // @Param   tides           query   bool    false        "True: incorporate tide prediction in the output"
+// @Param   tideSeries      query   bool    false        "True: incorporate a tide series around the acquired date in the output"
+// @Param   tideWindow      query   number  false        "The length of the tide series in hours, centered on the acquired date (default 24)"
+// @Param   tideInterval    query   number  false        "The time between tide series samples in minutes (default 30)"
+// @Param   format          query   string  false        "The output format: geojson (default), geojsonseq, kml, csv, wkt or stac. Overrides the Accept header."
 // @Success 200 {object}  geojson.Feature
 // @Failure 400 {object}  string
 // @Router /planet/{itemType}/{id} [get]
@@ -180,31 +371,15 @@ type MetadataHandler struct {
 	Context Context
 }
 
-// NewMetadataHandler creates a new handler using configuration
-// from environment variables
+// NewMetadataHandler creates a new handler using the current
+// planet Settings
 func NewMetadataHandler() MetadataHandler {
-	planetBaseURL := os.Getenv("PL_API_URL")
-	if planetBaseURL == "" {
-		util.LogAlert(&util.BasicLogContext{}, "Didn't get Planet Labs API URL from the environment. Using default.")
-		planetBaseURL = "https://api.planet.com"
-	}
-
-	tidesURL := os.Getenv("BF_TIDE_PREDICTION_URL")
-	if tidesURL == "" {
-		util.LogAlert(&util.BasicLogContext{}, "Didn't get Tide Prediction URL from the environment. Using default.")
-		tidesURL = "https://bf-tideprediction.int.geointservices.io/tides"
-	}
-
-	return MetadataHandler{
-		Context: Context{
-			BasePlanetURL: planetBaseURL,
-			BaseTidesURL:  tidesURL,
-		},
-	}
+	return MetadataHandler{Context: NewContext()}
 }
 
 // ServeHTTP implements the http.Handler interface for the MetadataHandler type
 func (h MetadataHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
 	var (
 		err     error
 		feature *geojson.Feature
@@ -227,16 +402,35 @@ func (h MetadataHandler) ServeHTTP(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	h.Context.PlanetKey = request.FormValue("PL_API_KEY")
+	if err = h.Context.SetPlanetKey(writer, request); err != nil {
+		herr := err.(util.HTTPErr)
+		util.LogSimpleErr(&h.Context, herr.Message, nil)
+		util.WriteHTTPErr(request, writer, &h.Context, herr)
+		return
+	}
 
-	if h.Context.PlanetKey == "" {
-		util.LogAlert(&h.Context, noPlanetKey)
-		util.HTTPError(request, writer, &h.Context, noPlanetKey, http.StatusBadRequest)
+	// Responses from here on, errors included, depend on the Accept header
+	writer.Header().Set("Vary", "Accept")
+	format, err := encoder.Negotiate(request.FormValue("format"), request.Header.Get("Accept"))
+	if err != nil {
+		util.LogSimpleErr(&h.Context, err.Error(), nil)
+		util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	options.Tides, _ = strconv.ParseBool(request.FormValue("tides"))
 
+	if options.TideSeries, err = parseTideSeries(request); err != nil {
+		util.LogSimpleErr(&h.Context, err.Error(), nil)
+		util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if options.TideSeries != nil && !tides.CanPredictSeries(h.Context.TideSource) {
+		util.LogSimpleErr(&h.Context, tides.ErrNoSeriesSource.Message, nil)
+		util.WriteHTTPErr(request, writer, &h.Context, tides.ErrNoSeriesSource)
+		return
+	}
+
 	itemType := vars["itemType"]
 	switch itemType {
 	case "REOrthoTile", "rapideye":
@@ -256,22 +450,39 @@ func (h MetadataHandler) ServeHTTP(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	if feature, err = GetMetadata(options, &h.Context); err == nil {
-		if asset, err = GetAsset(options, &h.Context); err == nil {
+	if feature, err = GetMetadata(request.Context(), options, &h.Context); err == nil {
+		if asset, err = GetAsset(request.Context(), options, &h.Context); err == nil {
 			injectAssetIntoMetadata(feature, asset)
-			if bytes, err = geojson.Write(feature); err != nil {
-				err = util.LogSimpleErr(&h.Context, fmt.Sprintf("Failed to write output GeoJSON from:\n%#v", feature), err)
-				util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusInternalServerError)
-				return
+			if format == encoder.STAC {
+				if bytes, err = json.Marshal(encoder.NewSTACItem(feature, options.ItemType)); err != nil {
+					err = util.LogSimpleErr(&h.Context, fmt.Sprintf("Failed to write output STAC Item from:\n%#v", feature), err)
+					util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				writer.Header().Set("Content-Type", encoder.ContentType(format))
+				writer.Write(bytes)
+			} else if format != encoder.GeoJSON {
+				writer.Header().Set("Content-Type", encoder.ContentType(format))
+				featureEncoder, _ := encoder.NewEncoder(format, writer)
+				if err = encoder.EncodeFeatureCollection(featureEncoder, geojson.NewFeatureCollection([]*geojson.Feature{feature})); err != nil {
+					util.LogSimpleErr(&h.Context, "Failed to write output "+format, err)
+					return
+				}
+			} else {
+				if bytes, err = geojson.Write(feature); err != nil {
+					err = util.LogSimpleErr(&h.Context, fmt.Sprintf("Failed to write output GeoJSON from:\n%#v", feature), err)
+					util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				writer.Header().Set("Content-Type", "application/json")
+				writer.Write(bytes)
 			}
-			writer.Header().Set("Content-Type", "application/json")
-			writer.Write(bytes)
 
 			util.LogAudit(&h.Context, util.LogAuditInput{Actor: request.URL.String(), Action: request.Method + " response", Actee: "anon user", Message: "Sending planet/{itemType}/{id} response", Severity: util.INFO})
 		} else {
 			switch herr := err.(type) {
 			case util.HTTPErr:
-				util.HTTPError(request, writer, &h.Context, herr.Message, herr.Status)
+				util.WriteHTTPErr(request, writer, &h.Context, herr)
 			default:
 				err = util.LogSimpleErr(&h.Context, "Failed to get Planet Labs asset information. ", err)
 				util.HTTPError(request, writer, &h.Context, err.Error(), 0)
@@ -280,7 +491,7 @@ func (h MetadataHandler) ServeHTTP(writer http.ResponseWriter, request *http.Req
 	} else {
 		switch herr := err.(type) {
 		case util.HTTPErr:
-			util.HTTPError(request, writer, &h.Context, herr.Message, herr.Status)
+			util.WriteHTTPErr(request, writer, &h.Context, herr)
 		default:
 			err = util.LogSimpleErr(&h.Context, "Failed to get Planet Labs scene metadata. ", err)
 			util.HTTPError(request, writer, &h.Context, err.Error(), 0)
@@ -292,7 +503,8 @@ func (h MetadataHandler) ServeHTTP(writer http.ResponseWriter, request *http.Req
 // @Title planetActivateHandler
 // @Description Activates a scene
 // @Accept  plain
-// @Param   PL_API_KEY      query   string  true         "Planet Labs API Key"
+// @Param   X-Planet-Key    header  string  false        "Planet Labs API Key, unless the broker holds the key"
+// @Param   PL_API_KEY      query   string  false        "Planet Labs API Key (deprecated)"
 // @Param   itemType        path    string  true         "Planet Labs Item Type, e.g., rapideye or planetscope"
 // @Param   id              path    string  true         "Planet Labs image ID"
 // @Success 200 {object}  geojson.Feature
@@ -302,31 +514,15 @@ type ActivateHandler struct {
 	Context Context
 }
 
-// NewActivateHandler creates a new handler using configuration
-// from environment variables
+// NewActivateHandler creates a new handler using the current
+// planet Settings
 func NewActivateHandler() ActivateHandler {
-	planetBaseURL := os.Getenv("PL_API_URL")
-	if planetBaseURL == "" {
-		util.LogAlert(&util.BasicLogContext{}, "Didn't get Planet Labs API URL from the environment. Using default.")
-		planetBaseURL = "https://api.planet.com"
-	}
-
-	tidesURL := os.Getenv("BF_TIDE_PREDICTION_URL")
-	if tidesURL == "" {
-		util.LogAlert(&util.BasicLogContext{}, "Didn't get Tide Prediction URL from the environment. Using default.")
-		tidesURL = "https://bf-tideprediction.int.geointservices.io/tides"
-	}
-
-	return ActivateHandler{
-		Context: Context{
-			BasePlanetURL: planetBaseURL,
-			BaseTidesURL:  tidesURL,
-		},
-	}
+	return ActivateHandler{Context: NewContext()}
 }
 
 // ServeHTTP implements the http.Handler interface for the ActivateHandler type
 func (h ActivateHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
 	var (
 		err      error
 		options  MetadataOptions
@@ -346,12 +542,10 @@ func (h ActivateHandler) ServeHTTP(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	h.Context.PlanetKey = request.FormValue("PL_API_KEY")
-
-	if h.Context.PlanetKey == "" {
-
-		util.LogAlert(&h.Context, noPlanetKey)
-		util.HTTPError(request, writer, &h.Context, noPlanetKey, http.StatusBadRequest)
+	if err = h.Context.SetPlanetKey(writer, request); err != nil {
+		herr := err.(util.HTTPErr)
+		util.LogSimpleErr(&h.Context, herr.Message, nil)
+		util.WriteHTTPErr(request, writer, &h.Context, herr)
 		return
 	}
 
@@ -374,22 +568,28 @@ func (h ActivateHandler) ServeHTTP(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	if response, err = Activate(options, &h.Context); err == nil {
+	if response, err = Activate(request.Context(), options, &h.Context); err == nil {
 		defer response.Body.Close()
 		writer.Header().Set("Content-Type", response.Header.Get("Content-Type"))
 		if (response.StatusCode >= 200) && (response.StatusCode < 300) {
+			activations.Inc(itemType, "activated")
 			bytes, _ := ioutil.ReadAll(response.Body)
 			writer.Write(bytes)
 			util.LogAudit(&h.Context, util.LogAuditInput{Actor: request.URL.String(), Action: request.Method + " response", Actee: "anon user", Message: "Sending planet/{itemType}/{id} response", Severity: util.INFO})
 		} else {
-			message := fmt.Sprintf("Failed to activate Planet Labs scene: " + response.Status)
+			activations.Inc(itemType, "refused")
+			message := "Failed to activate Planet Labs scene: " + response.Status
 			err = util.LogSimpleErr(&h.Context, message, nil)
+			if retry := response.Header.Get("Retry-After"); retry != "" {
+				writer.Header().Set("Retry-After", retry)
+			}
 			util.HTTPError(request, writer, &h.Context, err.Error(), response.StatusCode)
 		}
 	} else {
+		activations.Inc(itemType, "failed")
 		switch herr := err.(type) {
 		case util.HTTPErr:
-			util.HTTPError(request, writer, &h.Context, herr.Message, herr.Status)
+			util.WriteHTTPErr(request, writer, &h.Context, herr)
 		default:
 			err = util.LogSimpleErr(&h.Context, "Failed to activate Planet Labs scene. ", err)
 			util.HTTPError(request, writer, &h.Context, err.Error(), 0)
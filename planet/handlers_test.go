@@ -15,12 +15,19 @@
 package planet
 
 import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
-
+	"github.com/venicegeo/dg-bf-ia-broker/encoder"
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
 	"github.com/venicegeo/dg-geojson-go/geojson"
 )
 
@@ -60,6 +67,233 @@ func TestDiscoverHandlerSuccess(t *testing.T) {
 	assert.Nil(t, err, "Expected to parse GeoJSON but received: %v", err)
 }
 
+func TestDiscoverHandlerRequestID(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	url := makeDiscoverTestingURL(mockServer.URL, testingValidKey) + "&tides=true"
+	var output []string
+	oldFunc := util.SetLogFunc(func(message string) { output = append(output, message) })
+	defer util.SetLogFunc(oldFunc)
+
+	request := httptest.NewRequest("GET", url, nil)
+	request.Header.Set(util.RequestIDHeader, "discover-1")
+	recorder := httptest.NewRecorder()
+	util.WithRequestID(router).ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "discover-1", recorder.Header().Get(util.RequestIDHeader))
+	if assert.NotEmpty(t, output) {
+		for _, message := range output {
+			assert.Contains(t, message, `"requestID":"discover-1"`)
+		}
+	}
+}
+
+func TestDiscoverHandlerTrace(t *testing.T) {
+	spans := &trace.Recorder{}
+	trace.SetExporter(spans, 1)
+	defer trace.SetExporter(nil, 1)
+	mockServer, _, router := createTestFixtures()
+	// A search no other test makes, so that it is not cached
+	url := makeDiscoverTestingURL(mockServer.URL, testingValidKey) + "&tides=true&maxAcquiredDate=2099-01-01T00:00:00Z"
+	handler := trace.Handler("/planet/discover/{itemType}", router)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	server, ok := spans.Find("GET /planet/discover/{itemType}")
+	if !assert.True(t, ok) {
+		return
+	}
+	search, _ := spans.Find("planet.SearchScenes")
+	assert.Equal(t, server.SpanID, search.ParentSpanID)
+	assert.Equal(t, "REOrthoTile", search.Attributes["planet.item_type"])
+	assert.Equal(t, false, search.Attributes["cache_hit"])
+	fc, err := geojson.FeatureCollectionFromBytes(recorder.Body.Bytes())
+	if assert.Nil(t, err) {
+		assert.Equal(t, len(fc.Features), search.Attributes["feature_count"])
+	}
+	for _, name := range []string{"planet.doRequest", "planet.transformScenes", "tides.GetTides"} {
+		span, ok := spans.Find(name)
+		if assert.True(t, ok, "Expected a %v span", name) {
+			assert.Equal(t, search.SpanID, span.ParentSpanID, "Expected %v to be part of the search", name)
+		}
+	}
+	transform, _ := spans.Find("planet.transformScenes")
+	assert.Equal(t, 2, transform.Attributes["feature_count"])
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	all := spans.Spans()
+	assert.Equal(t, true, all[len(all)-2].Attributes["cache_hit"])
+}
+
+func TestDiscoverHandlerStreamFailure(t *testing.T) {
+	// A full batch of scenes, then one that cannot be parsed
+	scene := `{"type":"Feature","id":"scene","geometry":{"type":"Point","coordinates":[0,0]},"properties":{"acquired":"2017-01-01T00:00:00Z"}}`
+	page := `{"features":[` + strings.Repeat(scene+",", tideBatchSize) + `"not a scene"]}`
+	planetServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(page))
+	}))
+	defer planetServer.Close()
+	spans := &trace.Recorder{}
+	trace.SetExporter(spans, 1)
+	defer trace.SetExporter(nil, 1)
+	handler := trace.Handler("/planet/discover/{itemType}", createTestRouter(testingSettings(planetServer.URL, "")))
+
+	for _, format := range []string{"geojson", "stac"} {
+		before := streamFailures.Value(format)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", makeDiscoverTestingURL(planetServer.URL, testingValidKey)+"&format="+format, nil))
+		assert.Equal(t, http.StatusOK, recorder.Code, format)
+		assert.True(t, strings.Contains(recorder.Body.String(), `"scene"`), format)
+		var body interface{}
+		assert.NotNil(t, json.Unmarshal(recorder.Body.Bytes(), &body), "Expected the %v body to be unterminated", format)
+		assert.Equal(t, before+1, streamFailures.Value(format), format)
+		all := spans.Spans()
+		server := all[len(all)-1]
+		assert.Equal(t, "GET /planet/discover/{itemType}", server.Name)
+		assert.NotEmpty(t, server.Error, format)
+	}
+}
+
+func TestDiscoverHandlerPageTraversal(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	token := base64.RawURLEncoding.EncodeToString([]byte("data/v1/searches/../../item-types/PSScene4Band/items/x"))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", makeDiscoverTestingURL(mockServer.URL, testingValidKey)+"&page="+token, nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+}
+
+func TestDiscoverHandlerGeoJSONSeq(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	url := makeDiscoverTestingURL(mockServer.URL, testingValidKey) + "&format=geojsonseq"
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code,
+		"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	assert.Equal(t, "application/geo+json-seq", recorder.Header().Get("Content-Type"))
+	records := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	assert.Equal(t, 2, len(records))
+	for _, record := range records {
+		_, err := geojson.FeatureFromBytes([]byte(strings.TrimPrefix(record, "\x1e")))
+		assert.Nil(t, err, "Expected to parse a GeoJSON feature but received: %v", err)
+	}
+
+	url = makeDiscoverTestingURL(mockServer.URL, testingValidKey) + "&format=shapefile"
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestDiscoverHandlerCSV(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	url := makeDiscoverTestingURL(mockServer.URL, testingValidKey)
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", url, nil)
+	request.Header.Set("Accept", "text/csv")
+
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code,
+		"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	assert.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	assert.Nil(t, err, "Expected to parse CSV but received: %v", err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, []string{"id", "geometry"}, records[0][:2])
+}
+
+func TestDiscoverHandlerVary(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	url := makeDiscoverTestingURL(mockServer.URL, testingValidKey)
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", url, nil)
+	request.Header.Set("Accept", "text/plain")
+
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"), "Expected text/plain not to mean WKT")
+	assert.Equal(t, "Accept", recorder.Header().Get("Vary"))
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url+"&format=shapefile", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, "Accept", recorder.Header().Get("Vary"), "Expected errors to vary by Accept too")
+}
+
+func TestDiscoverHandlerSTAC(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	url := makeDiscoverTestingURL(mockServer.URL, testingValidKey) + "&format=stac"
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code,
+		"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	var result struct {
+		Type     string
+		Features []encoder.STACItem
+		Links    []encoder.STACLink
+	}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, "FeatureCollection", result.Type)
+	assert.Equal(t, 2, len(result.Features))
+	assert.Equal(t, "REOrthoTile", result.Features[0].Collection)
+	assert.Equal(t, 2, len(result.Links))
+	assert.Equal(t, "next", result.Links[1].Rel)
+	assert.Contains(t, recorder.Header().Get("Link"), `rel="next"`)
+	for _, link := range result.Links {
+		assert.NotContains(t, link.Href, PlanetKeyParameter, "Expected the API key to be left out of links")
+	}
+	assert.NotContains(t, recorder.Header().Get("Link"), PlanetKeyParameter)
+
+	// Follow the next link
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest("GET", result.Links[1].Href, nil)
+	request.Header.Set(PlanetKeyHeader, testingValidKey)
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code,
+		"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	assert.Equal(t, "", recorder.Header().Get("Link"))
+}
+
+func TestDiscoverHandlerInvalidTideFilter(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	for _, query := range []string{"&minTideFraction=abc", "&maxTideFraction=1.5", "&minTide=2&maxTide=1", "&minTideFraction=NaN", "&maxTide=Inf", "&minTide=-Inf"} {
+		url := makeDiscoverTestingURL(mockServer.URL, testingValidKey) + query
+		recorder := httptest.NewRecorder()
+
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code,
+			"Expected request with %v to fail but received: %v, %v", query, recorder.Code, recorder.Body.String(),
+		)
+	}
+}
+
+func TestDiscoverHandlerTideFilter(t *testing.T) {
+	mockServer, router := createHarmonicTestFixtures()
+
+	tests := map[string]int{
+		"&minTideFraction=0&maxTideFraction=1": 2,
+		"&minTide=1000":                        0,
+	}
+	for query, count := range tests {
+		url := makeDiscoverTestingURL(mockServer.URL, testingValidKey) + query
+		recorder := httptest.NewRecorder()
+
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusOK, recorder.Code,
+			"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+		)
+		fc, err := geojson.FeatureCollectionFromBytes(recorder.Body.Bytes())
+		assert.Nil(t, err, "Expected to parse GeoJSON but received: %v", err)
+		assert.Equal(t, count, len(fc.Features), "Unexpected feature count for %v", query)
+	}
+}
+
 func TestMetadataHandlerSuccess(t *testing.T) {
 	mockServer, _, router := createTestFixtures()
 	url := makeMetadataTestingURL(mockServer.URL, testingValidKey, "rapideye", testingValidItemID)
@@ -71,6 +305,78 @@ func TestMetadataHandlerSuccess(t *testing.T) {
 	)
 }
 
+func TestMetadataHandlerKML(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	url := makeMetadataTestingURL(mockServer.URL, testingValidKey, "rapideye", testingValidItemID) + "&format=kml"
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code,
+		"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	assert.Equal(t, "application/vnd.google-earth.kml+xml", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "<Placemark><name>"+testingValidItemID+"</name>")
+}
+
+func TestMetadataHandlerSTAC(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	url := makeMetadataTestingURL(mockServer.URL, testingValidKey, "rapideye", testingValidItemID)
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", url, nil)
+	request.Header.Set("Accept", "application/stac+json")
+
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code,
+		"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	var item encoder.STACItem
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &item))
+	assert.Equal(t, encoder.STACVersion, item.STACVersion)
+	assert.Equal(t, testingValidItemID, item.ID)
+	assert.Equal(t, 50.0, item.Properties["eo:cloud_cover"])
+}
+
+func TestMetadataHandlerTideSeries(t *testing.T) {
+	mockServer, router := createHarmonicTestFixtures()
+	url := makeMetadataTestingURL(mockServer.URL, testingValidKey, "rapideye", testingValidItemID) + "&tideSeries=true&tideWindow=2&tideInterval=15"
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code,
+		"Expected request to succeed but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	feature, err := geojson.FeatureFromBytes(recorder.Body.Bytes())
+	assert.Nil(t, err, "Expected to parse GeoJSON but received: %v", err)
+	series, _ := feature.Properties["TideSeries"].([]interface{})
+	assert.Equal(t, 9, len(series), "Unexpected tide series length")
+	assert.False(t, math.IsNaN(feature.PropertyFloat("CurrentTide")))
+}
+
+func TestMetadataHandlerInvalidTideSeries(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	for _, query := range []string{"&tideWindow=-1", "&tideInterval=x", "&tideWindow=1000", "&tideWindow=168&tideInterval=1"} {
+		url := makeMetadataTestingURL(mockServer.URL, testingValidKey, "rapideye", testingValidItemID) + "&tideSeries=true" + query
+		recorder := httptest.NewRecorder()
+
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code,
+			"Expected request with %v to fail but received: %v, %v", query, recorder.Code, recorder.Body.String(),
+		)
+	}
+}
+
+func TestMetadataHandlerTideSeriesUnsupported(t *testing.T) {
+	mockServer, _, router := createTestFixtures()
+	url := makeMetadataTestingURL(mockServer.URL, testingValidKey, "rapideye", testingValidItemID) + "&tideSeries=true"
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusNotImplemented, recorder.Code,
+		"Expected a series from the tide service to fail but received: %v, %v", recorder.Code, recorder.Body.String(),
+	)
+	assert.Contains(t, recorder.Body.String(), "harmonic or noaa")
+}
+
 func TestMetadataHandlerImageIDNotFound(t *testing.T) {
 	mockServer, _, router := createTestFixtures()
 	url := makeMetadataTestingURL(mockServer.URL, testingValidKey, "rapideye", "")
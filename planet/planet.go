@@ -16,38 +16,39 @@ package planet
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/venicegeo/dg-bf-ia-broker/landsat"
 	"github.com/venicegeo/dg-bf-ia-broker/tides"
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
 	"github.com/venicegeo/dg-bf-ia-broker/util"
 	"github.com/venicegeo/dg-geojson-go/geojson"
 )
 
 var disablePermissionsCheck bool
 
-func init() {
-	disablePermissionsCheck, _ = strconv.ParseBool(os.Getenv("PL_DISABLE_PERMISSIONS_CHECK"))
-	if disablePermissionsCheck {
-		util.LogInfo(&util.BasicLogContext{}, "Disabling Planet Labs permissions check")
-	}
-}
-
 // Context is the context for a Planet Labs Operation
 type Context struct {
 	BasePlanetURL string
 	BaseTidesURL  string
+	TideSource    tides.TideSource // if nil, the tide prediction service at BaseTidesURL is used
+	Caching       CacheSettings
+	Credentials   CredentialSettings
+	RateLimit     RateLimitSettings
 	PlanetKey     string
 	sessionID     string
+	requestID     string
 }
 
 // AppName returns an empty string
@@ -68,6 +69,24 @@ func (c *Context) LogRootDir() string {
 	return ""
 }
 
+// RequestID returns the ID of the request being handled, if any
+func (c *Context) RequestID() string {
+	return c.requestID
+}
+
+// SetRequestID ties the context to the request with the given ID, so that
+// its log entries and those of the tide predictions made for it carry the ID
+func (c *Context) SetRequestID(id string) {
+	c.requestID = id
+}
+
+// tidesContext returns a context for the tide predictions made for a request
+func (c *Context) tidesContext() *tides.Context {
+	result := tides.Context{TidesURL: c.BaseTidesURL, Source: c.TideSource}
+	result.SetRequestID(c.requestID)
+	return &result
+}
+
 // SearchOptions are the search options for a quick-search request
 type SearchOptions struct {
 	ItemType        string
@@ -76,17 +95,32 @@ type SearchOptions struct {
 	MaxAcquiredDate string
 	Bbox            geojson.BoundingBox
 	CloudCover      float64
+	Intersects      interface{} // a GeoJSON geometry that scenes must intersect
+	PageSize        int         // if zero, Planet Labs decides
+	PageToken       string      // if set, continues an earlier search and the filters above are ignored
 }
 
-type searchResults struct {
-	Features []feature `json:"features"`
-}
-
-type feature struct {
-	Links       Links    `json:"_links"`
+// searchFeature is a scene as Planet Labs returns it from a search
+type searchFeature struct {
+	geojson.Feature
 	Permissions []string `json:"_permissions"`
 }
 
+// maxCachedPageSize is the size in bytes of the largest page of search
+// results that is cached, so that very large pages never fill the cache
+const maxCachedPageSize = 2 << 20
+
+// tideBatchSize is the number of scenes whose tides are looked up together
+const tideBatchSize = 50
+
+const searchResultsPath = "data/v1/searches/"
+
+// The parts of a link to a page of search results that page tokens keep
+var (
+	searchIDPattern      = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	searchResultsPattern = regexp.MustCompile(`/data/v1/searches/([A-Za-z0-9_-]+)/results$`)
+)
+
 type request struct {
 	ItemTypes []string `json:"item_types"`
 	Filter    filter   `json:"filter"`
@@ -148,32 +182,235 @@ type doRequestInput struct {
 	inputURL    string // URL may be relative or absolute based on baseURLString
 	body        []byte
 	contentType string
+	retrySafe   bool   // safe to repeat after a transient failure, though not idempotent
+	endpoint    string // names the endpoint in metrics
 }
 
 // MetadataOptions are the options for the Asset func
 type MetadataOptions struct {
-	ID       string
-	Tides    bool
-	ItemType string
+	ID         string
+	Tides      bool
+	TideSeries *tides.SeriesOptions // if set, tides are included along with a series
+	ItemType   string
 }
 
 // GetScenes returns a FeatureCollection containing the scenes requested
-func GetScenes(options SearchOptions, context *Context) (*geojson.FeatureCollection, error) {
+func GetScenes(ctx context.Context, options SearchOptions, context *Context) (*geojson.FeatureCollection, error) {
+	fc, _, err := SearchScenes(ctx, options, context)
+	return fc, err
+}
+
+// SearchScenes returns a FeatureCollection containing a page of the scenes
+// requested, and a token for the next page if there is one
+func SearchScenes(ctx context.Context, options SearchOptions, context *Context) (*geojson.FeatureCollection, string, error) {
+	var features []*geojson.Feature
+	scenes, err := OpenScenes(ctx, options, context)
+	if err != nil {
+		return nil, "", err
+	}
+	defer scenes.Close()
+	for {
+		feature, err := scenes.Read()
+		if err == io.EOF {
+			return geojson.NewFeatureCollection(features), scenes.Next, nil
+		} else if err != nil {
+			return nil, "", err
+		}
+		features = append(features, feature)
+	}
+}
+
+// Scenes reads a page of search results one scene at a time. Scenes are
+// transformed as they are read, and their tides looked up a batch at a time,
+// so that a page is never held in memory in its transformed form.
+type Scenes struct {
+	Next    string // the token for the next page, if there is one
+	ctx     context.Context
+	span    *trace.Span
+	context *Context
+	tides   bool
+	decoder *json.Decoder
+	batch   []*geojson.Feature
+	count   int
+	err     error
+}
+
+// OpenScenes starts reading a page of the scenes requested.
+// The caller must Close the result.
+func OpenScenes(ctx context.Context, options SearchOptions, context *Context) (*Scenes, error) {
+	ctx, span := trace.Start(ctx, "planet.SearchScenes")
+	span.SetAttribute("planet.item_type", options.ItemType)
+	scenes, err := openScenes(ctx, options, context)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return nil, err
+	}
+	scenes.ctx, scenes.span, scenes.tides = ctx, span, options.Tides
+	return scenes, nil
+}
+
+func openScenes(ctx context.Context, options SearchOptions, context *Context) (*Scenes, error) {
+	var page struct {
+		Links struct {
+			Next string `json:"_next"`
+		} `json:"_links"`
+	}
+	body, err := searchPage(ctx, options, context)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(body, &page); err != nil {
+		return nil, util.LogSimpleErr(context, fmt.Sprintf("Failed to parse GeoJSON.\n%v", string(body)), err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err = seekFeatures(decoder); err != nil {
+		plErr := util.Error{SimpleMsg: fmt.Sprintf("Expected a FeatureCollection: %v", err), Response: string(body)}
+		return nil, plErr.Log(context, "")
+	}
+	return &Scenes{Next: encodePageToken(page.Links.Next), context: context, decoder: decoder}, nil
+}
+
+// seekFeatures moves the decoder to the first of the features of a
+// FeatureCollection
+func seekFeatures(decoder *json.Decoder) error {
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return errors.New("not a JSON object")
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token == "features" {
+			if token, err = decoder.Token(); err != nil || token != json.Delim('[') {
+				return errors.New("features is not an array")
+			}
+			return nil
+		}
+		var skipped json.RawMessage
+		if err = decoder.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+	return errors.New("no features")
+}
+
+// Read returns the next scene, or io.EOF after the last one
+func (s *Scenes) Read() (*geojson.Feature, error) {
+	for len(s.batch) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		if s.err = s.fill(); s.err != nil && s.err != io.EOF {
+			s.span.SetError(s.err)
+		}
+	}
+	feature := s.batch[0]
+	s.batch[0], s.batch = nil, s.batch[1:]
+	s.count++
+	return feature, nil
+}
+
+// Close ends the search, noting how many scenes were read
+func (s *Scenes) Close() {
+	s.span.SetAttribute("feature_count", s.count)
+	s.span.End()
+}
+
+// fill reads the next batch of scenes, with their tides if they were requested
+func (s *Scenes) fill() error {
+	if !s.decoder.More() {
+		return io.EOF
+	}
+	if err := util.Canceled(s.ctx); err != nil {
+		return err
+	}
+	batch, err := transformScenes(s.ctx, s.decoder, s.context)
+	if err != nil {
+		return err
+	}
+	if s.tides && len(batch) > 0 {
+		fc, err := tides.GetTides(s.ctx, geojson.NewFeatureCollection(batch), s.context.tidesContext())
+		if err != nil {
+			return err
+		}
+		batch = fc.Features
+	}
+	s.batch = batch
+	return nil
+}
+
+// searchPage returns a page of search results as Planet Labs sent it,
+// from the cache if it is there
+func searchPage(ctx context.Context, options SearchOptions, context *Context) ([]byte, error) {
 	var (
 		err          error
 		response     *http.Response
-		requestBody  []byte
 		responseBody []byte
-		req          request
-		fc           *geojson.FeatureCollection
 	)
 
+	key := cacheKey("scenes", context, normalizeSearchOptions(options))
+	if cached, ok := context.cacheGet(ctx, key); ok {
+		return cached, nil
+	}
+
+	if options.PageToken != "" {
+		var inputURL string
+		if inputURL, err = decodePageToken(options.PageToken); err != nil {
+			return nil, err
+		}
+		if response, err = doRequest(ctx, doRequestInput{method: "GET", inputURL: inputURL, endpoint: "quick-search"}, context); err != nil {
+			// Pass on a refusal to wait for our turn as it is
+			if _, ok := err.(util.HTTPErr); !ok {
+				err = util.LogSimpleErr(context, "Failed to complete Planet Labs request for the next page of results.", err)
+			}
+			return nil, err
+		}
+	} else if response, err = quickSearch(ctx, options, context); err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	switch {
+	case (response.StatusCode >= 400) && (response.StatusCode < 500):
+		message := fmt.Sprintf("Failed to discover scenes from Planet Labs: %v. ", response.Status)
+		err := util.HTTPErr{Status: response.StatusCode, Message: message, RetryAfter: retryAfter(response)}
+		util.LogAlert(context, message)
+		return nil, err
+	case response.StatusCode >= 500:
+		err = util.LogSimpleErr(context, "Failed to discover scenes from Planet Labs.", errors.New(response.Status))
+		return nil, err
+	default:
+		//no op
+	}
+
+	responseBody, _ = ioutil.ReadAll(response.Body)
+	if err = util.Canceled(ctx); err != nil {
+		return nil, err
+	}
+	if len(responseBody) <= maxCachedPageSize {
+		context.cacheSetBytes(key, responseBody, context.Caching.TTL)
+	}
+	return responseBody, nil
+}
+
+// quickSearch posts a new search to Planet Labs
+func quickSearch(ctx context.Context, options SearchOptions, context *Context) (*http.Response, error) {
+	var (
+		err         error
+		response    *http.Response
+		requestBody []byte
+		req         request
+	)
 	req.ItemTypes = append(req.ItemTypes, options.ItemType)
 	req.Filter.Type = "AndFilter"
 	req.Filter.Config = make([]interface{}, 0)
 	if options.Bbox != nil {
 		req.Filter.Config = append(req.Filter.Config, objectFilter{Type: "GeometryFilter", FieldName: "geometry", Config: options.Bbox.Geometry()})
 	}
+	if options.Intersects != nil {
+		req.Filter.Config = append(req.Filter.Config, objectFilter{Type: "GeometryFilter", FieldName: "geometry", Config: options.Intersects})
+	}
 	if options.AcquiredDate != "" || options.MaxAcquiredDate != "" {
 		dc := dateConfig{GTE: options.AcquiredDate, LTE: options.MaxAcquiredDate}
 		req.Filter.Config = append(req.Filter.Config, objectFilter{Type: "DateRangeFilter", FieldName: "acquired", Config: dc})
@@ -186,41 +423,64 @@ func GetScenes(options SearchOptions, context *Context) (*geojson.FeatureCollect
 		err = util.LogSimpleErr(context, fmt.Sprintf("Failed to marshal request object %#v.", req), err)
 		return nil, err
 	}
-	if response, err = doRequest(doRequestInput{method: "POST", inputURL: "data/v1/quick-search", body: requestBody, contentType: "application/json"}, context); err != nil {
-		err = util.LogSimpleErr(context, fmt.Sprintf("Failed to complete Planet Labs request %#v.", requestBody), err)
-		return nil, err
+	inputURL := "data/v1/quick-search"
+	if options.PageSize > 0 {
+		inputURL += "?_page_size=" + strconv.Itoa(options.PageSize)
 	}
-	switch {
-	case (response.StatusCode >= 400) && (response.StatusCode < 500):
-		message := fmt.Sprintf("Failed to discover scenes from Planet Labs: %v. ", response.Status)
-		err := util.HTTPErr{Status: response.StatusCode, Message: message}
-		util.LogAlert(context, message)
-		return nil, err
-	case response.StatusCode >= 500:
-		err = util.LogSimpleErr(context, "Failed to discover scenes from Planet Labs.", errors.New(response.Status))
+	if response, err = doRequest(ctx, doRequestInput{method: "POST", inputURL: inputURL, body: requestBody, contentType: "application/json", retrySafe: true, endpoint: "quick-search"}, context); err != nil {
+		// Pass on a refusal to wait for our turn as it is
+		if _, ok := err.(util.HTTPErr); !ok {
+			err = util.LogSimpleErr(context, fmt.Sprintf("Failed to complete Planet Labs request %#v.", requestBody), err)
+		}
 		return nil, err
-	default:
-		//no op
 	}
+	return response, nil
+}
 
-	defer response.Body.Close()
-	responseBody, _ = ioutil.ReadAll(response.Body)
+// encodePageToken turns the link Planet Labs gives for the next page of
+// results into an opaque token. Only the search ID and the page are kept,
+// and decodePageToken rebuilds the link from them, so that a token can
+// never direct requests anywhere but the next page of a search.
+func encodePageToken(next string) string {
+	nextURL, err := url.Parse(next)
+	if next == "" || err != nil {
+		return ""
+	}
+	match := searchResultsPattern.FindStringSubmatch(nextURL.Path)
+	page := nextURL.Query().Get("_page")
+	if match == nil || page == "" {
+		return ""
+	}
+	token := url.Values{"search": {match[1]}, "_page": {page}}
+	return base64.RawURLEncoding.EncodeToString([]byte(token.Encode()))
+}
 
-	if fc, err = transformSRBody(responseBody, context); err != nil {
-		return nil, err
+func decodePageToken(token string) (string, error) {
+	invalid := util.HTTPErr{Status: http.StatusBadRequest, Message: fmt.Sprintf("The page value of %v is invalid", token)}
+	bytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", invalid
 	}
-	if options.Tides {
-		tidesContext := tides.Context{TidesURL: context.BaseTidesURL}
-		if fc, err = tides.GetTides(fc, &tidesContext); err != nil {
-			return nil, err
-		}
+	values, err := url.ParseQuery(string(bytes))
+	searchID, page := values.Get("search"), values.Get("_page")
+	if err != nil || !searchIDPattern.MatchString(searchID) || page == "" {
+		return "", invalid
 	}
-	return fc, nil
+	return searchResultsPath + searchID + "/results?" + url.Values{"_page": {page}}.Encode(), nil
 }
 
 // GetAsset returns the status of the analytic asset and
 // attempts to activate it if needed
-func GetAsset(options MetadataOptions, context *Context) (Asset, error) {
+func GetAsset(ctx context.Context, options MetadataOptions, context *Context) (Asset, error) {
+	ctx, span := trace.Start(ctx, "planet.GetAsset")
+	defer span.End()
+	span.SetAttribute("planet.item_type", options.ItemType)
+	result, err := getAsset(ctx, options, context)
+	span.SetError(err)
+	return result, err
+}
+
+func getAsset(ctx context.Context, options MetadataOptions, context *Context) (Asset, error) {
 	var (
 		result   Asset
 		response *http.Response
@@ -228,15 +488,21 @@ func GetAsset(options MetadataOptions, context *Context) (Asset, error) {
 		body     []byte
 		assets   Assets
 	)
+	key := assetCacheKey(context, options)
+	if cached, ok := context.cacheGet(ctx, key); ok {
+		if err = json.Unmarshal(cached, &result); err == nil {
+			return result, nil
+		}
+	}
 	// Note: trailing `/` is needed here to avoid a redirect which causes a Go 1.7 redirect bug issue
 	inputURL := "data/v1/item-types/" + options.ItemType + "/items/" + options.ID + "/assets/"
-	if response, err = doRequest(doRequestInput{method: "GET", inputURL: inputURL}, context); err != nil {
+	if response, err = doRequest(ctx, doRequestInput{method: "GET", inputURL: inputURL, endpoint: "assets"}, context); err != nil {
 		return result, err
 	}
 	switch {
 	case (response.StatusCode >= 400) && (response.StatusCode < 500):
 		message := fmt.Sprintf("Failed to get asset information for scene %v: %v. ", options.ID, response.Status)
-		err := util.HTTPErr{Status: response.StatusCode, Message: message}
+		err := util.HTTPErr{Status: response.StatusCode, Message: message, RetryAfter: retryAfter(response)}
 		util.LogAlert(context, message)
 		return result, err
 	case response.StatusCode >= 500:
@@ -247,6 +513,9 @@ func GetAsset(options MetadataOptions, context *Context) (Asset, error) {
 	}
 	defer response.Body.Close()
 	body, _ = ioutil.ReadAll(response.Body)
+	if err = util.Canceled(ctx); err != nil {
+		return result, err
+	}
 	if err = json.Unmarshal(body, &assets); err != nil {
 		plErr := util.Error{LogMsg: "Failed to Unmarshal response from Planet Labs data request: " + err.Error(),
 			SimpleMsg:  "Planet Labs returned an unexpected response for this request. See log for further details.",
@@ -256,28 +525,47 @@ func GetAsset(options MetadataOptions, context *Context) (Asset, error) {
 		err = plErr.Log(context, "")
 		return result, err
 	}
+	context.cacheSet(key, assets.Analytic, context.Caching.AssetTTL)
 	return assets.Analytic, nil
 }
 
 // GetMetadata returns the Beachfront metadata for a single scene
-func GetMetadata(options MetadataOptions, context *Context) (*geojson.Feature, error) {
+func GetMetadata(ctx context.Context, options MetadataOptions, context *Context) (*geojson.Feature, error) {
+	ctx, span := trace.Start(ctx, "planet.GetMetadata")
+	defer span.End()
+	span.SetAttribute("planet.item_type", options.ItemType)
+	feature, err := getMetadata(ctx, options, context)
+	span.SetError(err)
+	return feature, err
+}
+
+func getMetadata(ctx context.Context, options MetadataOptions, context *Context) (*geojson.Feature, error) {
 	var (
 		response *http.Response
 		err      error
 		body     []byte
 		feature  geojson.Feature
 	)
+	key := cacheKey("metadata", context, options)
+	if cached, ok := context.cacheGet(ctx, key); ok {
+		if cachedFeature, err := geojson.FeatureFromBytes(cached); err == nil {
+			return cachedFeature, nil
+		}
+	}
 	inputURL := "data/v1/item-types/" + options.ItemType + "/items/" + options.ID
-	input := doRequestInput{method: "GET", inputURL: inputURL}
-	if response, err = doRequest(input, context); err != nil {
+	input := doRequestInput{method: "GET", inputURL: inputURL, endpoint: "item"}
+	if response, err = doRequest(ctx, input, context); err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
 	body, _ = ioutil.ReadAll(response.Body)
+	if err = util.Canceled(ctx); err != nil {
+		return nil, err
+	}
 	switch {
 	case (response.StatusCode >= 400) && (response.StatusCode < 500):
 		message := fmt.Sprintf("Failed to find metadata for scene %v: %v. ", options.ID, response.Status)
-		err := util.HTTPErr{Status: response.StatusCode, Message: message}
+		err := util.HTTPErr{Status: response.StatusCode, Message: message, RetryAfter: retryAfter(response)}
 		util.LogAlert(context, message)
 		return nil, err
 	case response.StatusCode >= 500:
@@ -296,41 +584,58 @@ func GetMetadata(options MetadataOptions, context *Context) (*geojson.Feature, e
 		return nil, err
 	}
 	feature = *transformSRFeature(&feature, context)
-	if options.Tides {
-		var (
-			tc tides.Context
-		)
-		tc.TidesURL = context.BaseTidesURL
+	if options.Tides || options.TideSeries != nil {
+		tc := context.tidesContext()
 		fc := geojson.NewFeatureCollection([]*geojson.Feature{&feature})
-		if fc, err = tides.GetTides(fc, &tc); err != nil {
+		if options.TideSeries != nil {
+			fc, err = tides.GetTideSeries(ctx, fc, *options.TideSeries, tc)
+		} else {
+			fc, err = tides.GetTides(ctx, fc, tc)
+		}
+		if err != nil {
 			return nil, err
 		}
-		feature = *fc.Features[0]
+		if len(fc.Features) > 0 {
+			feature = *fc.Features[0]
+		}
 	}
 
+	context.cacheSet(key, &feature, context.Caching.TTL)
 	return &feature, nil
 }
 
 // Activate retrieves and activates the analytic asset.
-func Activate(options MetadataOptions, context *Context) (*http.Response, error) {
+func Activate(ctx context.Context, options MetadataOptions, context *Context) (*http.Response, error) {
 	var (
 		asset Asset
 		err   error
 	)
-	if asset, err = GetAsset(options, context); err != nil {
+	if asset, err = GetAsset(ctx, options, context); err != nil {
 		return nil, err
 	}
-	return doRequest(doRequestInput{method: "POST", inputURL: asset.Links.Activate}, context)
+	response, err := doRequest(ctx, doRequestInput{method: "POST", inputURL: asset.Links.Activate, endpoint: "activate"}, context)
+	if err == nil && response.StatusCode >= 200 && response.StatusCode < 300 {
+		// The asset is now activating, so its cached status is stale
+		context.cacheDelete(assetCacheKey(context, options))
+	}
+	return response, err
 }
 
-// doRequest performs the request
-func doRequest(input doRequestInput, context *Context) (*http.Response, error) {
+// doRequest performs the request, abandoning it once ctx is done
+func doRequest(ctx context.Context, input doRequestInput, context *Context) (*http.Response, error) {
 	var (
 		request   *http.Request
 		parsedURL *url.URL
 		inputURL  string
 		err       error
 	)
+	ctx, span := trace.Start(ctx, "planet.doRequest")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	span.SetAttribute("planet.endpoint", input.endpoint)
+	span.SetAttribute("http.method", input.method)
 	inputURL = input.inputURL
 	if !strings.Contains(inputURL, context.BasePlanetURL) {
 		baseURL, _ := url.Parse(context.BasePlanetURL)
@@ -348,7 +653,7 @@ func doRequest(input doRequestInput, context *Context) (*http.Response, error) {
 	if bodyStr != "" {
 		message += ": " + bodyStr
 	}
-	if request, err = http.NewRequest(input.method, inputURL, bytes.NewBuffer(input.body)); err != nil {
+	if request, err = http.NewRequestWithContext(ctx, input.method, inputURL, bytes.NewBuffer(input.body)); err != nil {
 		err = util.LogSimpleErr(context, fmt.Sprintf("Failed to make a new HTTP request for %v.", inputURL), err)
 		return nil, err
 	}
@@ -356,11 +661,24 @@ func doRequest(input doRequestInput, context *Context) (*http.Response, error) {
 		request.Header.Set("Content-Type", input.contentType)
 	}
 
-	request.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(context.PlanetKey+":")))
+	// The message is built before the key is added, so that it never
+	// depends on redaction to keep the key out of the logs
 	message = fmt.Sprintf("%v\nHeader:\n%#v", message, request.Header)
+	request.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(context.PlanetKey+":")))
+	if err = context.waitForPlanet(ctx); err != nil {
+		return nil, err
+	}
 	util.LogAudit(context, util.LogAuditInput{Actor: "planet/doRequest", Action: input.method, Actee: inputURL, Message: message, Severity: util.INFO})
+	if input.retrySafe {
+		request = util.RetrySafe(request)
+	}
+	request = util.WithEndpoint(request, input.endpoint)
+	response, err := util.Do(util.PlanetProfile, request)
 	util.LogAudit(context, util.LogAuditInput{Actor: inputURL, Action: input.method + " response", Actee: "planet/doRequest", Message: "Receiving data from Planet Labs", Severity: util.INFO})
-	return util.HTTPClient().Do(request)
+	if err == nil && response.StatusCode == http.StatusTooManyRequests {
+		context.planetThrottled(response)
+	}
+	return response, err
 }
 
 func scontains(input []string, check string) bool {
@@ -372,40 +690,32 @@ func scontains(input []string, check string) bool {
 	return false
 }
 
-// Transforms search results into a FeatureCollection for later use
-func transformSRBody(body []byte, context util.LogContext) (*geojson.FeatureCollection, error) {
+// transformScenes decodes and transforms the next batch of scenes,
+// skipping those we lack permissions for
+func transformScenes(ctx context.Context, decoder *json.Decoder, context util.LogContext) ([]*geojson.Feature, error) {
 	var (
-		result    *geojson.FeatureCollection
-		fc        *geojson.FeatureCollection
-		fci       interface{}
-		err       error
-		ok        bool
-		features  []*geojson.Feature
-		plResults searchResults
+		err    error
+		result []*geojson.Feature
 	)
-	if fci, err = geojson.Parse(body); err != nil {
-		err = util.LogSimpleErr(context, fmt.Sprintf("Failed to parse GeoJSON.\n%v", string(body)), err)
-		return nil, err
-	}
-	if fc, ok = fci.(*geojson.FeatureCollection); !ok {
-		plErr := util.Error{SimpleMsg: fmt.Sprintf("Expected a FeatureCollection and got %T", fci),
-			Response: string(body)}
-		err = plErr.Log(context, "")
-		return nil, err
-	}
-	if err = json.Unmarshal(body, &plResults); err != nil {
-		return result, err
-	}
-	for inx, curr := range fc.Features {
+	_, span := trace.Start(ctx, "planet.transformScenes")
+	defer func() {
+		span.SetAttribute("feature_count", len(result))
+		span.SetError(err)
+		span.End()
+	}()
+	for inx := 0; inx < tideBatchSize && decoder.More(); inx++ {
+		var scene searchFeature
+		if err = decoder.Decode(&scene); err != nil {
+			err = util.LogSimpleErr(context, "Failed to parse GeoJSON.", err)
+			return nil, err
+		}
 
 		// We need to suppress scenes that we don't have permissions for
-		if disablePermissionsCheck || scontains(plResults.Features[inx].Permissions, "assets.analytic:download") {
-			features = append(features, transformSRFeature(curr, context))
-			// } else {
-			// 	util.LogInfo(context, fmt.Sprintf("Skipping scene %v due to lack of permissions.", curr.IDStr()))
+		if permissionsCheckDisabled() || scontains(scene.Permissions, "assets.analytic:download") {
+			scene.ResolveGeometry()
+			result = append(result, transformSRFeature(&scene.Feature, context))
 		}
 	}
-	result = geojson.NewFeatureCollection(features)
 	return result, nil
 }
 
@@ -15,8 +15,16 @@
 package planet
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/venicegeo/dg-bf-ia-broker/util"
@@ -33,6 +41,7 @@ func makeTestingContext(planetServer *httptest.Server, tidesServer *httptest.Ser
 
 func TestPlanetNoParameters(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 
 	body := `{
@@ -53,12 +62,13 @@ func TestPlanetNoParameters(t *testing.T) {
 		contentType: "application/json",
 	}
 
-	_, err := doRequest(requestInput, &context)
+	_, err := doRequest(ctx, requestInput, &context)
 	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
 }
 
 func TestGetScenesBoundingBox(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 
 	var options SearchOptions
@@ -66,52 +76,99 @@ func TestGetScenesBoundingBox(t *testing.T) {
 	assert.Nil(t, err, "Failed creating bounding box %v", err)
 	options.Bbox = bbox
 
-	_, err = GetScenes(options, &context)
+	_, err = GetScenes(ctx, options, &context)
 	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
 }
 
 func TestGetScenesCloudCover(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 
 	options := SearchOptions{CloudCover: 0.1}
 
-	_, err := GetScenes(options, &context)
+	_, err := GetScenes(ctx, options, &context)
 	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
 }
 
 func TestGetScenesAcquiredDate(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 
 	options := SearchOptions{AcquiredDate: "2016-01-01T00:00:00Z"}
 
-	_, err := GetScenes(options, &context)
+	_, err := GetScenes(ctx, options, &context)
 	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
 }
 
+func TestSearchScenesPaging(t *testing.T) {
+	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
+	context := makeTestingContext(planetServer, tidesServer)
+
+	first, next, err := SearchScenes(ctx, SearchOptions{ItemType: testingValidItemType}, &context)
+	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
+	assert.NotEmpty(t, first.Features)
+	assert.NotEqual(t, "", next, "Expected a token for the next page")
+
+	second, next, err := SearchScenes(ctx, SearchOptions{PageToken: next}, &context)
+	assert.Nil(t, err, "Expected request for the next page to succeed; received: %v", err)
+	assert.Equal(t, len(first.Features), len(second.Features))
+	assert.Equal(t, "", next, "Expected no further pages")
+
+	traversal := base64.RawURLEncoding.EncodeToString([]byte("search=../../item-types/PSScene4Band/items/x&_page=1"))
+	legacy := base64.RawURLEncoding.EncodeToString([]byte("data/v1/searches/../../item-types/PSScene4Band/items/x"))
+	noPage := base64.RawURLEncoding.EncodeToString([]byte("search=abc"))
+	assert.Equal(t, "", encodePageToken("https://example.com/data/v1/item-types/?_page=2"))
+	for _, token := range []string{"not base64!", traversal, legacy, noPage} {
+		_, _, err = SearchScenes(ctx, SearchOptions{PageToken: token}, &context)
+		herr, ok := err.(util.HTTPErr)
+		assert.True(t, ok, "Expected an HTTP error for token %v; received: %v", token, err)
+		assert.Equal(t, 400, herr.Status)
+	}
+}
+
 func TestGetScenesTides(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 
 	options := SearchOptions{Tides: true}
 
-	_, err := GetScenes(options, &context)
+	_, err := GetScenes(ctx, options, &context)
 	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
 
 }
 
+func TestDoRequestLogsNoKey(t *testing.T) {
+	var logs bytes.Buffer
+	oldLogger := util.CurrentLogger()
+	util.SetLogger(util.NewLogger(util.DEBUG, util.NewWriterSink(&logs, util.JSONFormat)))
+	defer util.SetLogger(util.NewLogger(oldLogger.Level, util.NewWriterSink(os.Stdout, util.JSONFormat)))
+	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
+	context := makeTestingContext(planetServer, tidesServer)
+
+	_, err := GetScenes(ctx, SearchOptions{ItemType: testingValidItemType}, &context)
+	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
+	assert.Contains(t, logs.String(), "Requesting data from Planet Labs")
+	assert.NotContains(t, logs.String(), "Authorization", "Expected the request headers logged without the key")
+	assert.NotContains(t, logs.String(), base64.StdEncoding.EncodeToString([]byte(testingValidKey+":")))
+}
+
 func TestGetMetadata(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 
 	options := SearchOptions{Tides: true}
 
-	scenes, err := GetScenes(options, &context)
+	scenes, err := GetScenes(ctx, options, &context)
 	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
 
 	aOptions := MetadataOptions{ID: scenes.Features[0].IDStr(), Tides: true, ItemType: "REOrthoTile"}
-	feature, err := GetMetadata(aOptions, &context)
+	feature, err := GetMetadata(ctx, aOptions, &context)
 	assert.Nil(t, err, "Failed to get asset metadata; received: %v", err)
 
 	assert.Equal(t, aOptions.ID, feature.IDStr())
@@ -119,24 +176,26 @@ func TestGetMetadata(t *testing.T) {
 
 func TestGetAsset(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 
 	options := SearchOptions{Tides: true}
 
-	scenes, err := GetScenes(options, &context)
+	scenes, err := GetScenes(ctx, options, &context)
 	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
 
 	aOptions := MetadataOptions{ID: scenes.Features[0].IDStr(), Tides: true, ItemType: "REOrthoTile"}
-	_, err = GetAsset(aOptions, &context)
+	_, err = GetAsset(ctx, aOptions, &context)
 	assert.Nil(t, err, "Failed to get asset; received %v", err)
 }
 
 func TestGetMetadataBadAssetID(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 	aOptions := MetadataOptions{ID: "X-BAD-ID-X", Tides: true, ItemType: "PSOrthoTile"}
 
-	_, err := GetMetadata(aOptions, &context)
+	_, err := GetMetadata(ctx, aOptions, &context)
 	assert.NotNil(t, err, "Expected invalid ID asset to fail, but it succeeded.")
 	if _, ok := err.(util.HTTPErr); err != nil && !ok {
 		t.Errorf("Expected an HTTPErr, got a %T", err)
@@ -145,10 +204,11 @@ func TestGetMetadataBadAssetID(t *testing.T) {
 
 func TestGetMetadataBadKey(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 	context.PlanetKey = "garbage"
 	aOptions := MetadataOptions{ID: "foobar123", Tides: true, ItemType: "PSOrthoTile"}
-	_, err := GetMetadata(aOptions, &context)
+	_, err := GetMetadata(ctx, aOptions, &context)
 	assert.NotNil(t, err, "Expected invalid API key to fail, but it succeeded.")
 	if httpErr, ok := err.(util.HTTPErr); err != nil && !ok {
 		t.Errorf("Expected an HTTPErr, got a %T", err)
@@ -159,6 +219,7 @@ func TestGetMetadataBadKey(t *testing.T) {
 
 func TestGetMetadataSentinel(t *testing.T) {
 	planetServer, tidesServer, _ := createTestFixtures()
+	ctx := context.Background()
 	context := makeTestingContext(planetServer, tidesServer)
 
 	options := MetadataOptions{
@@ -166,6 +227,50 @@ func TestGetMetadataSentinel(t *testing.T) {
 		ItemType: "Sentinel2L1C",
 	}
 
-	_, err := GetMetadata(options, &context)
+	_, err := GetMetadata(ctx, options, &context)
 	assert.Nil(t, err, "Expected request to succeed; received: %v", err)
 }
+
+func TestGetScenesRetried(t *testing.T) {
+	util.SetResilience(util.RetrySettings{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, util.DefaultBreakerSettings())
+	defer util.SetResilience(util.DefaultRetrySettings(), util.DefaultBreakerSettings())
+	requests := 0
+	planetServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(request.Body)
+		if requests == 1 || !strings.Contains(string(body), "REOrthoTile") {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writer.Write([]byte(testingSampleSearchResult))
+	}))
+	defer planetServer.Close()
+	ctx := context.Background()
+	context := Context{BasePlanetURL: planetServer.URL, PlanetKey: testingValidKey}
+
+	_, err := GetScenes(ctx, SearchOptions{ItemType: "REOrthoTile"}, &context)
+	assert.Nil(t, err, "Expected the quick search to be retried; received: %v", err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestGetScenesCanceled(t *testing.T) {
+	planetServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-request.Context().Done():
+		case <-time.After(time.Second):
+			writer.Write([]byte(testingSampleSearchResult))
+		}
+	}))
+	defer planetServer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	context := Context{BasePlanetURL: planetServer.URL, PlanetKey: testingValidKey, Caching: NewCacheSettings(10, time.Minute, time.Minute)}
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := GetScenes(ctx, SearchOptions{ItemType: "REOrthoTile"}, &context)
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "Expected the search to be abandoned")
+	if assert.IsType(t, util.HTTPErr{}, err) {
+		assert.Equal(t, util.StatusClientClosedRequest, err.(util.HTTPErr).Status)
+	}
+	assert.Equal(t, 0, context.Caching.Cache.Stats().Entries, "Expected nothing to be cached")
+}
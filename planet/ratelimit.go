@@ -0,0 +1,100 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planet
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/ratelimit"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// Defaults for the limit on requests to Planet Labs
+const (
+	DefaultPlanetRate    = 10 // requests per second
+	DefaultPlanetBurst   = 10
+	DefaultPlanetMaxWait = 10 * time.Second
+)
+
+const defaultPlanetRetryAfter = time.Second
+
+// RateLimitSettings limit the requests made to Planet Labs by all
+// handlers together, so that no one client can exhaust our quota
+type RateLimitSettings struct {
+	Bucket  *ratelimit.Bucket // if nil, requests are not limited
+	MaxWait time.Duration     // the longest a request waits for its turn
+}
+
+var (
+	defaultRateLimit     RateLimitSettings
+	defaultRateLimitOnce sync.Once
+)
+
+// defaultRateLimitSettings returns the limit used until Configure is
+// called, created the first time it is needed
+func defaultRateLimitSettings() RateLimitSettings {
+	defaultRateLimitOnce.Do(func() {
+		defaultRateLimit = NewRateLimitSettings(DefaultPlanetRate, DefaultPlanetBurst, DefaultPlanetMaxWait)
+	})
+	return defaultRateLimit
+}
+
+// NewRateLimitSettings creates a limit of rate requests per second, in bursts
+// of up to burst requests; a rate of zero disables it
+func NewRateLimitSettings(rate float64, burst int, maxWait time.Duration) RateLimitSettings {
+	result := RateLimitSettings{MaxWait: maxWait}
+	if rate > 0 {
+		result.Bucket = ratelimit.NewBucket(rate, burst)
+	} else {
+		util.LogInfo(&util.BasicLogContext{}, "Planet Labs rate limiting is disabled")
+	}
+	return result
+}
+
+// waitForPlanet waits for a turn to make a request to Planet Labs.
+// If the wait would be too long, it fails with a 429 instead.
+func (c *Context) waitForPlanet(ctx context.Context) error {
+	if c.RateLimit.Bucket == nil {
+		return nil
+	}
+	wait, ok := c.RateLimit.Bucket.Reserve(time.Now(), c.RateLimit.MaxWait)
+	if !ok {
+		message := "Too many requests to Planet Labs; please retry later."
+		util.LogAlert(c, message)
+		return util.HTTPErr{Status: http.StatusTooManyRequests, Message: message, RetryAfter: wait}
+	}
+	return util.Sleep(ctx, wait)
+}
+
+// planetThrottled holds back further requests for as long as
+// Planet Labs asks, after it responds with a 429
+func (c *Context) planetThrottled(response *http.Response) {
+	retryAfter := retryAfter(response)
+	if retryAfter == 0 {
+		retryAfter = defaultPlanetRetryAfter
+	}
+	util.LogAlert(c, fmt.Sprintf("Planet Labs is throttling requests; pausing for %v", retryAfter))
+	if c.RateLimit.Bucket != nil {
+		c.RateLimit.Bucket.BlockUntil(time.Now().Add(retryAfter))
+	}
+}
+
+func retryAfter(response *http.Response) time.Duration {
+	return util.ParseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+}
@@ -0,0 +1,88 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/ratelimit"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+func TestWaitForPlanet(t *testing.T) {
+	ctx := context.Background()
+	context := Context{RateLimit: RateLimitSettings{Bucket: ratelimit.NewBucket(1, 1), MaxWait: 0}}
+	assert.Nil(t, context.waitForPlanet(ctx))
+
+	err := context.waitForPlanet(ctx)
+	if assert.IsType(t, util.HTTPErr{}, err) {
+		herr := err.(util.HTTPErr)
+		assert.Equal(t, http.StatusTooManyRequests, herr.Status)
+		assert.True(t, herr.RetryAfter > 0)
+	}
+
+	context.RateLimit = RateLimitSettings{}
+	assert.Nil(t, context.waitForPlanet(ctx))
+}
+
+func TestWaitForPlanetCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	context := Context{RateLimit: RateLimitSettings{Bucket: ratelimit.NewBucket(1, 1), MaxWait: time.Minute}}
+	assert.Nil(t, context.waitForPlanet(ctx))
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := context.waitForPlanet(ctx)
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "Expected the wait to end when the request was canceled")
+	if assert.IsType(t, util.HTTPErr{}, err) {
+		assert.Equal(t, util.StatusClientClosedRequest, err.(util.HTTPErr).Status)
+	}
+}
+
+func TestPlanetThrottled(t *testing.T) {
+	requests := 0
+	planetServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		writer.Header().Set("Retry-After", "30")
+		writer.WriteHeader(http.StatusTooManyRequests)
+		writer.Write([]byte("Slow down"))
+	}))
+	defer planetServer.Close()
+	ctx := context.Background()
+	context := Context{
+		BasePlanetURL: planetServer.URL,
+		PlanetKey:     testingValidKey,
+		RateLimit:     RateLimitSettings{Bucket: ratelimit.NewBucket(10, 10), MaxWait: time.Second},
+	}
+
+	_, err := GetScenes(ctx, SearchOptions{ItemType: "REOrthoTile"}, &context)
+	if assert.IsType(t, util.HTTPErr{}, err) {
+		herr := err.(util.HTTPErr)
+		assert.Equal(t, http.StatusTooManyRequests, herr.Status)
+		assert.Equal(t, 30*time.Second, herr.RetryAfter)
+	}
+
+	// Further requests are held back rather than sent
+	_, err = GetScenes(ctx, SearchOptions{ItemType: "REOrthoTile"}, &context)
+	if assert.IsType(t, util.HTTPErr{}, err) {
+		assert.Equal(t, http.StatusTooManyRequests, err.(util.HTTPErr).Status)
+	}
+	assert.Equal(t, 1, requests)
+}
@@ -0,0 +1,99 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planet
+
+import (
+	"sync"
+
+	"github.com/venicegeo/dg-bf-ia-broker/tides"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// Default upstream services
+const (
+	DefaultAPIURL   = "https://api.planet.com"
+	DefaultTidesURL = "https://bf-tideprediction.int.geointservices.io/tides"
+)
+
+// Settings configure the Contexts created for handlers
+type Settings struct {
+	APIURL                  string
+	TidesURL                string
+	TideSource              string // a name or comma-separated names for tides.NewSource
+	TideOptions             tides.SourceOptions
+	Credentials             CredentialSettings
+	Caching                 CacheSettings
+	RateLimit               RateLimitSettings
+	DisablePermissionsCheck bool
+}
+
+var (
+	settingsMutex      sync.RWMutex
+	configuredSettings *Settings
+)
+
+// Configure sets the settings for every Context created from now on.
+// Until it is called, the defaults are used.
+func Configure(settings Settings) {
+	settings.Credentials.register()
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	configuredSettings = &settings
+	disablePermissionsCheck = settings.DisablePermissionsCheck
+	if disablePermissionsCheck {
+		util.LogInfo(&util.BasicLogContext{}, "Disabling Planet Labs permissions check")
+	}
+}
+
+// CurrentSettings returns the configured settings, or else the defaults
+func CurrentSettings() Settings {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	if configuredSettings != nil {
+		return *configuredSettings
+	}
+	return DefaultSettings()
+}
+
+// DefaultSettings returns the settings used until Configure is called. The
+// defaults share one cache and one rate limit.
+func DefaultSettings() Settings {
+	return Settings{
+		APIURL:      DefaultAPIURL,
+		TidesURL:    DefaultTidesURL,
+		TideSource:  tides.ServiceSourceName,
+		Credentials: CredentialSettings{AllowQueryKey: true},
+		Caching:     defaultCacheSettings(),
+		RateLimit:   defaultRateLimitSettings(),
+	}
+}
+
+// permissionsCheckDisabled reports whether scenes are returned even when
+// the key cannot download them
+func permissionsCheckDisabled() bool {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	return disablePermissionsCheck
+}
+
+// currentCaching returns the cache without reading anything else
+func currentCaching() CacheSettings {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	if configuredSettings != nil {
+		return configuredSettings.Caching
+	}
+	return defaultCacheSettings()
+}
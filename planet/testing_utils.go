@@ -0,0 +1,91 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planet
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// MockSearchServer is a mocked Planet Labs server for searches. Its first
+// page of results links to a second, final page, and it records the last
+// request it receives.
+// This is exported because it is needed in testing the stac and ogc modules
+type MockSearchServer struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	lastRequest *http.Request
+	lastBody    string
+}
+
+// CreateMockSearchServer creates a mocked Planet Labs server that serves
+// the sample search results in testdata
+func CreateMockSearchServer() *MockSearchServer {
+	_, filename, _, _ := runtime.Caller(0)
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), "testdata", "testingSampleSearchResult.json"))
+	if err != nil {
+		panic(err)
+	}
+	result := &MockSearchServer{}
+	router := mux.NewRouter()
+	router.HandleFunc("/data/v1/quick-search", func(writer http.ResponseWriter, request *http.Request) {
+		result.record(request)
+		next := `{"_links":{"_next":"` + result.URL + `/data/v1/searches/abc/results?_page=2"},`
+		writer.Write([]byte(strings.Replace(string(data), "{", next, 1)))
+	})
+	router.HandleFunc("/data/v1/searches/abc/results", func(writer http.ResponseWriter, request *http.Request) {
+		result.record(request)
+		writer.Write(data)
+	})
+	result.Server = httptest.NewServer(router)
+	return result
+}
+
+func (s *MockSearchServer) record(request *http.Request) {
+	body, _ := ioutil.ReadAll(request.Body)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastRequest, s.lastBody = request, string(body)
+}
+
+// LastRequest returns the last request the server received
+func (s *MockSearchServer) LastRequest() *http.Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastRequest
+}
+
+// LastBody returns the body of the last request the server received
+func (s *MockSearchServer) LastBody() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastBody
+}
+
+// Settings returns the default settings, pointed at the server. Tests should
+// not wait their turn for it, so requests to it are not limited.
+func (s *MockSearchServer) Settings() Settings {
+	settings := DefaultSettings()
+	settings.APIURL = s.URL
+	settings.RateLimit = RateLimitSettings{}
+	return settings
+}
@@ -19,6 +19,7 @@ const testingValidKey = "VALID_KEY"
 const testingValidItemID = "foobar123"
 const testingValidSentinelID = "S2A_MSIL1C_20160513T183921_N0204_R070_T11SKD_20160513T185132"
 const testingValidItemType = "REOrthoTile"
+const testingSearchID = "abc123"
 
 var testingSampleSearchResult string
 var testingSampleFeatureResult string
@@ -101,14 +102,32 @@ func createMockPlanetAPIServer() (server *httptest.Server) {
 	router.HandleFunc("/data/v1/quick-search", func(writer http.ResponseWriter, request *http.Request) {
 		request.Header.Write(os.Stdout)
 		if testingCheckAuthorization(request.Header.Get("Authorization")) {
+			// Results continue on a second page
+			next := `{"_links":{"_next":"` + server.URL + `/data/v1/searches/` + testingSearchID + `/results?_page=2"},`
 			writer.WriteHeader(200)
-			writer.Write([]byte(testingSampleSearchResult))
+			writer.Write([]byte(strings.Replace(testingSampleSearchResult, "{", next, 1)))
 		} else {
 			writer.WriteHeader(401)
 			writer.Write([]byte("Unauthorized"))
 		}
 	})
 
+	router.HandleFunc("/data/v1/searches/{searchID}/results", func(writer http.ResponseWriter, request *http.Request) {
+		request.Header.Write(os.Stdout)
+		if !testingCheckAuthorization(request.Header.Get("Authorization")) {
+			writer.WriteHeader(401)
+			writer.Write([]byte("Unauthorized"))
+			return
+		}
+		if mux.Vars(request)["searchID"] != testingSearchID || request.FormValue("_page") != "2" {
+			writer.WriteHeader(404)
+			writer.Write([]byte("Not found"))
+			return
+		}
+		writer.WriteHeader(200)
+		writer.Write([]byte(testingSampleSearchResult))
+	})
+
 	router.HandleFunc("/data/v1/item-types/{itemType}/items/{itemID}", func(writer http.ResponseWriter, request *http.Request) {
 		request.Header.Write(os.Stdout)
 		if !testingCheckAuthorization(request.Header.Get("Authorization")) {
@@ -171,12 +190,22 @@ func createMockPlanetAPIServer() (server *httptest.Server) {
 	return
 }
 
+// testingSettings point at the mock servers. Tests should not wait their
+// turn for the mock Planet server, so requests to it are not limited.
+func testingSettings(planetAPIURL string, tidesAPIURL string) Settings {
+	settings := DefaultSettings()
+	settings.APIURL = planetAPIURL
+	settings.TidesURL = tidesAPIURL
+	settings.RateLimit = RateLimitSettings{}
+	settings.DisablePermissionsCheck = true
+	return settings
+}
+
 // createTestRouter creates a router for testing use only,
 // providing a way mock a server for the handlers being tested
 // to live in
-func createTestRouter(planetAPIURL string, tidesAPIURL string) *mux.Router {
-	os.Setenv("PL_API_URL", planetAPIURL)
-	os.Setenv("BF_TIDE_PREDICTION_URL", tidesAPIURL)
+func createTestRouter(settings Settings) *mux.Router {
+	Configure(settings)
 	router := mux.NewRouter()
 	router.Handle("/planet/discover/{itemType}", NewDiscoverHandler())
 	router.Handle("/planet/activate/{itemType}/{id}", NewActivateHandler())
@@ -187,6 +216,17 @@ func createTestRouter(planetAPIURL string, tidesAPIURL string) *mux.Router {
 func createTestFixtures() (mockPlanet *httptest.Server, mockTides *httptest.Server, testRouter *mux.Router) {
 	mockPlanet = createMockPlanetAPIServer()
 	mockTides = tides.CreateMockTidesServer()
-	testRouter = createTestRouter(mockPlanet.URL, mockTides.URL)
+	testRouter = createTestRouter(testingSettings(mockPlanet.URL, mockTides.URL))
+	return
+}
+
+// createHarmonicTestFixtures is createTestFixtures with tides predicted
+// from the test constituents
+func createHarmonicTestFixtures() (mockPlanet *httptest.Server, testRouter *mux.Router) {
+	mockPlanet = createMockPlanetAPIServer()
+	settings := testingSettings(mockPlanet.URL, "")
+	settings.TideSource = tides.HarmonicSourceName
+	settings.TideOptions.StationsFile = "../tides/testdata/constituents.json"
+	testRouter = createTestRouter(settings)
 	return
 }
@@ -0,0 +1,119 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket: it holds up to a burst of tokens, refilled at a
+// steady rate, and each request takes one
+type Bucket struct {
+	rate         float64 // tokens per second
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	mutex        sync.Mutex
+}
+
+// Status describes a bucket after an attempt to take a token
+type Status struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until a token is available, if none was
+}
+
+// NewBucket creates a full Bucket
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// refill adds the tokens earned since the last call
+func (b *Bucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+// untilTokens returns how long until the bucket holds the given number of tokens
+func (b *Bucket) untilTokens(tokens float64, now time.Time) time.Duration {
+	result := time.Duration((tokens - b.tokens) / b.rate * float64(time.Second))
+	if b.blockedUntil.After(now) && b.blockedUntil.Sub(now) > result {
+		result = b.blockedUntil.Sub(now)
+	}
+	if result < 0 {
+		return 0
+	}
+	return result
+}
+
+// Take takes a token if one is available
+func (b *Bucket) Take(now time.Time) Status {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(now)
+	result := Status{Limit: int(b.burst)}
+	if b.tokens >= 1 && !b.blockedUntil.After(now) {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = b.untilTokens(1, now)
+	}
+	result.Remaining = int(math.Max(0, math.Floor(b.tokens)))
+	result.Reset = b.untilTokens(b.burst, now)
+	return result
+}
+
+// Reserve takes a token, borrowing against the future if there is none,
+// and returns how long the caller must wait before using it. If that would
+// be longer than maxWait, nothing is taken and false is returned.
+func (b *Bucket) Reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(now)
+	wait := b.untilTokens(1, now)
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// BlockUntil gives out no tokens before the given time, as when
+// an upstream service has asked us to retry later
+func (b *Bucket) BlockUntil(until time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// full reports whether the bucket has refilled completely
+func (b *Bucket) full(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(now)
+	return b.tokens >= b.burst && !b.blockedUntil.After(now)
+}
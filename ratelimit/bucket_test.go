@@ -0,0 +1,78 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testingNow = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestBucketTake(t *testing.T) {
+	bucket := NewBucket(2, 3)
+	for i := 2; i >= 0; i-- {
+		status := bucket.Take(testingNow)
+		assert.True(t, status.Allowed)
+		assert.Equal(t, 3, status.Limit)
+		assert.Equal(t, i, status.Remaining)
+	}
+	status := bucket.Take(testingNow)
+	assert.False(t, status.Allowed)
+	assert.Equal(t, 500*time.Millisecond, status.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, status.Reset)
+
+	// Half a second earns another token
+	status = bucket.Take(testingNow.Add(500 * time.Millisecond))
+	assert.True(t, status.Allowed)
+	assert.Equal(t, 0, status.Remaining)
+
+	// Never more than the burst
+	assert.True(t, bucket.full(testingNow.Add(time.Hour)))
+	assert.Equal(t, 2, bucket.Take(testingNow.Add(time.Hour)).Remaining)
+}
+
+func TestBucketReserve(t *testing.T) {
+	bucket := NewBucket(1, 1)
+	wait, ok := bucket.Reserve(testingNow, time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+
+	wait, ok = bucket.Reserve(testingNow, time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// The second token was borrowed, so the next is two seconds away
+	wait, ok = bucket.Reserve(testingNow, time.Second)
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+}
+
+func TestBucketBlockUntil(t *testing.T) {
+	bucket := NewBucket(10, 10)
+	bucket.BlockUntil(testingNow.Add(5 * time.Second))
+	status := bucket.Take(testingNow)
+	assert.False(t, status.Allowed)
+	assert.Equal(t, 5*time.Second, status.RetryAfter)
+	assert.False(t, bucket.full(testingNow))
+
+	wait, ok := bucket.Reserve(testingNow, 10*time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, wait)
+
+	assert.True(t, bucket.Take(testingNow.Add(5*time.Second)).Allowed)
+}
@@ -0,0 +1,129 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/auth"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// Defaults for the limit on each client
+const (
+	DefaultRate  = 5 // requests per second
+	DefaultBurst = 20
+)
+
+// sweepInterval is how often buckets that have refilled are discarded
+const sweepInterval = time.Minute
+
+// Limiter limits the rate of requests from each client, with a bucket per client
+type Limiter struct {
+	rate      float64
+	burst     int
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+	mutex     sync.Mutex
+	now       func() time.Time
+}
+
+// NewLimiter creates a Limiter giving each client rate requests per second,
+// in bursts of up to burst requests. A rate of zero disables limiting and
+// nil is returned.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		util.LogInfo(&util.BasicLogContext{}, "Client rate limiting is disabled")
+		return nil
+	}
+	return &Limiter{rate: rate, burst: burst, buckets: make(map[string]*Bucket), now: time.Now}
+}
+
+// Limit wraps a handler so that clients over their limit receive a 429.
+// Every response carries RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers. A nil Limiter limits nothing.
+func (l *Limiter) Limit(handler http.Handler) http.Handler {
+	if l == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == "OPTIONS" {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		client := ClientID(request)
+		status := l.bucket(client).Take(l.now())
+		writer.Header().Set("RateLimit-Limit", strconv.Itoa(status.Limit))
+		writer.Header().Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+		writer.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(status.Reset)))
+		if !status.Allowed {
+			context := util.NewRequestLogContext(request.Context())
+			util.LogAlert(context, fmt.Sprintf("Rate limited %v %v from %v", request.Method, request.URL.Path, client))
+			util.WriteHTTPErr(request, writer, context, util.HTTPErr{
+				Status:     http.StatusTooManyRequests,
+				Message:    "Too many requests; please retry later.",
+				RetryAfter: status.RetryAfter,
+			})
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// bucket returns the client's bucket, creating it if needed
+func (l *Limiter) bucket(client string) *Bucket {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		for key, bucket := range l.buckets {
+			if bucket.full(now) {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+	result, ok := l.buckets[client]
+	if !ok {
+		result = NewBucket(l.rate, l.burst)
+		l.buckets[client] = result
+	}
+	return result
+}
+
+// ClientID identifies the client making a request: the authenticated user,
+// or else its address. Unvalidated credentials, such as Planet Labs keys, are
+// not used, since a client could send a new one with each request.
+func ClientID(request *http.Request) string {
+	if principal, ok := auth.FromRequest(request); ok && principal.User != "" {
+		return "user:" + principal.User
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	return "address:" + host
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,124 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/auth"
+)
+
+func createTestLimiter() *Limiter {
+	limiter := NewLimiter(1, 2)
+	limiter.now = func() time.Time { return testingNow }
+	return limiter
+}
+
+func limitedRequest(limiter *Limiter, request *http.Request) *httptest.ResponseRecorder {
+	writer := httptest.NewRecorder()
+	limiter.Limit(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})).ServeHTTP(writer, request)
+	return writer
+}
+
+func TestLimit(t *testing.T) {
+	limiter := createTestLimiter()
+	request := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+
+	writer := limitedRequest(limiter, request)
+	assert.Equal(t, http.StatusOK, writer.Code)
+	assert.Equal(t, "2", writer.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", writer.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", writer.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, limitedRequest(limiter, request).Code)
+	writer = limitedRequest(limiter, request)
+	assert.Equal(t, http.StatusTooManyRequests, writer.Code)
+	assert.Equal(t, "1", writer.Header().Get("Retry-After"))
+	assert.Equal(t, "0", writer.Header().Get("RateLimit-Remaining"))
+
+	// Other clients have their own limits
+	other := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+	other.RemoteAddr = "192.0.2.2:1234"
+	assert.Equal(t, http.StatusOK, limitedRequest(limiter, other).Code)
+
+	// Preflight requests are never limited
+	assert.Equal(t, http.StatusOK, limitedRequest(limiter, httptest.NewRequest("OPTIONS", "/planet/discover/rapideye", nil)).Code)
+
+	limiter.now = func() time.Time { return testingNow.Add(time.Second) }
+	assert.Equal(t, http.StatusOK, limitedRequest(limiter, request).Code)
+}
+
+func TestLimitRotatingKeys(t *testing.T) {
+	limiter := createTestLimiter()
+	var writer *httptest.ResponseRecorder
+	for inx := 0; inx < 3; inx++ {
+		request := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		request.Header.Set("X-Planet-Key", fmt.Sprintf("KEY_%v", inx))
+		writer = limitedRequest(limiter, request)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, writer.Code, "Expected a new key with each request not to escape the limit")
+}
+
+func TestLimitNil(t *testing.T) {
+	var limiter *Limiter
+	writer := limitedRequest(limiter, httptest.NewRequest("GET", "/planet/discover/rapideye", nil))
+	assert.Equal(t, http.StatusOK, writer.Code)
+	assert.Equal(t, "", writer.Header().Get("RateLimit-Limit"))
+}
+
+func TestLimiterSweep(t *testing.T) {
+	limiter := createTestLimiter()
+	limiter.bucket("address:192.0.2.1").Take(testingNow)
+	limiter.bucket("address:192.0.2.2")
+	assert.Len(t, limiter.buckets, 2)
+	limiter.now = func() time.Time { return testingNow.Add(2 * sweepInterval) }
+	limiter.bucket("address:192.0.2.3")
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestClientID(t *testing.T) {
+	request := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "address:192.0.2.1", ClientID(request))
+
+	request.Header.Set("X-Planet-Key", "CLIENT_KEY")
+	assert.Equal(t, "address:192.0.2.1", ClientID(request), "Expected an unvalidated key to be ignored")
+
+	var id string
+
+	authenticator, err := auth.New(auth.Config{Tokens: []auth.StaticToken{{Token: "reader-token", User: "reader", Roles: []string{auth.RoleRead}}}})
+	assert.Nil(t, err)
+	request.Header.Set("Authorization", "Bearer reader-token")
+	authenticator.Require(auth.RoleRead, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id = ClientID(request)
+	})).ServeHTTP(httptest.NewRecorder(), request)
+	assert.Equal(t, "user:reader", id)
+}
+
+func TestNewLimiter(t *testing.T) {
+	limiter := NewLimiter(0.5, 4)
+	assert.Equal(t, 0.5, limiter.rate)
+	assert.Equal(t, 4, limiter.burst)
+	assert.Nil(t, NewLimiter(0, 4))
+}
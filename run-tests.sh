@@ -2,7 +2,17 @@
 
 go test -cover \
   github.com/venicegeo/dg-bf-ia-broker \
+  github.com/venicegeo/dg-bf-ia-broker/auth \
+  github.com/venicegeo/dg-bf-ia-broker/cache \
+  github.com/venicegeo/dg-bf-ia-broker/config \
+  github.com/venicegeo/dg-bf-ia-broker/encoder \
   github.com/venicegeo/dg-bf-ia-broker/landsat \
+  github.com/venicegeo/dg-bf-ia-broker/lifecycle \
+  github.com/venicegeo/dg-bf-ia-broker/metrics \
+  github.com/venicegeo/dg-bf-ia-broker/ogc \
   github.com/venicegeo/dg-bf-ia-broker/planet \
+  github.com/venicegeo/dg-bf-ia-broker/ratelimit \
+  github.com/venicegeo/dg-bf-ia-broker/stac \
   github.com/venicegeo/dg-bf-ia-broker/tides \
+  github.com/venicegeo/dg-bf-ia-broker/trace \
   github.com/venicegeo/dg-bf-ia-broker/util
@@ -15,35 +15,247 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/venicegeo/dg-bf-ia-broker/auth"
+	"github.com/venicegeo/dg-bf-ia-broker/config"
 	"github.com/venicegeo/dg-bf-ia-broker/landsat"
+	"github.com/venicegeo/dg-bf-ia-broker/lifecycle"
+	"github.com/venicegeo/dg-bf-ia-broker/metrics"
+	"github.com/venicegeo/dg-bf-ia-broker/ogc"
 	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/ratelimit"
+	"github.com/venicegeo/dg-bf-ia-broker/stac"
+	"github.com/venicegeo/dg-bf-ia-broker/tides"
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
 	"github.com/venicegeo/dg-bf-ia-broker/util"
 )
 
-var launchServer = func(portStr string, router *mux.Router) {
-	http.Handle("/", router)
-	log.Fatal(http.ListenAndServe(portStr, nil))
+var launchServer = func(manager *lifecycle.Manager, server *http.Server) {
+	if err := manager.Run(server, syscall.SIGTERM, syscall.SIGINT); err != nil {
+		util.LogAlert(&util.BasicLogContext{}, "Server stopped: "+err.Error())
+		util.FlushLogs()
+		os.Exit(1)
+	}
 }
 
-func serve() {
-	portStr := ":8080"
+// broker serves routes built from its configuration. Reloading the
+// configuration swaps in new routes; requests already being served finish
+// with the routes they started with.
+type broker struct {
+	flags   *pflag.FlagSet
+	context util.LogContext
+	manager *lifecycle.Manager
+	mutex   sync.Mutex // held while reloading
+	config  config.Config
+	limiter *ratelimit.Limiter
+	router  atomic.Value // *mux.Router
+	reloads reloadStatus
+}
+
+// reloadStatus remembers the outcome of the last configuration reload, so
+// that the readiness report can show it without reading the file again
+type reloadStatus struct {
+	mutex sync.Mutex
+	at    time.Time
+	err   error
+}
+
+func (status *reloadStatus) record(err error) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.at = time.Now()
+	status.err = err
+}
+
+func (status *reloadStatus) details() map[string]interface{} {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	if status.at.IsZero() {
+		return map[string]interface{}{"lastReload": "none"}
+	}
+	details := map[string]interface{}{"lastReload": status.at.UTC().Format(time.RFC3339)}
+	if status.err != nil {
+		details["rejected"] = status.err.Error()
+	}
+	return details
+}
+
+// fatal logs the error and exits, flushing the logs first since log.Fatal
+// skips deferred calls
+func fatal(context util.LogContext, message string, err error) {
+	err = util.LogSimpleErr(context, message, err)
+	util.FlushLogs()
+	log.Fatal(err)
+}
+
+func serve(cfg config.Config, flags *pflag.FlagSet) {
+	if err := cfg.Apply(); err != nil {
+		fatal(&util.BasicLogContext{}, "Failed to apply configuration: ", err)
+	}
+	manager := lifecycle.New(cfg.Server.ShutdownTimeout)
+	manager.ShutdownDelay = cfg.Server.ShutdownDelay
+	b := &broker{flags: flags, context: &(util.BasicLogContext{}), manager: manager, config: cfg}
+	authenticator, err := auth.FromFile(cfg.Auth.ConfigFile)
+	if err != nil {
+		fatal(b.context, "Failed to configure authentication: ", err)
+	}
+	b.limiter = ratelimit.NewLimiter(cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+	b.router.Store(b.newRouter(cfg, authenticator))
+	addHealthChecks(manager, &b.reloads)
+	// Closing the exporter sends the spans it still holds
+	manager.OnStop(func() { trace.SetExporter(nil, 1) })
+
+	manager.Go("configuration reloads", func(stop <-chan struct{}) {
+		hangups := make(chan os.Signal, 1)
+		signal.Notify(hangups, syscall.SIGHUP)
+		defer signal.Stop(hangups)
+		for {
+			select {
+			case <-hangups:
+				b.reload()
+			case <-stop:
+				return
+			}
+		}
+	})
+	manager.Go("scene map updates", func(stop <-chan struct{}) {
+		landsat.RunSceneMapUpdates(cfg.Landsat.RefreshInterval, stop, b.context)
+	})
+	launchServer(manager, &http.Server{Addr: fmt.Sprintf(":%d", cfg.Server.Port), Handler: util.WithRequestID(b)})
+}
+
+// addHealthChecks reports on the broker's dependencies in /health/ready.
+// The checks read the settings in use, so they follow reloads.
+func addHealthChecks(manager *lifecycle.Manager, reloads *reloadStatus) {
+	probe := func(profile string, address func(planet.Settings) string) lifecycle.Check {
+		return func(ctx context.Context) (map[string]interface{}, error) {
+			url := address(planet.CurrentSettings())
+			if url == "" {
+				return map[string]interface{}{"skipped": "not in use"}, nil
+			}
+			status, err := util.Probe(ctx, profile, url)
+			return map[string]interface{}{"url": url, "httpStatus": status}, err
+		}
+	}
+	// Tide sources are tried in turn, so only those configured are checked
+	usesTideSource := func(settings planet.Settings, name string) bool {
+		for _, source := range strings.Split(settings.TideSource, ",") {
+			source = strings.TrimSpace(source)
+			if source == name || (source == "" && name == tides.ServiceSourceName) {
+				return true
+			}
+		}
+		return false
+	}
+	manager.AddCheck("planet", probe(util.PlanetProfile, func(settings planet.Settings) string { return settings.APIURL }))
+	manager.AddCheck("tides", probe(util.TidesProfile, func(settings planet.Settings) string {
+		if !usesTideSource(settings, tides.ServiceSourceName) {
+			return ""
+		}
+		return settings.TidesURL
+	}))
+	manager.AddCheck("noaa", probe(util.TidesProfile, func(settings planet.Settings) string {
+		if !usesTideSource(settings, tides.NOAASourceName) {
+			return ""
+		}
+		if settings.TideOptions.NOAAURL == "" {
+			return tides.DefaultNOAAURL
+		}
+		return settings.TideOptions.NOAAURL
+	}))
+	manager.AddCheck("landsat", func(ctx context.Context) (map[string]interface{}, error) {
+		age, ok := landsat.SceneMapAge()
+		if !ok {
+			return nil, errors.New("The Landsat scene map has not been loaded yet")
+		}
+		return map[string]interface{}{"ageSeconds": math.Round(age.Seconds())}, nil
+	})
+	// The configuration in use was valid when it was loaded, so a rejected
+	// reload is reported without failing the check; the file is only read
+	// again when a reload is asked for
+	manager.AddCheck("config", func(ctx context.Context) (map[string]interface{}, error) {
+		return reloads.details(), nil
+	})
+}
+
+// ServeHTTP implements the http.Handler interface for the broker type
+func (b *broker) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	b.router.Load().(*mux.Router).ServeHTTP(writer, request)
+}
+
+func (b *broker) newRouter(cfg config.Config, authenticator *auth.Authenticator) *mux.Router {
 	router := mux.NewRouter()
+	limiter := b.limiter
 
-	context := &(util.BasicLogContext{})
+	// Each route's requests are counted and timed under its path
+	handle := func(path string, handler http.Handler) *mux.Route {
+		return router.Handle(path, metrics.InstrumentHandler(path, handler))
+	}
+	// Users are limited once they are known, so the limit follows them.
+	// The deadline starts once a request is let through.
+	route := func(path, role string, handler http.Handler) *mux.Route {
+		return handle(path, trace.Handler(path, authenticator.Require(role, limiter.Limit(util.WithTimeout(cfg.Server.RequestTimeout, handler)))))
+	}
 
-	router.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+	// Health checks and metrics are left open so that the platform can
+	// collect them, and untraced so that its polling does not fill traces
+	handle("/health/live", b.manager.LiveHandler())
+	handle("/health/ready", b.manager.ReadyHandler())
+	handle("/metrics", metrics.Handler())
+	handle("/", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		context := util.NewRequestLogContext(request.Context())
 		util.LogAudit(context, util.LogAuditInput{Actor: "anon user", Action: request.Method, Actee: request.URL.String(), Message: "Receiving / request", Severity: util.INFO})
 		util.LogAudit(context, util.LogAuditInput{Actor: request.URL.String(), Action: request.Method + " response", Actee: "anon user", Message: "Sending / response", Severity: util.INFO})
-	})
-	router.Handle("/planet/discover/{itemType}", planet.NewDiscoverHandler())
-	router.Handle("/planet/{itemType}/{id}", planet.NewMetadataHandler())
-	router.Handle("/planet/activate/{itemType}/{id}", planet.NewActivateHandler())
+	}))
+	route("/cache/stats", auth.RoleAdmin, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		stats := planet.CacheStats()
+		writer.Header().Set("Content-Type", "application/json")
+		util.PrintJSON(writer, map[string]interface{}{"planet": stats, "planetHitRatio": stats.HitRatio()}, http.StatusOK)
+	}))
+	route("/circuits", auth.RoleAdmin, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		util.PrintJSON(writer, util.BreakerStates(), http.StatusOK)
+	}))
+	route("/config/reload", auth.RoleAdmin, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		changes, err := b.reload()
+		if err != nil {
+			util.HTTPError(request, writer, util.NewRequestLogContext(request.Context()), err.Error(), http.StatusBadRequest)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		util.PrintJSON(writer, map[string]interface{}{"changes": changes}, http.StatusOK)
+	})).Methods("POST")
+	route("/planet/discover/{itemType}", auth.RoleRead, planet.NewDiscoverHandler())
+	route("/planet/{itemType}/{id}", auth.RoleRead, planet.NewMetadataHandler())
+	route("/planet/activate/{itemType}/{id}", auth.RoleActivate, planet.NewActivateHandler())
+	route(stac.Root, auth.RoleRead, stac.NewLandingHandler())
+	route(stac.Root+"/conformance", auth.RoleRead, stac.NewConformanceHandler())
+	route(stac.Root+"/collections", auth.RoleRead, stac.NewCollectionsHandler())
+	route(stac.Root+"/collections/{collectionId}", auth.RoleRead, stac.NewCollectionsHandler())
+	route(stac.Root+"/search", auth.RoleRead, stac.NewSearchHandler())
+	route(ogc.Root, auth.RoleRead, ogc.NewLandingHandler())
+	route(ogc.Root+"/conformance", auth.RoleRead, ogc.NewConformanceHandler())
+	route(ogc.Root+"/collections", auth.RoleRead, ogc.NewCollectionsHandler())
+	route(ogc.Root+"/collections/{itemType}", auth.RoleRead, ogc.NewCollectionsHandler())
+	route(ogc.Root+"/collections/{itemType}/items", auth.RoleRead, ogc.NewItemsHandler())
+	route(ogc.Root+"/wfs", auth.RoleRead, ogc.NewWFSHandler())
+	router.NotFoundHandler = metrics.InstrumentHandler("unmatched", http.NotFoundHandler())
 
 	// 	case "/help":
 	// 		fmt.Fprintf(writer, "We're sorry, help is not yet implemented.\n")
@@ -51,9 +263,43 @@ func serve() {
 	// 		fmt.Fprintf(writer, "Command undefined. \n")
 	// 	}
 	// })
+	return router
+}
+
+// reload reads the configuration again and, if it is valid, serves new
+// routes built from it. It returns the settings that changed.
+func (b *broker) reload() ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	next, err := config.Load(b.flags)
+	changes := next.Changes(b.config)
+	var authenticator *auth.Authenticator
+	if err == nil {
+		authenticator, err = auth.FromFile(next.Auth.ConfigFile)
+	}
+	if err == nil {
+		err = next.ApplyChanges(b.config)
+	}
+	b.reloads.record(err)
+	if err != nil {
+		util.LogAlert(b.context, fmt.Sprintf("Rejected configuration reload: %v. Changes: %v", err, describeChanges(changes)))
+		return changes, err
+	}
+	if next.RateLimit != b.config.RateLimit {
+		b.limiter = ratelimit.NewLimiter(next.RateLimit.Rate, next.RateLimit.Burst)
+	}
+	// The new handlers take their contexts from the settings just applied
+	b.router.Store(b.newRouter(next, authenticator))
+	b.config = next
+	util.LogInfo(b.context, "Reloaded configuration. Changes: "+describeChanges(changes))
+	return changes, nil
+}
 
-	go landsat.UpdateSceneMapOnTicker(30*time.Minute, context)
-	launchServer(portStr, router)
+func describeChanges(changes []string) string {
+	if len(changes) == 0 {
+		return "none"
+	}
+	return strings.Join(changes, "; ")
 }
 
 var serveCmd = &cobra.Command{
@@ -62,6 +308,14 @@ var serveCmd = &cobra.Command{
 	Long: `
 Serve the image archive broker`,
 	Run: func(cmd *cobra.Command, args []string) {
-		serve()
+		cfg, err := config.Load(cmd.Flags())
+		if err != nil {
+			fatal(&util.BasicLogContext{}, "Failed to load configuration: ", err)
+		}
+		serve(cfg, cmd.Flags())
 	},
 }
+
+func init() {
+	config.AddFlags(serveCmd.Flags())
+}
@@ -2,15 +2,25 @@ package main
 
 import (
 	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
-	"github.com/gorilla/mux"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/config"
 	"github.com/venicegeo/dg-bf-ia-broker/landsat"
+	"github.com/venicegeo/dg-bf-ia-broker/lifecycle"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
 )
 
 const badLandSatID = "X_NOT_LANDSAT_X"
@@ -31,22 +41,28 @@ func (h mockAWSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	gzipWriter.Close()
 }
 
+var testingConfig config.Config
+
 func TestMain(m *testing.M) {
 	mockAWSServer := httptest.NewServer(mockAWSHandler{})
 	defer mockAWSServer.Close()
 	os.Setenv("LANDSAT_HOST", mockAWSServer.URL)
+	var err error
+	if testingConfig, err = config.Load(nil); err != nil {
+		panic(err)
+	}
 	code := m.Run()
 	os.Exit(code)
 }
 
 func TestServe_CallsLaunchServer(t *testing.T) {
 	success := make(chan bool)
-	launchServer = func(portStr string, router *mux.Router) { // Mock
+	launchServer = func(manager *lifecycle.Manager, server *http.Server) { // Mock
 		success <- true
 	}
 	timer := time.NewTimer(1 * time.Second)
 
-	go serve()
+	go serve(testingConfig, nil)
 
 	select {
 	case <-success:
@@ -56,10 +72,163 @@ func TestServe_CallsLaunchServer(t *testing.T) {
 }
 
 func TestServe_SeedsLandSatC1Mappings(t *testing.T) {
-	launchServer = func(portStr string, router *mux.Router) {} // Mock
+	launchServer = func(manager *lifecycle.Manager, server *http.Server) {} // Mock
+
+	serve(testingConfig, nil)
+	for start := time.Now(); !landsat.SceneMapIsReady() && time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+	}
+	assert.True(t, landsat.SceneMapIsReady(), "LandSat scene map took more than 1 second to load")
+}
+
+func TestServe_ReloadsConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "broker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "broker.json")
+	ioutil.WriteFile(filename, []byte(`{"planet": {"apiURL": "https://one.example.com"}}`), 0600)
+
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	config.AddFlags(flags)
+	flags.Parse([]string{"--config", filename})
+	cfg, err := config.Load(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := make(chan http.Handler, 1)
+	launchServer = func(manager *lifecycle.Manager, server *http.Server) { handlers <- server.Handler } // Mock
+	go serve(cfg, flags)
+	handler := <-handlers
+	assert.Equal(t, "https://one.example.com", planet.CurrentSettings().APIURL)
+
+	reload := func() *httptest.ResponseRecorder {
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, httptest.NewRequest("POST", "/config/reload", nil))
+		return writer
+	}
+
+	ioutil.WriteFile(filename, []byte(`{"planet": {"apiURL": "https://two.example.com", "serverKey": "new-key"}, "landsat": {"refreshInterval": "1h"}}`), 0600)
+	writer := reload()
+	if assert.Equal(t, http.StatusOK, writer.Code, writer.Body.String()) {
+		assert.Contains(t, writer.Body.String(), `planet.apiURL: \"https://one.example.com\" -\u003e \"https://two.example.com\"`)
+		assert.Contains(t, writer.Body.String(), "planet.serverKey changed")
+		assert.Contains(t, writer.Body.String(), "landsat.refreshInterval")
+		assert.NotContains(t, writer.Body.String(), "new-key")
+	}
+	assert.Equal(t, "https://two.example.com", planet.CurrentSettings().APIURL)
+
+	// An invalid configuration leaves the running one alone
+	ioutil.WriteFile(filename, []byte(`{"planet": {"apiURL": "three.example.com"}}`), 0600)
+	writer = reload()
+	assert.Equal(t, http.StatusBadRequest, writer.Code)
+	assert.Equal(t, "https://two.example.com", planet.CurrentSettings().APIURL)
+
+	ioutil.WriteFile(filename, []byte(`{"server": {"port": 9999}}`), 0600)
+	request := httptest.NewRequest("POST", "/config/reload", nil)
+	request.Header.Set(util.RequestIDHeader, "reload-1")
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	assert.Equal(t, http.StatusBadRequest, writer.Code)
+	assert.Contains(t, writer.Body.String(), "restart")
+	assert.Equal(t, "reload-1", writer.Header().Get(util.RequestIDHeader))
+	assert.Contains(t, writer.Body.String(), "Request ID: reload-1")
+	assert.Equal(t, "https://two.example.com", planet.CurrentSettings().APIURL)
+
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest("GET", "/config/reload", nil))
+	assert.NotEqual(t, http.StatusOK, writer.Code)
+
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, writer.Code)
+	assert.Contains(t, writer.Body.String(), `bf_http_requests_total{route="/config/reload",method="POST",status="400"}`)
+	assert.Contains(t, writer.Body.String(), `bf_http_requests_total{route="unmatched",method="GET",status="404"}`)
+	assert.Contains(t, writer.Body.String(), "bf_landsat_scene_map_age_seconds")
+
+	testingConfig.Apply()
+}
+
+func TestServe_HealthChecks(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/tides" {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+	dir, err := ioutil.TempDir("", "broker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "broker.json")
+	ioutil.WriteFile(filename, []byte(`{"planet": {"apiURL": "`+upstream.URL+`"}, "tides": {"url": "`+upstream.URL+`/tides", "source": "service"}}`), 0600)
+
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	config.AddFlags(flags)
+	flags.Parse([]string{"--config", filename})
+	cfg, err := config.Load(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Apply()
+	defer testingConfig.Apply()
+
+	manager := lifecycle.New(time.Second)
+	reloads := &reloadStatus{}
+	addHealthChecks(manager, reloads)
+	result := make(chan error, 1)
+	go func() {
+		result <- manager.Run(&http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}, syscall.SIGUSR1)
+	}()
+	for start := time.Now(); manager.State() != lifecycle.Running; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("Server did not start")
+		}
+	}
+	defer func() {
+		manager.Shutdown()
+		<-result
+	}()
+
+	type readiness struct {
+		Health  string
+		Failing []string
+		Checks  map[string]lifecycle.CheckResult
+	}
+	ready := func() (report readiness) {
+		writer := httptest.NewRecorder()
+		manager.ReadyHandler().ServeHTTP(writer, httptest.NewRequest("GET", "/health/ready", nil))
+		assert.Equal(t, http.StatusOK, writer.Code)
+		if err := json.Unmarshal(writer.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	report := ready()
+	assert.Equal(t, lifecycle.Degraded, report.Health)
+	assert.Contains(t, report.Failing, "tides")
+	assert.NotContains(t, report.Failing, "planet")
+	assert.Equal(t, lifecycle.Healthy, report.Checks["planet"].Status)
+	assert.Equal(t, lifecycle.Degraded, report.Checks["tides"].Status)
+	assert.Equal(t, "not in use", report.Checks["noaa"].Details["skipped"])
+	assert.Equal(t, lifecycle.Healthy, report.Checks["config"].Status)
+	assert.Equal(t, "none", report.Checks["config"].Details["lastReload"])
+	assert.Contains(t, report.Checks, "landsat")
 
-	go serve()
-	<-time.NewTimer(1 * time.Second).C
+	// A bad edit on disk goes unnoticed until a reload is asked for, and a
+	// rejected reload is reported without failing the check; adding a check
+	// discards the cached results
+	ioutil.WriteFile(filename, []byte(`{"planet": {"apiURL": "not-a-url"}}`), 0600)
+	manager.AddCheck("noop", func(ctx context.Context) (map[string]interface{}, error) { return nil, nil })
+	report = ready()
+	assert.NotContains(t, report.Failing, "config")
+	assert.Equal(t, "none", report.Checks["config"].Details["lastReload"])
 
-	assert.True(t, landsat.SceneMapIsReady, "LandSat scene map took more than 1 second to load")
+	reloads.record(errors.New("planet.apiURL is not a URL"))
+	manager.AddCheck("noop", func(ctx context.Context) (map[string]interface{}, error) { return nil, nil })
+	report = ready()
+	assert.NotContains(t, report.Failing, "config")
+	assert.Equal(t, lifecycle.Healthy, report.Checks["config"].Status)
+	assert.Equal(t, "planet.apiURL is not a URL", report.Checks["config"].Details["rejected"])
 }
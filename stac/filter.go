@@ -0,0 +1,136 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stac
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/venicegeo/dg-bf-ia-broker/tides"
+)
+
+// Queryable properties
+const (
+	cloudCoverProperty  = "eo:cloud_cover"
+	currentTideProperty = "tides:current"
+)
+
+// The CQL2 comparison operators, and their query extension equivalents
+var cql2Operators = map[string]string{
+	"=":  "eq",
+	"<":  "lt",
+	"<=": "lte",
+	">":  "gt",
+	">=": "gte",
+}
+
+// When the property follows the value, the comparison reverses
+var reversedOperators = map[string]string{
+	"eq":  "eq",
+	"lt":  "gt",
+	"lte": "gte",
+	"gt":  "lt",
+	"gte": "lte",
+}
+
+// constraints collects the property constraints of a search that
+// can be carried out: a maximum cloud cover, which Planet Labs applies,
+// and bounds on the current tide, which we apply to the results
+type constraints struct {
+	maxCloudCover *float64
+	tides         tides.Filter
+}
+
+// add applies a single query extension constraint, e.g.,
+// "eo:cloud_cover": {"lte": 20}
+func (c *constraints) add(property, operator string, value interface{}) error {
+	number, ok := value.(float64)
+	if !ok {
+		return fmt.Errorf("The %v constraint must be a number", property)
+	}
+	switch property {
+	case cloudCoverProperty:
+		switch operator {
+		case "lt", "lte":
+			if c.maxCloudCover == nil || number < *c.maxCloudCover {
+				c.maxCloudCover = &number
+			}
+			return nil
+		}
+	case currentTideProperty:
+		switch operator {
+		case "gt", "gte":
+			c.tides.MinTide = combineBound(c.tides.MinTide, number, math.Max)
+			return nil
+		case "lt", "lte":
+			c.tides.MaxTide = combineBound(c.tides.MaxTide, number, math.Min)
+			return nil
+		case "eq":
+			c.tides.MinTide = combineBound(c.tides.MinTide, number, math.Max)
+			c.tides.MaxTide = combineBound(c.tides.MaxTide, number, math.Min)
+			return nil
+		}
+	default:
+		return fmt.Errorf("Searching on %v is not supported; only %v and %v are", property, cloudCoverProperty, currentTideProperty)
+	}
+	return fmt.Errorf("The %v operator is not supported for %v", operator, property)
+}
+
+// combineBound combines a new bound with an existing one, if any
+func combineBound(existing *float64, value float64, combine func(float64, float64) float64) *float64 {
+	if existing != nil {
+		value = combine(*existing, value)
+	}
+	return &value
+}
+
+// addCQL2 applies a CQL2 JSON filter. Only comparisons between
+// a queryable property and a number, combined with "and", are supported.
+func (c *constraints) addCQL2(filter interface{}) error {
+	node, ok := filter.(map[string]interface{})
+	if !ok {
+		return errors.New("A filter must be a CQL2 JSON object")
+	}
+	op, _ := node["op"].(string)
+	args, _ := node["args"].([]interface{})
+	if op == "and" {
+		for _, arg := range args {
+			if err := c.addCQL2(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	operator, ok := cql2Operators[op]
+	if !ok || len(args) != 2 {
+		return fmt.Errorf("The filter operator %v is not supported", op)
+	}
+	if property, ok := cql2Property(args[0]); ok {
+		return c.add(property, operator, args[1])
+	}
+	if property, ok := cql2Property(args[1]); ok {
+		return c.add(property, reversedOperators[operator], args[0])
+	}
+	return errors.New("A filter comparison must include a property")
+}
+
+func cql2Property(arg interface{}) (string, bool) {
+	if node, ok := arg.(map[string]interface{}); ok {
+		property, ok := node["property"].(string)
+		return property, ok
+	}
+	return "", false
+}
@@ -0,0 +1,75 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stac
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryConstraints(t *testing.T) {
+	search := searchRequest{
+		Collections: []string{"REOrthoTile"},
+		Query: map[string]map[string]interface{}{
+			"eo:cloud_cover": {"lt": 30.0, "lte": 20.0},
+			"tides:current":  {"gte": 0.5, "lte": 1.5},
+		},
+	}
+	options, filter, err := search.searchOptions()
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.2, options.CloudCover, 1e-9)
+	assert.True(t, options.Tides, "Expected tides for a tide constraint")
+	assert.Equal(t, 0.5, *filter.MinTide)
+	assert.Equal(t, 1.5, *filter.MaxTide)
+	assert.Equal(t, defaultLimit, options.PageSize)
+}
+
+func TestCQL2Constraints(t *testing.T) {
+	var search searchRequest
+	body := `{"collections": ["REOrthoTile"], "filter-lang": "cql2-json", "filter": {"op": "and", "args": [
+		{"op": "<=", "args": [{"property": "eo:cloud_cover"}, 10]},
+		{"op": "<", "args": [0.25, {"property": "tides:current"}]},
+		{"op": "<=", "args": [{"property": "tides:current"}, 2]}
+	]}}`
+	assert.Nil(t, json.Unmarshal([]byte(body), &search))
+
+	options, filter, err := search.searchOptions()
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.1, options.CloudCover, 1e-9)
+	assert.Equal(t, 0.25, *filter.MinTide)
+	assert.Equal(t, 2.0, *filter.MaxTide)
+
+	unsupported := []string{
+		`{"op": "or", "args": []}`,
+		`{"op": ">", "args": [{"property": "eo:cloud_cover"}, 10]}`,
+		`{"op": "=", "args": [{"property": "platform"}, "RapidEye-1"]}`,
+		`{"op": "<", "args": [1, 2]}`,
+		`"eo:cloud_cover < 10"`,
+	}
+	for _, filterStr := range unsupported {
+		search.Filter = nil
+		assert.Nil(t, json.Unmarshal([]byte(filterStr), &search.Filter))
+		_, _, err = search.searchOptions()
+		assert.NotNil(t, err, "Expected %v to be rejected", filterStr)
+	}
+
+	// Contradictory tide bounds fail validation
+	search.Filter = nil
+	search.Query = map[string]map[string]interface{}{"tides:current": {"gt": 2.0, "lt": 1.0}}
+	_, _, err = search.searchOptions()
+	assert.NotNil(t, err)
+}
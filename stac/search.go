@@ -0,0 +1,322 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stac
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/encoder"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/tides"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 250 // the largest page Planet Labs provides
+)
+
+// searchRequest is a STAC API item search, from either
+// the parameters of a GET or the body of a POST
+type searchRequest struct {
+	Collections []string                          `json:"collections,omitempty"`
+	Bbox        []float64                         `json:"bbox,omitempty"`
+	Intersects  map[string]interface{}            `json:"intersects,omitempty"`
+	Datetime    string                            `json:"datetime,omitempty"`
+	Limit       int                               `json:"limit,omitempty"`
+	Query       map[string]map[string]interface{} `json:"query,omitempty"`
+	Filter      interface{}                       `json:"filter,omitempty"`
+	FilterLang  string                            `json:"filter-lang,omitempty"`
+	Token       string                            `json:"token,omitempty"`
+}
+
+// SearchHandler is a handler for STAC API item search
+// @Title stacSearchHandler
+// @Description searches for STAC Items
+// @Accept  json
+// @Param   X-Planet-Key    header  string  false        "Planet Labs API Key, unless the broker holds the key"
+// @Param   PL_API_KEY      query   string  false        "Planet Labs API Key (deprecated)"
+// @Param   collections     query   string  true         "The collection (item type) to search"
+// @Param   bbox            query   string  false        "The bounding box (x1,y1,x2,y2)"
+// @Param   intersects      query   string  false        "A GeoJSON geometry that Items must intersect"
+// @Param   datetime        query   string  false        "An RFC 3339 date-time or interval, e.g., 2017-01-01T00:00:00Z/.."
+// @Param   limit           query   number  false        "The maximum number of Items per page (default 10)"
+// @Param   query           query   string  false        "Constraints on eo:cloud_cover and tides:current, as a JSON object"
+// @Param   filter          query   string  false        "Constraints on eo:cloud_cover and tides:current, as CQL2 JSON"
+// @Param   token           query   string  false        "A token for a further page of results"
+// @Success 200 {object}  geojson.FeatureCollection
+// @Failure 400 {object}  string
+// @Router /stac/search [get]
+type SearchHandler struct {
+	Context planet.Context
+}
+
+// NewSearchHandler creates a new handler using the current
+// planet Settings
+func NewSearchHandler() SearchHandler {
+	return SearchHandler{Context: planet.NewContext()}
+}
+
+// ServeHTTP implements the http.Handler interface for the SearchHandler type
+func (h SearchHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	var (
+		search     searchRequest
+		options    planet.SearchOptions
+		tideFilter tides.Filter
+		fc         *geojson.FeatureCollection
+		next       string
+		err        error
+	)
+	util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method, Actee: request.URL.String(), Message: "Receiving /stac/search request", Severity: util.INFO})
+
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+
+	if err = h.Context.SetPlanetKey(writer, request); err != nil {
+		herr := err.(util.HTTPErr)
+		util.LogSimpleErr(&h.Context, herr.Message, nil)
+		util.WriteHTTPErr(request, writer, &h.Context, herr)
+		return
+	}
+
+	switch request.Method {
+	case "GET":
+		search, err = parseSearchQuery(request.URL.Query())
+	case "POST":
+		if err = json.NewDecoder(request.Body).Decode(&search); err != nil {
+			err = errors.New("The search request body is not valid JSON: " + err.Error())
+		}
+	default:
+		util.HTTPError(request, writer, &h.Context, "Search only supports GET and POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if err == nil {
+		options, tideFilter, err = search.searchOptions()
+	}
+	if err != nil {
+		util.LogSimpleErr(&h.Context, err.Error(), nil)
+		util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if fc, next, err = planet.SearchScenes(request.Context(), options, &h.Context); err != nil {
+		switch herr := err.(type) {
+		case util.HTTPErr:
+			util.WriteHTTPErr(request, writer, &h.Context, herr)
+		default:
+			err = util.LogSimpleErr(&h.Context, "Failed to search Planet Labs scenes. ", err)
+			util.HTTPError(request, writer, &h.Context, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	fc = tides.FilterFeatures(fc, tideFilter)
+
+	stacEncoder := encoder.NewSTACEncoder(writer)
+	stacEncoder.Collection = options.ItemType
+	stacEncoder.Links = search.links(request, next)
+	writer.Header().Set("Content-Type", geoJSONMediaType)
+	if err = encoder.EncodeFeatureCollection(stacEncoder, fc); err != nil {
+		util.LogSimpleErr(&h.Context, "Failed to write STAC search results", err)
+		return
+	}
+	util.LogAudit(&h.Context, util.LogAuditInput{Actor: "anon user", Action: request.Method + " response", Actee: request.URL.String(), Message: "Sending /stac/search response", Severity: util.INFO})
+}
+
+// parseSearchQuery reads a search from GET parameters,
+// where structured values are given as JSON
+func parseSearchQuery(query url.Values) (searchRequest, error) {
+	var (
+		result searchRequest
+		err    error
+	)
+	if collections := query.Get("collections"); collections != "" {
+		result.Collections = strings.Split(collections, ",")
+	}
+	if bbox := query.Get("bbox"); bbox != "" {
+		for _, coordStr := range strings.Split(bbox, ",") {
+			var coord float64
+			if coord, err = strconv.ParseFloat(coordStr, 64); err != nil {
+				return result, fmt.Errorf("The bbox value of %v is invalid", bbox)
+			}
+			result.Bbox = append(result.Bbox, coord)
+		}
+	}
+	if intersects := query.Get("intersects"); intersects != "" {
+		if err = json.Unmarshal([]byte(intersects), &result.Intersects); err != nil {
+			return result, errors.New("The intersects value is not valid JSON")
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if result.Limit, err = strconv.Atoi(limit); err != nil {
+			return result, fmt.Errorf("The limit value of %v is invalid", limit)
+		}
+	}
+	if queryStr := query.Get("query"); queryStr != "" {
+		if err = json.Unmarshal([]byte(queryStr), &result.Query); err != nil {
+			return result, errors.New("The query value is not valid JSON")
+		}
+	}
+	if filter := query.Get("filter"); filter != "" {
+		if err = json.Unmarshal([]byte(filter), &result.Filter); err != nil {
+			return result, errors.New("Only cql2-json filters are supported")
+		}
+	}
+	result.Datetime = query.Get("datetime")
+	result.FilterLang = query.Get("filter-lang")
+	result.Token = query.Get("token")
+	return result, nil
+}
+
+// searchOptions translates the search into the options for Planet Labs
+// and the tide filter to apply to the results
+func (s searchRequest) searchOptions() (planet.SearchOptions, tides.Filter, error) {
+	var (
+		result      planet.SearchOptions
+		constraints constraints
+		err         error
+	)
+	if len(s.Collections) != 1 || findCollection(s.Collections[0]) == nil {
+		return result, constraints.tides, errors.New("A search must name exactly one known collection")
+	}
+	result.ItemType = s.Collections[0]
+	result.PageToken = s.Token
+
+	switch len(s.Bbox) {
+	case 0:
+	case 4:
+		result.Bbox = geojson.BoundingBox(s.Bbox)
+	case 6:
+		result.Bbox = geojson.BoundingBox{s.Bbox[0], s.Bbox[1], s.Bbox[3], s.Bbox[4]}
+	default:
+		return result, constraints.tides, errors.New("A bbox must have four or six values")
+	}
+
+	if s.Intersects != nil {
+		if err = validateGeometry(s.Intersects); err != nil {
+			return result, constraints.tides, err
+		}
+		result.Intersects = s.Intersects
+	}
+
+	if result.AcquiredDate, result.MaxAcquiredDate, err = ParseDatetime(s.Datetime); err != nil {
+		return result, constraints.tides, err
+	}
+
+	switch {
+	case s.Limit == 0:
+		result.PageSize = defaultLimit
+	case s.Limit < 0:
+		return result, constraints.tides, fmt.Errorf("The limit value of %v is invalid", s.Limit)
+	case s.Limit > maxLimit:
+		result.PageSize = maxLimit
+	default:
+		result.PageSize = s.Limit
+	}
+
+	for property, operators := range s.Query {
+		for operator, value := range operators {
+			if err = constraints.add(property, operator, value); err != nil {
+				return result, constraints.tides, err
+			}
+		}
+	}
+	if s.Filter != nil {
+		if s.FilterLang != "" && s.FilterLang != "cql2-json" {
+			return result, constraints.tides, errors.New("Only cql2-json filters are supported")
+		}
+		if err = constraints.addCQL2(s.Filter); err != nil {
+			return result, constraints.tides, err
+		}
+	}
+	if constraints.maxCloudCover != nil {
+		result.CloudCover = *constraints.maxCloudCover / 100.0
+	}
+	result.Tides = !constraints.tides.IsEmpty()
+	return result, constraints.tides, constraints.tides.Validate()
+}
+
+// validateGeometry makes sure that intersects is a GeoJSON geometry
+func validateGeometry(geometry map[string]interface{}) error {
+	bytes, _ := json.Marshal(geometry)
+	gj, err := geojson.Parse(bytes)
+	switch gj.(type) {
+	case nil, *geojson.Feature, *geojson.FeatureCollection:
+		return errors.New("The intersects value must be a GeoJSON geometry")
+	}
+	return err
+}
+
+// ParseDatetime splits a STAC or OGC API datetime, which is either an
+// instant or an interval whose ends may be open (.. or empty), into a
+// minimum and maximum
+func ParseDatetime(datetime string) (string, string, error) {
+	if datetime == "" {
+		return "", "", nil
+	}
+	parts := strings.Split(datetime, "/")
+	if len(parts) > 2 {
+		return "", "", fmt.Errorf("The datetime value of %v is invalid", datetime)
+	}
+	for inx, part := range parts {
+		if part == ".." {
+			parts[inx] = ""
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, part); part != "" && err != nil {
+			return "", "", fmt.Errorf("The datetime value of %v is invalid", datetime)
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0], parts[0], nil
+	}
+	return parts[0], parts[1], nil
+}
+
+// links returns the self, root and, if there are more results, next links
+// for a page of results. A POST search is continued by POSTing the same
+// search with the token for the next page.
+func (s searchRequest) links(request *http.Request, next string) []encoder.STACLink {
+	baseURL := util.BaseURL(request)
+	self := encoder.STACLink{Rel: "self", Href: planet.LinkURL(request).String(), Type: geoJSONMediaType}
+	result := []encoder.STACLink{self, {Rel: "root", Href: baseURL + Root, Type: jsonMediaType}}
+	if next == "" {
+		return result
+	}
+	nextLink := self
+	nextLink.Rel = "next"
+	if request.Method == "POST" {
+		nextBody := s
+		nextBody.Token = next
+		nextLink.Method = "POST"
+		nextLink.Body = nextBody
+	} else {
+		nextURL, _ := url.Parse(self.Href)
+		query := nextURL.Query()
+		query.Set("token", next)
+		nextURL.RawQuery = query.Encode()
+		nextLink.Href = nextURL.String()
+	}
+	return append(result, nextLink)
+}
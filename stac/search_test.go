@@ -0,0 +1,156 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stac
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/encoder"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+)
+
+type testItemCollection struct {
+	Type     string             `json:"type"`
+	Features []encoder.STACItem `json:"features"`
+	Links    []encoder.STACLink `json:"links"`
+}
+
+func findLink(links []encoder.STACLink, rel string) *encoder.STACLink {
+	for inx := range links {
+		if links[inx].Rel == rel {
+			return &links[inx]
+		}
+	}
+	return nil
+}
+
+func TestSearchGET(t *testing.T) {
+	var result testItemCollection
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	url := "/stac/search?PL_API_KEY=" + testingKey + "&collections=REOrthoTile&bbox=-10,-10,10,10&datetime=2016-01-01T00:00:00Z/..&limit=5"
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code, "Expected search to succeed but received: %v", recorder.Body.String())
+	assert.Equal(t, "5", planetServer.LastRequest().FormValue("_page_size"))
+	assert.Contains(t, planetServer.LastBody(), `"gte":"2016-01-01T00:00:00Z"`)
+	assert.Contains(t, planetServer.LastBody(), "GeometryFilter")
+
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, "FeatureCollection", result.Type)
+	assert.Equal(t, 1, len(result.Features))
+	assert.Equal(t, "REOrthoTile", result.Features[0].Collection)
+	next := findLink(result.Links, "next")
+	if assert.NotNil(t, next, "Expected a next link") {
+		assert.Contains(t, next.Href, "token=")
+
+		assert.NotContains(t, next.Href, testingKey, "Expected the API key to be left out of links")
+
+		// Follow the next link to the last page
+		recorder = httptest.NewRecorder()
+		request := httptest.NewRequest("GET", next.Href, nil)
+		request.Header.Set(planet.PlanetKeyHeader, testingKey)
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code, "Expected the next page to succeed but received: %v", recorder.Body.String())
+		assert.Equal(t, "2", planetServer.LastRequest().FormValue("_page"))
+		result = testItemCollection{}
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		assert.Nil(t, findLink(result.Links, "next"), "Expected no next link on the last page")
+	}
+}
+
+func TestSearchPOST(t *testing.T) {
+	var result testItemCollection
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	body := `{"collections": ["PSOrthoTile"], "query": {"eo:cloud_cover": {"lte": 20}},
+		"intersects": {"type": "Point", "coordinates": [1, 2]}}`
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/stac/search?PL_API_KEY="+testingKey, strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, recorder.Code, "Expected search to succeed but received: %v", recorder.Body.String())
+	assert.Contains(t, planetServer.LastBody(), `"cloud_cover","config":{"lte":0.2}`)
+	assert.Contains(t, planetServer.LastBody(), `"type":"Point"`)
+
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	next := findLink(result.Links, "next")
+	if assert.NotNil(t, next, "Expected a next link") {
+		assert.Equal(t, "POST", next.Method)
+		nextBody, _ := json.Marshal(next.Body)
+		assert.Contains(t, string(nextBody), `"token":`)
+		assert.Contains(t, string(nextBody), `"eo:cloud_cover"`)
+
+		assert.NotContains(t, next.Href, testingKey, "Expected the API key to be left out of links")
+		recorder = httptest.NewRecorder()
+		request := httptest.NewRequest("POST", next.Href, bytes.NewReader(nextBody))
+		request.Header.Set(planet.PlanetKeyHeader, testingKey)
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code, "Expected the next page to succeed but received: %v", recorder.Body.String())
+	}
+}
+
+func TestSearchInvalid(t *testing.T) {
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	queries := []string{
+		"",
+		"&collections=nothing",
+		"&collections=REOrthoTile,PSOrthoTile",
+		"&collections=REOrthoTile&bbox=1,2,3",
+		"&collections=REOrthoTile&datetime=yesterday",
+		"&collections=REOrthoTile&limit=-1",
+		"&collections=REOrthoTile&intersects={\"type\":\"Feature\"}",
+		"&collections=REOrthoTile&query={\"gsd\":{\"lt\":5}}",
+		"&collections=REOrthoTile&filter=eo:cloud_cover<5&filter-lang=cql2-text",
+		"&collections=REOrthoTile&token=bogus",
+	}
+	for _, query := range queries {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/stac/search?PL_API_KEY="+testingKey+query, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, "Expected %v to fail but received: %v", query, recorder.Body.String())
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/stac/search?PL_API_KEY="+testingKey, strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/stac/search?collections=REOrthoTile", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "Expected a search without a key to fail")
+}
+
+func TestParseDatetime(t *testing.T) {
+	tests := map[string][2]string{
+		"":                        {"", ""},
+		"2017-01-01T00:00:00Z":    {"2017-01-01T00:00:00Z", "2017-01-01T00:00:00Z"},
+		"2017-01-01T00:00:00Z/..": {"2017-01-01T00:00:00Z", ""},
+		"/2017-02-01T00:00:00Z":   {"", "2017-02-01T00:00:00Z"},
+		"2017-01-01T00:00:00Z/2017-02-01T00:00:00Z": {"2017-01-01T00:00:00Z", "2017-02-01T00:00:00Z"},
+	}
+	for datetime, expected := range tests {
+		min, max, err := ParseDatetime(datetime)
+		assert.Nil(t, err, "Expected %v to parse but received %v", datetime, err)
+		assert.Equal(t, expected, [2]string{min, max})
+	}
+	_, _, err := ParseDatetime("a/b/c")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,272 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stac
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/venicegeo/dg-bf-ia-broker/encoder"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// Root is the path under which the STAC API is served
+const Root = "/stac"
+
+const (
+	jsonMediaType    = "application/json"
+	geoJSONMediaType = "application/geo+json"
+)
+
+var conformsTo = []string{
+	"https://api.stacspec.org/v1.0.0/core",
+	"https://api.stacspec.org/v1.0.0/collections",
+	"https://api.stacspec.org/v1.0.0/item-search",
+	"https://api.stacspec.org/v1.0.0/item-search#query",
+	"https://api.stacspec.org/v1.0.0/item-search#filter",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
+	"http://www.opengis.net/spec/cql2/1.0/conf/cql2-json",
+	"http://www.opengis.net/spec/cql2/1.0/conf/basic-cql2",
+}
+
+// Provider is a STAC provider object
+type Provider struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+	URL   string   `json:"url,omitempty"`
+}
+
+// Extent is a STAC collection extent
+type Extent struct {
+	Spatial struct {
+		Bbox [][]float64 `json:"bbox"`
+	} `json:"spatial"`
+	Temporal struct {
+		Interval [][]interface{} `json:"interval"`
+	} `json:"temporal"`
+}
+
+// Collection is a STAC Collection
+type Collection struct {
+	Type           string             `json:"type"`
+	STACVersion    string             `json:"stac_version"`
+	STACExtensions []string           `json:"stac_extensions"`
+	ID             string             `json:"id"`
+	Title          string             `json:"title"`
+	Description    string             `json:"description"`
+	License        string             `json:"license"`
+	Providers      []Provider         `json:"providers"`
+	Extent         Extent             `json:"extent"`
+	Links          []encoder.STACLink `json:"links"`
+}
+
+// Catalog is the STAC API landing page
+type Catalog struct {
+	Type        string             `json:"type"`
+	STACVersion string             `json:"stac_version"`
+	ID          string             `json:"id"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	ConformsTo  []string           `json:"conformsTo"`
+	Links       []encoder.STACLink `json:"links"`
+}
+
+var planetProvider = Provider{Name: "Planet Labs", Roles: []string{"host"}, URL: "https://www.planet.com"}
+
+// collectionInfo describes one item type from one provider
+type collectionInfo struct {
+	id          string
+	title       string
+	description string
+	license     string
+	producer    Provider
+}
+
+// collectionInfos lists the collections, one per item type the
+// broker can search, in the order they are presented
+var collectionInfos = []collectionInfo{
+	{id: "REOrthoTile", title: "RapidEye Ortho Tiles", description: "RapidEye orthorectified scenes, as tiles",
+		license: "proprietary", producer: Provider{Name: "Planet Labs", Roles: []string{"producer", "licensor"}, URL: "https://www.planet.com"}},
+	{id: "PSOrthoTile", title: "PlanetScope Ortho Tiles", description: "PlanetScope orthorectified scenes, as tiles",
+		license: "proprietary", producer: Provider{Name: "Planet Labs", Roles: []string{"producer", "licensor"}, URL: "https://www.planet.com"}},
+	{id: "PSScene4Band", title: "PlanetScope 4-band Scenes", description: "PlanetScope four band scenes",
+		license: "proprietary", producer: Provider{Name: "Planet Labs", Roles: []string{"producer", "licensor"}, URL: "https://www.planet.com"}},
+	{id: "Landsat8L1G", title: "Landsat 8 Level 1G", description: "Landsat 8 systematically terrain corrected scenes, with bands on AWS",
+		license: "PDDL-1.0", producer: Provider{Name: "USGS", Roles: []string{"producer", "licensor"}, URL: "https://landsat.usgs.gov"}},
+	{id: "Sentinel2L1C", title: "Sentinel-2 Level 1C", description: "Sentinel-2 top of atmosphere reflectance scenes, with bands on AWS",
+		license: "proprietary", producer: Provider{Name: "ESA", Roles: []string{"producer", "licensor"}, URL: "https://sentinel.esa.int"}},
+}
+
+func findCollection(id string) *collectionInfo {
+	for inx := range collectionInfos {
+		if collectionInfos[inx].id == id {
+			return &collectionInfos[inx]
+		}
+	}
+	return nil
+}
+
+// Collections returns the STAC collections, with links relative to baseURL
+func Collections(baseURL string) []Collection {
+	result := []Collection{}
+	for _, info := range collectionInfos {
+		result = append(result, info.collection(baseURL))
+	}
+	return result
+}
+
+// FindCollection returns the named STAC collection, if there is one
+func FindCollection(id, baseURL string) (Collection, bool) {
+	if info := findCollection(id); info != nil {
+		return info.collection(baseURL), true
+	}
+	return Collection{}, false
+}
+
+func (info collectionInfo) collection(baseURL string) Collection {
+	result := Collection{
+		Type:           "Collection",
+		STACVersion:    encoder.STACVersion,
+		STACExtensions: []string{encoder.STACEOExtension},
+		ID:             info.id,
+		Title:          info.title,
+		Description:    info.description,
+		License:        info.license,
+		Providers:      []Provider{info.producer, planetProvider},
+		Links: []encoder.STACLink{
+			{Rel: "self", Href: baseURL + Root + "/collections/" + info.id, Type: jsonMediaType},
+			{Rel: "root", Href: baseURL + Root, Type: jsonMediaType},
+			{Rel: "parent", Href: baseURL + Root, Type: jsonMediaType},
+			{Rel: "items", Href: baseURL + Root + "/search?collections=" + info.id, Type: geoJSONMediaType},
+		},
+	}
+	result.Extent.Spatial.Bbox = [][]float64{{-180, -90, 180, 90}}
+	result.Extent.Temporal.Interval = [][]interface{}{{nil, nil}}
+	return result
+}
+
+// LandingHandler is a handler for the STAC API landing page
+// @Title stacLandingHandler
+// @Description the STAC API landing page
+// @Success 200 {object}  stac.Catalog
+// @Router /stac [get]
+type LandingHandler struct {
+	Context planet.Context
+}
+
+// NewLandingHandler creates a new handler
+func NewLandingHandler() LandingHandler {
+	return LandingHandler{}
+}
+
+// ServeHTTP implements the http.Handler interface for the LandingHandler type
+func (h LandingHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+	baseURL := util.BaseURL(request)
+	catalog := Catalog{
+		Type:        "Catalog",
+		STACVersion: encoder.STACVersion,
+		ID:          "bf-ia-broker",
+		Title:       "Beachfront Image Archive Broker",
+		Description: "Searches image archives for Beachfront",
+		ConformsTo:  conformsTo,
+		Links: []encoder.STACLink{
+			{Rel: "self", Href: baseURL + Root, Type: jsonMediaType},
+			{Rel: "root", Href: baseURL + Root, Type: jsonMediaType},
+			{Rel: "conformance", Href: baseURL + Root + "/conformance", Type: jsonMediaType},
+			{Rel: "data", Href: baseURL + Root + "/collections", Type: jsonMediaType},
+			{Rel: "search", Href: baseURL + Root + "/search", Type: geoJSONMediaType, Method: "GET"},
+			{Rel: "search", Href: baseURL + Root + "/search", Type: geoJSONMediaType, Method: "POST"},
+		},
+	}
+	for _, info := range collectionInfos {
+		catalog.Links = append(catalog.Links, encoder.STACLink{Rel: "child", Href: baseURL + Root + "/collections/" + info.id, Type: jsonMediaType, Title: info.title})
+	}
+	writeJSON(writer, catalog)
+}
+
+// ConformanceHandler is a handler for the STAC API conformance classes
+// @Title stacConformanceHandler
+// @Description the conformance classes implemented by the STAC API
+// @Router /stac/conformance [get]
+type ConformanceHandler struct {
+	Context planet.Context
+}
+
+// NewConformanceHandler creates a new handler
+func NewConformanceHandler() ConformanceHandler {
+	return ConformanceHandler{}
+}
+
+// ServeHTTP implements the http.Handler interface for the ConformanceHandler type
+func (h ConformanceHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+	writeJSON(writer, map[string][]string{"conformsTo": conformsTo})
+}
+
+// CollectionsHandler is a handler for the STAC collections,
+// one per item type and provider
+// @Title stacCollectionsHandler
+// @Description lists the collections, or describes one
+// @Param   collectionId    path    string  false        "The collection (item type)"
+// @Success 200 {object}  stac.Collection
+// @Failure 404 {object}  string
+// @Router /stac/collections/{collectionId} [get]
+type CollectionsHandler struct {
+	Context planet.Context
+}
+
+// NewCollectionsHandler creates a new handler
+func NewCollectionsHandler() CollectionsHandler {
+	return CollectionsHandler{}
+}
+
+// ServeHTTP implements the http.Handler interface for the CollectionsHandler type
+func (h CollectionsHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.Context.SetRequestID(util.RequestID(request.Context()))
+	if util.Preflight(writer, request, &h.Context) {
+		return
+	}
+	baseURL := util.BaseURL(request)
+	if id, ok := mux.Vars(request)["collectionId"]; ok {
+		collection, found := FindCollection(id, baseURL)
+		if !found {
+			util.HTTPError(request, writer, &h.Context, "No collection named "+id, http.StatusNotFound)
+			return
+		}
+		writeJSON(writer, collection)
+		return
+	}
+	writeJSON(writer, map[string]interface{}{
+		"collections": Collections(baseURL),
+		"links": []encoder.STACLink{
+			{Rel: "self", Href: baseURL + Root + "/collections", Type: jsonMediaType},
+			{Rel: "root", Href: baseURL + Root, Type: jsonMediaType},
+		},
+	})
+}
+
+func writeJSON(writer http.ResponseWriter, output interface{}) {
+	writer.Header().Set("Content-Type", jsonMediaType)
+	util.PrintJSON(writer, output, http.StatusOK)
+}
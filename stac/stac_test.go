@@ -0,0 +1,86 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanding(t *testing.T) {
+	var catalog Catalog
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "http://broker.example.com/stac", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &catalog))
+	assert.Equal(t, "Catalog", catalog.Type)
+	assert.Contains(t, catalog.ConformsTo, "https://api.stacspec.org/v1.0.0/item-search")
+	search := findLink(catalog.Links, "search")
+	if assert.NotNil(t, search) {
+		assert.Equal(t, "http://broker.example.com/stac/search", search.Href)
+	}
+	assert.NotNil(t, findLink(catalog.Links, "child"))
+}
+
+func TestConformance(t *testing.T) {
+	var conformance struct {
+		ConformsTo []string `json:"conformsTo"`
+	}
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/stac/conformance", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &conformance))
+	assert.Equal(t, conformsTo, conformance.ConformsTo)
+}
+
+func TestCollections(t *testing.T) {
+	var (
+		collections struct {
+			Collections []Collection `json:"collections"`
+		}
+		collection Collection
+	)
+	router, planetServer := createTestRouter()
+	defer planetServer.Close()
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/stac/collections", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &collections))
+	assert.Equal(t, len(collectionInfos), len(collections.Collections))
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/stac/collections/Landsat8L1G", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &collection))
+	assert.Equal(t, "Landsat8L1G", collection.ID)
+	assert.Equal(t, "USGS", collection.Providers[0].Name)
+	assert.Equal(t, "Planet Labs", collection.Providers[1].Name)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/stac/collections/nothing", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
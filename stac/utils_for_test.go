@@ -0,0 +1,35 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stac
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/venicegeo/dg-bf-ia-broker/planet"
+)
+
+const testingKey = "VALID_KEY"
+
+// createTestRouter routes the STAC API to handlers that use the mock Planet server
+func createTestRouter() (*mux.Router, *planet.MockSearchServer) {
+	planetServer := planet.CreateMockSearchServer()
+	planet.Configure(planetServer.Settings())
+	router := mux.NewRouter()
+	router.Handle(Root, NewLandingHandler())
+	router.Handle(Root+"/conformance", NewConformanceHandler())
+	router.Handle(Root+"/collections", NewCollectionsHandler())
+	router.Handle(Root+"/collections/{collectionId}", NewCollectionsHandler())
+	router.Handle(Root+"/search", NewSearchHandler())
+	return router, planetServer
+}
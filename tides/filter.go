@@ -0,0 +1,105 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tides
+
+import (
+	"errors"
+	"math"
+
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+// Filter restricts features by tide stage. Each bound is optional; nil
+// means unbounded. The fraction measures the current tide against the
+// 24 hour range, where 0 is the minimum and 1 the maximum.
+type Filter struct {
+	MinFraction *float64
+	MaxFraction *float64
+	MinTide     *float64
+	MaxTide     *float64
+}
+
+// IsEmpty returns true if the filter has no bounds
+func (f Filter) IsEmpty() bool {
+	return f.MinFraction == nil && f.MaxFraction == nil && f.MinTide == nil && f.MaxTide == nil
+}
+
+// Validate returns an error if the filter bounds do not make sense
+func (f Filter) Validate() error {
+	for _, bound := range []*float64{f.MinFraction, f.MaxFraction, f.MinTide, f.MaxTide} {
+		if bound != nil && (math.IsNaN(*bound) || math.IsInf(*bound, 0)) {
+			return errors.New("Tide bounds must be finite numbers")
+		}
+	}
+	for _, fraction := range []*float64{f.MinFraction, f.MaxFraction} {
+		if fraction != nil && (*fraction < 0 || *fraction > 1) {
+			return errors.New("Tide fractions must be between 0 and 1")
+		}
+	}
+	if f.MinFraction != nil && f.MaxFraction != nil && *f.MinFraction > *f.MaxFraction {
+		return errors.New("The minimum tide fraction must not exceed the maximum")
+	}
+	if f.MinTide != nil && f.MaxTide != nil && *f.MinTide > *f.MaxTide {
+		return errors.New("The minimum tide must not exceed the maximum")
+	}
+	return nil
+}
+
+// Fraction returns where the feature's current tide falls in its
+// 24 hour range, or NaN if the feature has no tide information
+func Fraction(feature *geojson.Feature) float64 {
+	curr := feature.PropertyFloat("CurrentTide")
+	min := feature.PropertyFloat("MinimumTide24Hours")
+	max := feature.PropertyFloat("MaximumTide24Hours")
+	switch {
+	case math.IsNaN(curr) || math.IsNaN(min) || math.IsNaN(max):
+		return math.NaN()
+	case max <= min:
+		return 0.5
+	default:
+		return (curr - min) / (max - min)
+	}
+}
+
+// Matches returns true if the feature's tide satisfies the filter.
+// Features without tide information never match a non-empty filter.
+func (f Filter) Matches(feature *geojson.Feature) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	curr := feature.PropertyFloat("CurrentTide")
+	fraction := Fraction(feature)
+	if math.IsNaN(curr) || math.IsNaN(fraction) {
+		return false
+	}
+	return (f.MinFraction == nil || fraction >= *f.MinFraction) &&
+		(f.MaxFraction == nil || fraction <= *f.MaxFraction) &&
+		(f.MinTide == nil || curr >= *f.MinTide) &&
+		(f.MaxTide == nil || curr <= *f.MaxTide)
+}
+
+// FilterFeatures returns a FeatureCollection containing only the features that match the filter
+func FilterFeatures(fc *geojson.FeatureCollection, filter Filter) *geojson.FeatureCollection {
+	if filter.IsEmpty() {
+		return fc
+	}
+	features := []*geojson.Feature{}
+	for _, feature := range fc.Features {
+		if filter.Matches(feature) {
+			features = append(features, feature)
+		}
+	}
+	return geojson.NewFeatureCollection(features)
+}
@@ -0,0 +1,76 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tides
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+func makeTideFeature(id string, curr, min, max float64) *geojson.Feature {
+	return geojson.NewFeature(nil, id, map[string]interface{}{
+		"CurrentTide":        curr,
+		"MinimumTide24Hours": min,
+		"MaximumTide24Hours": max,
+	})
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func TestFraction(t *testing.T) {
+	assert.InDelta(t, 0.25, Fraction(makeTideFeature("a", 1.5, 1, 3)), 1e-9)
+	assert.InDelta(t, 0.5, Fraction(makeTideFeature("flat", 1, 1, 1)), 1e-9)
+	assert.True(t, math.IsNaN(Fraction(geojson.NewFeature(nil, "none", nil))))
+}
+
+func TestFilterValidate(t *testing.T) {
+	assert.Nil(t, Filter{}.Validate())
+	assert.Nil(t, Filter{MinFraction: floatPtr(0), MaxFraction: floatPtr(0.3)}.Validate())
+	assert.NotNil(t, Filter{MinFraction: floatPtr(-0.1)}.Validate())
+	assert.NotNil(t, Filter{MaxFraction: floatPtr(1.5)}.Validate())
+	assert.NotNil(t, Filter{MinFraction: floatPtr(0.6), MaxFraction: floatPtr(0.4)}.Validate())
+	assert.NotNil(t, Filter{MinTide: floatPtr(2), MaxTide: floatPtr(1)}.Validate())
+	assert.NotNil(t, Filter{MinFraction: floatPtr(math.NaN())}.Validate())
+	assert.NotNil(t, Filter{MinTide: floatPtr(math.Inf(-1))}.Validate())
+	assert.NotNil(t, Filter{MaxTide: floatPtr(math.Inf(1))}.Validate())
+}
+
+func TestFilterFeatures(t *testing.T) {
+	fc := geojson.NewFeatureCollection([]*geojson.Feature{
+		makeTideFeature("low", 0.1, 0, 2),
+		makeTideFeature("mid", 1.0, 0, 2),
+		makeTideFeature("high", 1.9, 0, 2),
+		geojson.NewFeature(nil, "none", nil),
+	})
+
+	assert.Equal(t, 4, len(FilterFeatures(fc, Filter{}).Features), "Expected an empty filter to keep everything")
+
+	lowTide := FilterFeatures(fc, Filter{MaxFraction: floatPtr(0.25)})
+	assert.Equal(t, 1, len(lowTide.Features))
+	assert.Equal(t, "low", lowTide.Features[0].IDStr())
+
+	window := FilterFeatures(fc, Filter{MinTide: floatPtr(0.5), MaxTide: floatPtr(1.5)})
+	assert.Equal(t, 1, len(window.Features))
+	assert.Equal(t, "mid", window.Features[0].IDStr())
+
+	combined := FilterFeatures(fc, Filter{MinFraction: floatPtr(0.25), MinTide: floatPtr(1.5)})
+	assert.Equal(t, 1, len(combined.Features))
+	assert.Equal(t, "high", combined.Features[0].IDStr())
+}
@@ -0,0 +1,307 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tides
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// The 24 hour minimum and maximum are found by sampling the
+// predicted tide over a day centered on the requested time
+const (
+	harmonicWindow   = 24 * time.Hour
+	harmonicInterval = 6 * time.Minute
+)
+
+const earthRadiusKm = 6371.0
+
+// HarmonicConstituent is the amplitude and Greenwich phase lag (in degrees)
+// of a single tidal constituent at a station
+type HarmonicConstituent struct {
+	Name      string  `json:"name"`
+	Amplitude float64 `json:"amplitude"`
+	Phase     float64 `json:"phase"`
+}
+
+// HarmonicStation is a tide station with its harmonic constituents.
+// Datum is the mean water level relative to the desired output datum.
+type HarmonicStation struct {
+	ID           string                `json:"id"`
+	Name         string                `json:"name"`
+	Lat          float64               `json:"lat"`
+	Lon          float64               `json:"lon"`
+	Datum        float64               `json:"datum"`
+	Constituents []HarmonicConstituent `json:"constituents"`
+}
+
+type harmonicFile struct {
+	Stations []HarmonicStation `json:"stations"`
+}
+
+// HarmonicSource is a TideSource that predicts tides locally from
+// harmonic constituents, using the station nearest each location
+type HarmonicSource struct {
+	Stations    []HarmonicStation
+	MaxDistance float64 // in kilometers; zero means no limit
+}
+
+// LoadHarmonicSource creates a HarmonicSource from a JSON file of stations
+func LoadHarmonicSource(filename string) (*HarmonicSource, error) {
+	stations, err := loadStations(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &HarmonicSource{Stations: stations}, nil
+}
+
+func loadStations(filename string) ([]HarmonicStation, error) {
+	var (
+		bytes []byte
+		hf    harmonicFile
+		err   error
+	)
+	if filename == "" {
+		return nil, errors.New("A tide stations file is required for this tide source")
+	}
+	if bytes, err = ioutil.ReadFile(filename); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bytes, &hf); err != nil {
+		return nil, fmt.Errorf("Failed to parse tide stations file %v: %v", filename, err.Error())
+	}
+	if len(hf.Stations) == 0 {
+		return nil, fmt.Errorf("Tide stations file %v contains no stations", filename)
+	}
+	for _, station := range hf.Stations {
+		for _, hc := range station.Constituents {
+			if _, ok := constituents[strings.ToUpper(hc.Name)]; !ok {
+				return nil, fmt.Errorf("Station %v has unknown constituent %v", station.ID, hc.Name)
+			}
+		}
+	}
+	return hf.Stations, nil
+}
+
+// Name returns the name of this source
+func (s *HarmonicSource) Name() string {
+	return HarmonicSourceName
+}
+
+// Tides predicts the tides for each location from its nearest station.
+// Nothing is requested, so ctx is not used.
+func (s *HarmonicSource) Tides(ctx context.Context, in tidesIn, context util.LogContext) ([]*tideOut, error) {
+	result := make([]*tideOut, len(in.Locations))
+	for inx, location := range in.Locations {
+		dtgTime, err := time.Parse(dtgFormat, location.Dtg)
+		if err != nil {
+			util.LogInfo(context, "Could not parse tide DTG "+location.Dtg)
+			continue
+		}
+		station, distance := s.NearestStation(location.Lat, location.Lon)
+		if station == nil {
+			util.LogInfo(context, fmt.Sprintf("No tide station within %v km of %v, %v", s.MaxDistance, location.Lat, location.Lon))
+			continue
+		}
+		result[inx] = station.predict(dtgTime)
+		for _, sampleTime := range location.series() {
+			result[inx].Series = append(result[inx].Series, tideSample{Dtg: sampleTime.Format(dtgFormat), Tide: station.Height(sampleTime)})
+		}
+		result[inx].Station = station.ID
+		result[inx].Distance = distance
+	}
+	return result, nil
+}
+
+// NearestStation returns the closest station to the given coordinates and
+// its distance in kilometers, or nil if none is within MaxDistance
+func (s *HarmonicSource) NearestStation(lat, lon float64) (*HarmonicStation, float64) {
+	return nearestStation(s.Stations, s.MaxDistance, lat, lon)
+}
+
+func nearestStation(stations []HarmonicStation, maxDistance, lat, lon float64) (*HarmonicStation, float64) {
+	var (
+		result   *HarmonicStation
+		distance = math.Inf(1)
+	)
+	for inx := range stations {
+		if d := haversine(lat, lon, stations[inx].Lat, stations[inx].Lon); d < distance {
+			result = &stations[inx]
+			distance = d
+		}
+	}
+	if maxDistance > 0 && distance > maxDistance {
+		return nil, distance
+	}
+	return result, distance
+}
+
+// Height returns the predicted tide height at the station at time t
+func (station *HarmonicStation) Height(t time.Time) float64 {
+	args := astronomicalArguments(t)
+	result := station.Datum
+	for _, hc := range station.Constituents {
+		c := constituents[strings.ToUpper(hc.Name)]
+		f, u := c.nodal(args.n)
+		result += f * hc.Amplitude * math.Cos(radians(c.argument(args)+u-hc.Phase))
+	}
+	return result
+}
+
+func (station *HarmonicStation) predict(t time.Time) *tideOut {
+	result := tideOut{CurrTide: station.Height(t), MinTide: math.Inf(1), MaxTide: math.Inf(-1)}
+	for curr := t.Add(-harmonicWindow / 2); !curr.After(t.Add(harmonicWindow / 2)); curr = curr.Add(harmonicInterval) {
+		height := station.Height(curr)
+		result.MinTide = math.Min(result.MinTide, height)
+		result.MaxTide = math.Max(result.MaxTide, height)
+	}
+	return &result
+}
+
+// astronomical holds the mean longitudes (in degrees) that drive the
+// equilibrium arguments of the tidal constituents
+type astronomical struct {
+	tau float64 // mean lunar time
+	s   float64 // mean longitude of the moon
+	h   float64 // mean longitude of the sun
+	p   float64 // longitude of the lunar perigee
+	n   float64 // longitude of the moon's ascending node
+	p1  float64 // longitude of the solar perigee
+}
+
+var j2000 = time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func astronomicalArguments(t time.Time) astronomical {
+	t = t.UTC()
+	centuries := t.Sub(j2000).Hours() / (24.0 * 36525.0)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	var result astronomical
+	result.s = 218.3164477 + 481267.88123421*centuries
+	result.h = 280.46646 + 36000.76983*centuries
+	result.p = 83.3532465 + 4069.0137287*centuries
+	result.n = 125.04452 - 1934.136261*centuries
+	result.p1 = 282.93735 + 1.71946*centuries
+	result.tau = 180.0 + 15.0*t.Sub(midnight).Hours() + result.h - result.s
+	return result
+}
+
+// constituent describes a tidal constituent by its Doodson numbers,
+// which multiply (tau, s, h, p, N', p1), plus a phase offset in degrees
+type constituent struct {
+	doodson [6]float64
+	offset  float64
+	nodal   func(n float64) (f, u float64)
+}
+
+func (c constituent) argument(a astronomical) float64 {
+	// Doodson's N' is the negative of the node longitude
+	return c.doodson[0]*a.tau + c.doodson[1]*a.s + c.doodson[2]*a.h +
+		c.doodson[3]*a.p - c.doodson[4]*a.n + c.doodson[5]*a.p1 + c.offset
+}
+
+// Nodal corrections (amplitude factor f, phase correction u in degrees)
+// after Schureman, as functions of the longitude of the lunar node
+func nodalNone(n float64) (float64, float64) {
+	return 1.0, 0.0
+}
+
+func nodalM2(n float64) (float64, float64) {
+	n = radians(n)
+	return 1.0004 - 0.0373*math.Cos(n) + 0.0002*math.Cos(2*n), -2.14 * math.Sin(n)
+}
+
+func nodalM4(n float64) (float64, float64) {
+	f, u := nodalM2(n)
+	return f * f, 2 * u
+}
+
+func nodalM6(n float64) (float64, float64) {
+	f, u := nodalM2(n)
+	return f * f * f, 3 * u
+}
+
+func nodalK1(n float64) (float64, float64) {
+	n = radians(n)
+	return 1.0060 + 0.1150*math.Cos(n) - 0.0088*math.Cos(2*n) + 0.0006*math.Cos(3*n),
+		-8.86*math.Sin(n) + 0.68*math.Sin(2*n) - 0.07*math.Sin(3*n)
+}
+
+func nodalO1(n float64) (float64, float64) {
+	n = radians(n)
+	return 1.0089 + 0.1871*math.Cos(n) - 0.0147*math.Cos(2*n) + 0.0014*math.Cos(3*n),
+		10.80*math.Sin(n) - 1.34*math.Sin(2*n) + 0.19*math.Sin(3*n)
+}
+
+func nodalK2(n float64) (float64, float64) {
+	n = radians(n)
+	return 1.0241 + 0.2863*math.Cos(n) + 0.0083*math.Cos(2*n) - 0.0015*math.Cos(3*n),
+		-17.74*math.Sin(n) + 0.68*math.Sin(2*n) - 0.04*math.Sin(3*n)
+}
+
+func nodalMf(n float64) (float64, float64) {
+	n = radians(n)
+	return 1.043 + 0.414*math.Cos(n), -23.74*math.Sin(n) + 2.68*math.Sin(2*n) - 0.38*math.Sin(3*n)
+}
+
+func nodalMm(n float64) (float64, float64) {
+	return 1.0 - 0.130*math.Cos(radians(n)), 0.0
+}
+
+var constituents = map[string]constituent{
+	"M2":  {doodson: [6]float64{2, 0, 0, 0, 0, 0}, nodal: nodalM2},
+	"S2":  {doodson: [6]float64{2, 2, -2, 0, 0, 0}, nodal: nodalNone},
+	"N2":  {doodson: [6]float64{2, -1, 0, 1, 0, 0}, nodal: nodalM2},
+	"K2":  {doodson: [6]float64{2, 2, 0, 0, 0, 0}, nodal: nodalK2},
+	"2N2": {doodson: [6]float64{2, -2, 0, 2, 0, 0}, nodal: nodalM2},
+	"MU2": {doodson: [6]float64{2, -2, 2, 0, 0, 0}, nodal: nodalM2},
+	"NU2": {doodson: [6]float64{2, -1, 2, -1, 0, 0}, nodal: nodalM2},
+	"L2":  {doodson: [6]float64{2, 1, 0, -1, 0, 0}, offset: 180, nodal: nodalM2},
+	"T2":  {doodson: [6]float64{2, 2, -3, 0, 0, 1}, nodal: nodalNone},
+	"K1":  {doodson: [6]float64{1, 1, 0, 0, 0, 0}, offset: 90, nodal: nodalK1},
+	"O1":  {doodson: [6]float64{1, -1, 0, 0, 0, 0}, offset: -90, nodal: nodalO1},
+	"P1":  {doodson: [6]float64{1, 1, -2, 0, 0, 0}, offset: -90, nodal: nodalNone},
+	"Q1":  {doodson: [6]float64{1, -2, 0, 1, 0, 0}, offset: -90, nodal: nodalO1},
+	"M4":  {doodson: [6]float64{4, 0, 0, 0, 0, 0}, nodal: nodalM4},
+	"MS4": {doodson: [6]float64{4, 2, -2, 0, 0, 0}, nodal: nodalM2},
+	"MN4": {doodson: [6]float64{4, -1, 0, 1, 0, 0}, nodal: nodalM4},
+	"S4":  {doodson: [6]float64{4, 4, -4, 0, 0, 0}, nodal: nodalNone},
+	"M6":  {doodson: [6]float64{6, 0, 0, 0, 0, 0}, nodal: nodalM6},
+	"MF":  {doodson: [6]float64{0, 2, 0, 0, 0, 0}, nodal: nodalMf},
+	"MM":  {doodson: [6]float64{0, 1, 0, -1, 0, 0}, nodal: nodalMm},
+	"SSA": {doodson: [6]float64{0, 0, 2, 0, 0, 0}, nodal: nodalNone},
+	"SA":  {doodson: [6]float64{0, 0, 1, 0, 0, 0}, nodal: nodalNone},
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180.0
+}
+
+// haversine returns the great circle distance in kilometers
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLon := radians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
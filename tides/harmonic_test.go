@@ -0,0 +1,137 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tides
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+const testingConstituentsFile = "testdata/constituents.json"
+
+// Published constituent speeds, in degrees per hour
+var constituentSpeeds = map[string]float64{
+	"M2": 28.9841042,
+	"S2": 30.0,
+	"N2": 28.4397295,
+	"K2": 30.0821373,
+	"K1": 15.0410686,
+	"O1": 13.9430356,
+	"P1": 14.9589314,
+	"Q1": 13.3986609,
+	"M4": 57.9682084,
+	"MF": 1.0980331,
+}
+
+func TestConstituentSpeeds(t *testing.T) {
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	before := astronomicalArguments(start)
+	after := astronomicalArguments(start.Add(time.Hour))
+	for name, speed := range constituentSpeeds {
+		c := constituents[name]
+		delta := math.Mod(c.argument(after)-c.argument(before)+720.0, 360.0)
+		assert.InDelta(t, speed, delta, 1e-4, "Wrong speed for constituent %v", name)
+	}
+}
+
+func TestLoadHarmonicSource(t *testing.T) {
+	source, err := LoadHarmonicSource(testingConstituentsFile)
+	assert.Nil(t, err, "Failed to load constituents: %v", err)
+	assert.Equal(t, 2, len(source.Stations))
+
+	_, err = LoadHarmonicSource("")
+	assert.NotNil(t, err, "Expected a missing file name to fail")
+
+	_, err = LoadHarmonicSource("testdata/does-not-exist.json")
+	assert.NotNil(t, err, "Expected a missing file to fail")
+}
+
+func TestNearestStation(t *testing.T) {
+	source, _ := LoadHarmonicSource(testingConstituentsFile)
+
+	station, distance := source.NearestStation(37.7, -122.5)
+	assert.Equal(t, "9414290", station.ID)
+	assert.InDelta(t, 12.1, distance, 0.5)
+
+	station, _ = source.NearestStation(21.0, -158.0)
+	assert.Equal(t, "1612340", station.ID)
+
+	source.MaxDistance = 100
+	station, _ = source.NearestStation(0, 0)
+	assert.Nil(t, station, "Expected no station within 100 km of 0, 0")
+}
+
+func TestHarmonicPrediction(t *testing.T) {
+	source, _ := LoadHarmonicSource(testingConstituentsFile)
+	in := tidesIn{Locations: []tideIn{
+		{Lat: 37.7, Lon: -122.5, Dtg: "2016-12-01-19-32"},
+		{Lat: 37.7, Lon: -122.5, Dtg: "not a dtg"},
+	}}
+
+	results, err := source.Tides(context.Background(), in, &util.BasicLogContext{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Nil(t, results[1], "Expected no result for an invalid DTG")
+
+	result := results[0]
+	assert.True(t, result.MinTide <= result.CurrTide && result.CurrTide <= result.MaxTide,
+		"Expected %v to fall between %v and %v", result.CurrTide, result.MinTide, result.MaxTide)
+
+	// The daily range at San Francisco is roughly one to two and a half meters
+	tideRange := result.MaxTide - result.MinTide
+	assert.True(t, tideRange > 0.8 && tideRange < 3.0, "Unexpected tide range %v", tideRange)
+}
+
+func TestGetTidesHarmonic(t *testing.T) {
+	fc, err := getTestingFeatureCollection()
+	if err != nil {
+		t.Fatalf("Failed loading testing feature collection %v", err)
+	}
+	source, _ := LoadHarmonicSource(testingConstituentsFile)
+	ctx := context.Background()
+	context := Context{Source: source}
+
+	fc, err = GetTides(ctx, fc, &context)
+	assert.Nil(t, err, "Expected GetTides to succeed but received: %v", err)
+	assert.NotEmpty(t, fc.Features)
+	for _, feature := range fc.Features {
+		assert.False(t, math.IsNaN(feature.PropertyFloat("CurrentTide")))
+	}
+}
+
+func TestGetTideSeriesHarmonic(t *testing.T) {
+	fc, err := getTestingFeatureCollection()
+	if err != nil {
+		t.Fatalf("Failed loading testing feature collection %v", err)
+	}
+	source, _ := LoadHarmonicSource(testingConstituentsFile)
+	ctx := context.Background()
+	context := Context{Source: source}
+	options := SeriesOptions{Window: 6 * time.Hour, Interval: 30 * time.Minute}
+
+	fc, err = GetTideSeries(ctx, fc, options, &context)
+	assert.Nil(t, err, "Expected GetTideSeries to succeed but received: %v", err)
+	assert.NotEmpty(t, fc.Features)
+	series, ok := fc.Features[0].Properties["TideSeries"].([]map[string]interface{})
+	assert.True(t, ok, "Expected a TideSeries property")
+	assert.Equal(t, 13, len(series))
+	_, err = time.Parse(time.RFC3339, series[0]["time"].(string))
+	assert.Nil(t, err, "Expected RFC 3339 series times")
+}
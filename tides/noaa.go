@@ -0,0 +1,301 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tides
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// DefaultNOAAURL is the NOAA CO-OPS data retrieval API
+const DefaultNOAAURL = "https://api.tidesandcurrents.noaa.gov/api/prod/datagetter"
+
+const (
+	noaaRequestFormat  = "20060102 15:04"
+	noaaResponseFormat = "2006-01-02 15:04"
+)
+
+// NOAASource is a TideSource backed by the NOAA CO-OPS tide predictions
+// product, using the station nearest each location
+type NOAASource struct {
+	URL         string
+	Stations    []HarmonicStation // only the station IDs and positions are used
+	MaxDistance float64           // in kilometers; zero means no limit
+	Datum       string            // defaults to MLLW
+}
+
+type noaaPrediction struct {
+	T string `json:"t"`
+	V string `json:"v"`
+}
+
+type noaaResponse struct {
+	Predictions []noaaPrediction `json:"predictions"`
+	Error       *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Name returns the name of this source
+func (s *NOAASource) Name() string {
+	return NOAASourceName
+}
+
+// Limits on the requests made to NOAA
+const (
+	noaaMaxWindow   = 31 * 24 * time.Hour // NOAA serves up to a month of six-minute predictions at once
+	noaaConcurrency = 4
+)
+
+// noaaLocation is a location to predict tides for, with the station and
+// span of predictions it needs
+type noaaLocation struct {
+	inx        int
+	t          time.Time
+	series     []time.Time
+	begin, end time.Time
+	station    *HarmonicStation
+	distance   float64
+}
+
+// noaaGroup is a set of locations whose predictions come from the same
+// request to NOAA
+type noaaGroup struct {
+	station    string
+	begin, end time.Time
+	locations  []noaaLocation
+}
+
+// Tides requests a day of predictions around each location's time from its
+// nearest station. Locations sharing a station and an overlapping span of
+// time are served by a single request, and only a few requests are made at
+// once.
+func (s *NOAASource) Tides(ctx context.Context, in tidesIn, context util.LogContext) ([]*tideOut, error) {
+	var (
+		lastErr error
+		wait    sync.WaitGroup
+	)
+	result := make([]*tideOut, len(in.Locations))
+	groups := s.groups(in, context)
+	// Log contexts create their session IDs lazily, so settle it before
+	// logging from several goroutines
+	context.SessionID()
+	errs := make([]error, len(groups))
+	semaphore := make(chan struct{}, noaaConcurrency)
+	for inx := range groups {
+		wait.Add(1)
+		go func(group noaaGroup, err *error) {
+			defer wait.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			*err = s.groupTides(ctx, group, result, context)
+		}(groups[inx], &errs[inx])
+	}
+	wait.Wait()
+	for inx, err := range errs {
+		if util.IsCanceled(err) {
+			return nil, err
+		} else if err != nil {
+			util.LogInfo(context, fmt.Sprintf("Failed to get NOAA tides for station %v: %v", groups[inx].station, err.Error()))
+			lastErr = err
+		}
+	}
+	for _, curr := range result {
+		if curr != nil {
+			return result, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return result, nil
+}
+
+// groups finds each location's station and the predictions it needs, and
+// groups together locations whose predictions can be requested at once
+func (s *NOAASource) groups(in tidesIn, context util.LogContext) []noaaGroup {
+	var (
+		locations []noaaLocation
+		result    []noaaGroup
+	)
+	for inx, location := range in.Locations {
+		dtgTime, err := time.Parse(dtgFormat, location.Dtg)
+		if err != nil {
+			util.LogInfo(context, "Could not parse tide DTG "+location.Dtg)
+			continue
+		}
+		station, distance := nearestStation(s.Stations, s.MaxDistance, location.Lat, location.Lon)
+		if station == nil {
+			util.LogInfo(context, fmt.Sprintf("No NOAA station within %v km of %v, %v", s.MaxDistance, location.Lat, location.Lon))
+			continue
+		}
+		curr := noaaLocation{inx: inx, t: dtgTime, series: location.series(), station: station, distance: distance}
+		curr.begin, curr.end = dtgTime.Add(-12*time.Hour), dtgTime.Add(12*time.Hour)
+		if len(curr.series) > 0 && curr.series[0].Before(curr.begin) {
+			curr.begin = curr.series[0]
+		}
+		if len(curr.series) > 0 && curr.series[len(curr.series)-1].After(curr.end) {
+			curr.end = curr.series[len(curr.series)-1]
+		}
+		locations = append(locations, curr)
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		if locations[i].station.ID != locations[j].station.ID {
+			return locations[i].station.ID < locations[j].station.ID
+		}
+		return locations[i].begin.Before(locations[j].begin)
+	})
+	for _, location := range locations {
+		if last := len(result) - 1; last >= 0 && result[last].station == location.station.ID &&
+			!location.begin.After(result[last].end) && maxTime(result[last].end, location.end).Sub(result[last].begin) <= noaaMaxWindow {
+			result[last].end = maxTime(result[last].end, location.end)
+			result[last].locations = append(result[last].locations, location)
+			continue
+		}
+		result = append(result, noaaGroup{station: location.station.ID, begin: location.begin, end: location.end, locations: []noaaLocation{location}})
+	}
+	return result
+}
+
+// groupTides requests the predictions for a group and fills in the results
+// for its locations
+func (s *NOAASource) groupTides(ctx context.Context, group noaaGroup, result []*tideOut, context util.LogContext) error {
+	predictions, err := s.predictions(ctx, group.station, group.begin, group.end, context)
+	if err != nil {
+		return err
+	}
+	times, values, err := parsePredictions(predictions)
+	if err != nil {
+		return err
+	}
+	for _, location := range group.locations {
+		tides := toTideOut(times, values, location.t, location.series)
+		tides.Station = location.station.ID
+		tides.Distance = location.distance
+		result[location.inx] = tides
+	}
+	return nil
+}
+
+func (s *NOAASource) predictions(ctx context.Context, stationID string, begin, end time.Time, context util.LogContext) ([]noaaPrediction, error) {
+	var response noaaResponse
+
+	datum := s.Datum
+	if datum == "" {
+		datum = "MLLW"
+	}
+	baseURL := s.URL
+	if baseURL == "" {
+		baseURL = DefaultNOAAURL
+	}
+	query := url.Values{}
+	query.Set("product", "predictions")
+	query.Set("station", stationID)
+	query.Set("begin_date", begin.UTC().Format(noaaRequestFormat))
+	query.Set("end_date", end.UTC().Format(noaaRequestFormat))
+	query.Set("datum", datum)
+	query.Set("units", "metric")
+	query.Set("time_zone", "gmt")
+	query.Set("interval", "6")
+	query.Set("format", "json")
+	requestURL := baseURL + "?" + query.Encode()
+
+	util.LogAudit(context, util.LogAuditInput{Actor: "anon user", Action: "GET", Actee: requestURL, Message: "Requesting NOAA tide predictions", Severity: util.INFO})
+	request, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = requestJSON(util.WithEndpoint(request, "noaa"), &response); err != nil {
+		return nil, err
+	}
+	util.LogAudit(context, util.LogAuditInput{Actor: requestURL, Action: "GET response", Actee: "anon user", Message: "Retrieving NOAA tide predictions", Severity: util.INFO})
+	if response.Error != nil {
+		return nil, errors.New("NOAA tide predictions failed: " + response.Error.Message)
+	}
+	return response.Predictions, nil
+}
+
+// parsePredictions reads the times and values of NOAA's predictions
+func parsePredictions(predictions []noaaPrediction) ([]time.Time, []float64, error) {
+	var (
+		times  = make([]time.Time, len(predictions))
+		values = make([]float64, len(predictions))
+		err    error
+	)
+	if len(predictions) == 0 {
+		return nil, nil, errors.New("NOAA returned no tide predictions")
+	}
+	for inx, prediction := range predictions {
+		if times[inx], err = time.Parse(noaaResponseFormat, prediction.T); err != nil {
+			return nil, nil, fmt.Errorf("Invalid NOAA prediction time %v", prediction.T)
+		}
+		if values[inx], err = strconv.ParseFloat(prediction.V, 64); err != nil {
+			return nil, nil, fmt.Errorf("Invalid NOAA prediction value %v", prediction.V)
+		}
+	}
+	return times, values, nil
+}
+
+// toTideOut takes the current tide from the prediction nearest to t, the
+// extremes from the predictions within 12 hours of t, and each series
+// sample from the prediction nearest to it
+func toTideOut(times []time.Time, values []float64, t time.Time, series []time.Time) *tideOut {
+	result := tideOut{MinTide: math.Inf(1), MaxTide: math.Inf(-1)}
+	for inx := range times {
+		if absDuration(times[inx].Sub(t)) <= 12*time.Hour {
+			result.MinTide = math.Min(result.MinTide, values[inx])
+			result.MaxTide = math.Max(result.MaxTide, values[inx])
+		}
+	}
+	result.CurrTide = values[nearestTime(times, t)]
+	for _, sampleTime := range series {
+		result.Series = append(result.Series, tideSample{Dtg: sampleTime.Format(dtgFormat), Tide: values[nearestTime(times, sampleTime)]})
+	}
+	return &result
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func nearestTime(times []time.Time, t time.Time) int {
+	result := 0
+	for inx := range times {
+		if absDuration(times[inx].Sub(t)) < absDuration(times[result].Sub(t)) {
+			result = inx
+		}
+	}
+	return result
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
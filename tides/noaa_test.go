@@ -0,0 +1,124 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tides
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+func TestNOAASource(t *testing.T) {
+	server := createMockNOAAServer()
+	defer server.Close()
+	stations, _ := loadStations(testingConstituentsFile)
+	source := NOAASource{URL: server.URL, Stations: stations}
+	in := tidesIn{Locations: []tideIn{
+		{Lat: 37.7, Lon: -122.5, Dtg: "2016-12-01-19-32"},
+		{Lat: 21.3, Lon: -157.9, Dtg: "2016-12-01-19-32"},
+	}}
+
+	results, err := source.Tides(context.Background(), in, &util.BasicLogContext{})
+	assert.Nil(t, err, "Expected NOAA tides to succeed: %v", err)
+	result := results[0]
+	assert.Equal(t, "9414290", result.Station)
+	assert.InDelta(t, 0.0, result.MinTide, 0.01)
+	assert.InDelta(t, 2.0, result.MaxTide, 0.01)
+	assert.True(t, result.MinTide <= result.CurrTide && result.CurrTide <= result.MaxTide)
+	assert.Nil(t, results[1], "Expected no result for a station NOAA does not know")
+}
+
+func TestNOAASourceSeries(t *testing.T) {
+	server := createMockNOAAServer()
+	defer server.Close()
+	stations, _ := loadStations(testingConstituentsFile)
+	source := NOAASource{URL: server.URL, Stations: stations}
+	in := tidesIn{Locations: []tideIn{
+		{Lat: 37.7, Lon: -122.5, Dtg: "2016-12-01-19-32", Start: "2016-11-30-19-32", End: "2016-12-02-19-32", Interval: 60},
+	}}
+
+	results, err := source.Tides(context.Background(), in, &util.BasicLogContext{})
+	assert.Nil(t, err, "Expected NOAA tides to succeed: %v", err)
+	assert.Equal(t, 49, len(results[0].Series))
+	assert.Equal(t, "2016-11-30-19-32", results[0].Series[0].Dtg)
+	assert.InDelta(t, 0.0, results[0].Series[0].Tide, 0.01, "Expected the series to start at the beginning of the request")
+}
+
+func TestNOAASourceAllFail(t *testing.T) {
+	server := createMockNOAAServer()
+	defer server.Close()
+	stations, _ := loadStations(testingConstituentsFile)
+	source := NOAASource{URL: server.URL, Stations: stations[1:]}
+	in := tidesIn{Locations: []tideIn{{Lat: 21.3, Lon: -157.9, Dtg: "2016-12-01-19-32"}}}
+
+	_, err := source.Tides(context.Background(), in, &util.BasicLogContext{})
+	assert.NotNil(t, err, "Expected an error when NOAA fails for every location")
+}
+
+func TestNOAASourceGroupsRequests(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		requests []string
+	)
+	mock := createMockNOAAServer()
+	defer mock.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		requests = append(requests, request.FormValue("begin_date")+" - "+request.FormValue("end_date"))
+		mutex.Unlock()
+		mock.Config.Handler.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+	stations, _ := loadStations(testingConstituentsFile)
+	source := NOAASource{URL: server.URL, Stations: stations}
+	in := tidesIn{Locations: []tideIn{
+		{Lat: 37.7, Lon: -122.5, Dtg: "2016-12-01-19-32"},
+		{Lat: 37.8, Lon: -122.4, Dtg: "2016-12-01-21-00"},
+		{Lat: 37.7, Lon: -122.5, Dtg: "2016-12-02-03-15"},
+		{Lat: 37.7, Lon: -122.5, Dtg: "2017-06-01-12-00"},
+	}}
+
+	results, err := source.Tides(context.Background(), in, &util.BasicLogContext{})
+	assert.Nil(t, err, "Expected NOAA tides to succeed: %v", err)
+	assert.Equal(t, 2, len(requests), "Expected one request for the overlapping days and one for June: %v", requests)
+	assert.Contains(t, requests, "20161201 07:32 - 20161202 15:15")
+	for inx, result := range results {
+		if assert.NotNil(t, result, "Expected a result for location %v", inx) {
+			assert.Equal(t, "9414290", result.Station)
+			assert.True(t, result.MinTide <= result.CurrTide && result.CurrTide <= result.MaxTide)
+		}
+	}
+}
+
+func TestParsePredictions(t *testing.T) {
+	_, _, err := parsePredictions(nil)
+	assert.NotNil(t, err, "Expected an error without predictions")
+
+	_, _, err = parsePredictions([]noaaPrediction{{T: "2016-12-01 19:30", V: "high"}})
+	assert.NotNil(t, err, "Expected an error for a bad value")
+
+	times, values, err := parsePredictions([]noaaPrediction{{T: "2016-12-01 19:30", V: "1.5"}, {T: "2016-12-01 19:36", V: "1.6"}})
+	assert.Nil(t, err)
+	result := toTideOut(times, values, time.Date(2016, 12, 1, 19, 35, 0, 0, time.UTC), nil)
+	assert.Equal(t, 1.6, result.CurrTide)
+	assert.Equal(t, 1.5, result.MinTide)
+	assert.Equal(t, 1.6, result.MaxTide)
+}
@@ -0,0 +1,243 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tides
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+)
+
+// Names of the available tide sources
+const (
+	ServiceSourceName  = "service"
+	HarmonicSourceName = "harmonic"
+	NOAASourceName     = "noaa"
+)
+
+// TideSource is anything that can predict tides for a set of locations
+type TideSource interface {
+	// Name identifies the source in logs
+	Name() string
+	// Tides returns one result per input location, in the same order.
+	// A nil result means that no prediction is available for that location.
+	// Requests made for the predictions are abandoned once ctx is done.
+	Tides(ctx context.Context, in tidesIn, context util.LogContext) ([]*tideOut, error)
+}
+
+// ServiceSource is a TideSource backed by the Beachfront tide prediction service
+type ServiceSource struct {
+	URL string
+}
+
+// Name returns the name of this source
+func (s *ServiceSource) Name() string {
+	return ServiceSourceName
+}
+
+// Tides posts the locations to the tide prediction service
+func (s *ServiceSource) Tides(ctx context.Context, in tidesIn, context util.LogContext) ([]*tideOut, error) {
+	var tout out
+
+	util.LogAudit(context, util.LogAuditInput{Actor: "anon user", Action: "POST", Actee: s.URL, Message: "Requesting tide information", Severity: util.INFO})
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	// Predictions change nothing, so they are safe to retry
+	if err = requestJSON(util.WithEndpoint(util.RetrySafe(request), "predictions"), &tout); err != nil {
+		return nil, err
+	}
+	util.LogAudit(context, util.LogAuditInput{Actor: s.URL, Action: "POST response", Actee: "anon user", Message: "Retrieving tide information", Severity: util.INFO})
+
+	// The service identifies its results by DTG rather than by position
+	dtgResultMap := make(map[string]*tideOut)
+	for inx := range tout.Locations {
+		dtgResultMap[tout.Locations[inx].Dtg] = &tout.Locations[inx].Results
+	}
+	result := make([]*tideOut, len(in.Locations))
+	for inx, location := range in.Locations {
+		result[inx] = dtgResultMap[location.Dtg]
+	}
+	return result, nil
+}
+
+// ErrNoSeriesSource is returned for a tide series requested from a source
+// that cannot predict one
+var ErrNoSeriesSource = util.HTTPErr{Status: http.StatusNotImplemented, Message: "Tide series needs the harmonic or noaa source."}
+
+// CanPredictSeries reports whether the source can predict a tide series.
+// The tide prediction service, which is also used when source is nil,
+// cannot; a CompositeSource can if any of its sources can.
+func CanPredictSeries(source TideSource) bool {
+	switch source := source.(type) {
+	case nil, *ServiceSource:
+		return false
+	case *CompositeSource:
+		for _, curr := range source.Sources {
+			if CanPredictSeries(curr) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// CompositeSource is a TideSource that tries each of its sources in
+// order, asking each one only for the locations still without a result
+type CompositeSource struct {
+	Sources []TideSource
+}
+
+// Name returns the names of the underlying sources, comma-separated
+func (s *CompositeSource) Name() string {
+	var names []string
+	for _, source := range s.Sources {
+		names = append(names, source.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Tides collects results from each source in turn until every location
+// has a result or the sources run out. A failing source is logged and skipped.
+func (s *CompositeSource) Tides(ctx context.Context, in tidesIn, context util.LogContext) ([]*tideOut, error) {
+	var lastErr error
+	result := make([]*tideOut, len(in.Locations))
+	remaining := make([]int, len(in.Locations))
+	for inx := range remaining {
+		remaining[inx] = inx
+	}
+	for _, source := range s.Sources {
+		if len(remaining) == 0 {
+			break
+		}
+		var subIn tidesIn
+		for _, inx := range remaining {
+			subIn.Locations = append(subIn.Locations, in.Locations[inx])
+		}
+		subResults, err := source.Tides(ctx, subIn, context)
+		if util.IsCanceled(err) {
+			return nil, err
+		}
+		if err != nil {
+			util.LogAlert(context, fmt.Sprintf("Tide source %v failed: %v", source.Name(), err.Error()))
+			lastErr = err
+			continue
+		}
+		var stillRemaining []int
+		for subInx, inx := range remaining {
+			if subResults[subInx] == nil {
+				stillRemaining = append(stillRemaining, inx)
+				continue
+			}
+			if subResults[subInx].Source == "" {
+				subResults[subInx].Source = source.Name()
+			}
+			result[inx] = subResults[subInx]
+			// Keep looking for a source that can provide a requested series
+			if len(subResults[subInx].Series) == 0 && in.Locations[inx].series() != nil {
+				stillRemaining = append(stillRemaining, inx)
+			}
+		}
+		remaining = stillRemaining
+	}
+	// Only fail outright if no source produced anything at all
+	if lastErr != nil {
+		for _, curr := range result {
+			if curr != nil {
+				return result, nil
+			}
+		}
+		if len(in.Locations) > 0 {
+			return nil, lastErr
+		}
+	}
+	return result, nil
+}
+
+// SourceOptions holds the settings needed to create any of the tide sources
+type SourceOptions struct {
+	TidesURL     string  // the Beachfront tide prediction service
+	NOAAURL      string  // the NOAA CO-OPS data API
+	StationsFile string  // JSON file of stations, with constituents for the harmonic source
+	MaxDistance  float64 // in kilometers; zero means no limit
+}
+
+// NewSource creates a TideSource by name. A comma-separated list of names
+// creates a CompositeSource that tries those sources in order.
+func NewSource(name string, options SourceOptions) (TideSource, error) {
+	if strings.Contains(name, ",") {
+		var composite CompositeSource
+		for _, subName := range strings.Split(name, ",") {
+			source, err := NewSource(strings.TrimSpace(subName), options)
+			if err != nil {
+				return nil, err
+			}
+			composite.Sources = append(composite.Sources, source)
+		}
+		return &composite, nil
+	}
+	switch name {
+	case "", ServiceSourceName:
+		return &ServiceSource{URL: options.TidesURL}, nil
+	case HarmonicSourceName:
+		source, err := LoadHarmonicSource(options.StationsFile)
+		if err != nil {
+			return nil, err
+		}
+		source.MaxDistance = options.MaxDistance
+		return source, nil
+	case NOAASourceName:
+		stations, err := loadStations(options.StationsFile)
+		if err != nil {
+			return nil, err
+		}
+		return &NOAASource{URL: options.NOAAURL, Stations: stations, MaxDistance: options.MaxDistance}, nil
+	default:
+		return nil, fmt.Errorf("Unknown tide source: %v", name)
+	}
+}
+
+// requestJSON sends a request with the tides client profile and reads
+// the JSON response into output
+func requestJSON(request *http.Request, output interface{}) error {
+	response, err := util.Do(util.TidesProfile, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		errByt, _ := ioutil.ReadAll(response.Body)
+		return &util.Error{LogMsg: "Failed HTTP request", Response: string(errByt), URL: request.URL.String(), HTTPStatus: response.StatusCode,
+			SimpleMsg: "Received " + http.StatusText(response.StatusCode) + " on call to " + request.URL.String() + ".  Further details logged."}
+	}
+	if _, err = util.ReadBodyJSON(output, response.Body); err != nil && request.Context().Err() != nil {
+		return util.Canceled(request.Context())
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tides
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/venicegeo/dg-bf-ia-broker/util"
+	"github.com/venicegeo/dg-geojson-go/geojson"
+)
+
+type failingSource struct{}
+
+func (s failingSource) Name() string {
+	return "failing"
+}
+
+func (s failingSource) Tides(ctx context.Context, in tidesIn, context util.LogContext) ([]*tideOut, error) {
+	return nil, errors.New("Source is down")
+}
+
+func TestNewSource(t *testing.T) {
+	source, err := NewSource("", SourceOptions{TidesURL: "http://tides.test"})
+	assert.Nil(t, err)
+	assert.Equal(t, ServiceSourceName, source.Name())
+
+	source, err = NewSource(HarmonicSourceName, SourceOptions{StationsFile: testingConstituentsFile})
+	assert.Nil(t, err)
+	assert.Equal(t, HarmonicSourceName, source.Name())
+
+	source, err = NewSource("noaa, harmonic", SourceOptions{StationsFile: testingConstituentsFile})
+	assert.Nil(t, err)
+	assert.Equal(t, "noaa,harmonic", source.Name())
+	_, ok := source.(*CompositeSource)
+	assert.True(t, ok, "Expected a list of sources to create a CompositeSource")
+
+	_, err = NewSource(HarmonicSourceName, SourceOptions{})
+	assert.NotNil(t, err, "Expected the harmonic source to require a stations file")
+
+	_, err = NewSource("bogus", SourceOptions{})
+	assert.NotNil(t, err, "Expected an unknown source to fail")
+}
+
+func TestCanPredictSeries(t *testing.T) {
+	harmonic, err := NewSource(HarmonicSourceName, SourceOptions{StationsFile: testingConstituentsFile})
+	assert.Nil(t, err)
+	service := &ServiceSource{URL: "http://tides.test"}
+	assert.False(t, CanPredictSeries(nil))
+	assert.False(t, CanPredictSeries(service))
+	assert.True(t, CanPredictSeries(harmonic))
+	assert.True(t, CanPredictSeries(&CompositeSource{Sources: []TideSource{service, harmonic}}))
+	assert.False(t, CanPredictSeries(&CompositeSource{Sources: []TideSource{service}}))
+
+	_, err = GetTideSeries(context.Background(), geojson.NewFeatureCollection(nil), SeriesOptions{Window: time.Hour, Interval: time.Minute}, &Context{TidesURL: service.URL})
+	assert.Equal(t, ErrNoSeriesSource, err)
+}
+
+func TestCompositeSourceFallback(t *testing.T) {
+	harmonic, _ := LoadHarmonicSource(testingConstituentsFile)
+	harmonic.MaxDistance = 50
+	nearHawaii := &HarmonicSource{Stations: harmonic.Stations[1:]}
+	composite := CompositeSource{Sources: []TideSource{failingSource{}, harmonic, nearHawaii}}
+	in := tidesIn{Locations: []tideIn{
+		{Lat: 37.7, Lon: -122.5, Dtg: "2016-12-01-19-32"},
+		{Lat: 21.3, Lon: -157.9, Dtg: "2016-12-01-19-32"},
+	}}
+
+	results, err := composite.Tides(context.Background(), in, &util.BasicLogContext{})
+	assert.Nil(t, err, "Expected a failing source to be skipped: %v", err)
+	assert.Equal(t, HarmonicSourceName, results[0].Source)
+	assert.Equal(t, "9414290", results[0].Station)
+	assert.Equal(t, "1612340", results[1].Station, "Expected the second location to fall through to the last source")
+
+	composite = CompositeSource{Sources: []TideSource{failingSource{}}}
+	_, err = composite.Tides(context.Background(), in, &util.BasicLogContext{})
+	assert.NotNil(t, err, "Expected an error when every source fails")
+}
+
+func TestCompositeSourceCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ioutil.ReadAll(request.Body)
+		select {
+		case <-request.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+	harmonic, _ := LoadHarmonicSource(testingConstituentsFile)
+	composite := CompositeSource{Sources: []TideSource{&ServiceSource{URL: server.URL}, harmonic}}
+	in := tidesIn{Locations: []tideIn{{Lat: 37.7, Lon: -122.5, Dtg: "2016-12-01-19-32"}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results, err := composite.Tides(ctx, in, &util.BasicLogContext{})
+	assert.True(t, util.IsCanceled(err), "Expected the request to be abandoned, received %v", err)
+	assert.Nil(t, results, "Expected no fallback once the request is abandoned")
+}
+
+func TestGetTidesProvenance(t *testing.T) {
+	fc, err := getTestingFeatureCollection()
+	if err != nil {
+		t.Fatalf("Failed loading testing feature collection %v", err)
+	}
+	source, _ := NewSource("service,harmonic", SourceOptions{TidesURL: "http://localhost:0/tides", StationsFile: testingConstituentsFile})
+	ctx := context.Background()
+	context := Context{Source: source}
+
+	fc, err = GetTides(ctx, fc, &context)
+	assert.Nil(t, err, "Expected GetTides to succeed but received: %v", err)
+	assert.NotEmpty(t, fc.Features)
+	feature := fc.Features[0]
+	assert.Equal(t, HarmonicSourceName, feature.PropertyString("TideSource"))
+	assert.Equal(t, "9414290", feature.PropertyString("TideStation"))
+	assert.True(t, feature.PropertyFloat("TideStationDistance") < 50)
+}
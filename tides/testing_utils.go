@@ -2,8 +2,10 @@ package tides
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/venicegeo/dg-geojson-go/geojson"
@@ -37,6 +39,30 @@ func CreateMockTidesServer() *httptest.Server {
 	return server
 }
 
+// createMockNOAAServer creates a mocked NOAA CO-OPS server that returns a
+// sinusoidal tide between 0 and 2 meters with a period of about 12.4 hours,
+// starting at its low at the requested begin date
+func createMockNOAAServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.FormValue("station") != "9414290" {
+			writer.Write([]byte(`{"error":{"message":"No Predictions data was found."}}`))
+			return
+		}
+		begin, _ := time.Parse(noaaRequestFormat, request.FormValue("begin_date"))
+		end, _ := time.Parse(noaaRequestFormat, request.FormValue("end_date"))
+		body := `{"predictions":[`
+		for curr, inx := begin, 0; !curr.After(end); curr, inx = curr.Add(6*time.Minute), inx+1 {
+			if inx > 0 {
+				body += ","
+			}
+			value := 1.0 - math.Cos(2.0*math.Pi*float64(inx)/124.0)
+			body += fmt.Sprintf(`{"t":"%s","v":"%.3f"}`, curr.Format(noaaResponseFormat), value)
+		}
+		body += "]}"
+		writer.Write([]byte(body))
+	}))
+}
+
 func getTestingFeatureCollection() (fc *geojson.FeatureCollection, err error) {
 	fci, err := geojson.ParseFile("testdata/fc.geojson")
 	if err != nil {
@@ -15,9 +15,11 @@
 package tides
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
 	"github.com/venicegeo/dg-bf-ia-broker/util"
 	"github.com/venicegeo/dg-geojson-go/geojson"
 )
@@ -25,7 +27,9 @@ import (
 // Context is the context for this operation
 type Context struct {
 	TidesURL  string
+	Source    TideSource // if nil, the tide prediction service at TidesURL is used
 	sessionID string
+	requestID string
 }
 
 // AppName returns an empty string
@@ -46,10 +50,45 @@ func (c *Context) LogRootDir() string {
 	return ""
 }
 
+// RequestID returns the ID of the request the predictions are for, if any
+func (c *Context) RequestID() string {
+	return c.requestID
+}
+
+// SetRequestID ties the context to the request with the given ID
+func (c *Context) SetRequestID(id string) {
+	c.requestID = id
+}
+
+// dtgFormat is the date-time group format used by the tide prediction service
+const dtgFormat = "2006-01-02-15-04"
+
+// tideIn is a single tide request. If Start and End are set, a series of
+// tide heights every Interval minutes between them is requested as well.
 type tideIn struct {
-	Lat float64 `json:"lat"`
-	Lon float64 `json:"lon"`
-	Dtg string  `json:"dtg"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Dtg      string  `json:"dtg"`
+	Start    string  `json:"start,omitempty"`
+	End      string  `json:"end,omitempty"`
+	Interval int     `json:"interval,omitempty"`
+}
+
+// series returns the times of the requested series, or nil if none was requested
+func (in tideIn) series() []time.Time {
+	var result []time.Time
+	start, err := time.Parse(dtgFormat, in.Start)
+	if err != nil || in.Interval <= 0 {
+		return nil
+	}
+	end, err := time.Parse(dtgFormat, in.End)
+	if err != nil {
+		return nil
+	}
+	for curr := start; !curr.After(end); curr = curr.Add(time.Duration(in.Interval) * time.Minute) {
+		result = append(result, curr)
+	}
+	return result
 }
 
 type tidesIn struct {
@@ -57,9 +96,24 @@ type tidesIn struct {
 }
 
 type tideOut struct {
-	MinTide  float64 `json:"minimumTide24Hours"`
-	MaxTide  float64 `json:"maximumTide24Hours"`
-	CurrTide float64 `json:"currentTide"`
+	MinTide  float64      `json:"minimumTide24Hours"`
+	MaxTide  float64      `json:"maximumTide24Hours"`
+	CurrTide float64      `json:"currentTide"`
+	Series   []tideSample `json:"series,omitempty"`
+	Source   string       `json:"-"` // name of the source that produced the values
+	Station  string       `json:"-"` // station used, if the source reports one
+	Distance float64      `json:"-"` // distance to the station in kilometers
+}
+
+type tideSample struct {
+	Dtg  string  `json:"dtg"`
+	Tide float64 `json:"tide"`
+}
+
+// SeriesOptions describe a tide series around each feature's acquired date
+type SeriesOptions struct {
+	Window   time.Duration // total length, centered on the acquired date
+	Interval time.Duration // time between samples
 }
 
 type tideWrapper struct {
@@ -73,7 +127,7 @@ type out struct {
 	Locations []tideWrapper `json:"locations"`
 }
 
-func toTideIn(bbox geojson.BoundingBox, timeStr string) *tideIn {
+func toTideIn(bbox geojson.BoundingBox, timeStr string, series *SeriesOptions) *tideIn {
 	var (
 		center  *geojson.Point
 		dtgTime time.Time
@@ -85,13 +139,20 @@ func toTideIn(bbox geojson.BoundingBox, timeStr string) *tideIn {
 	if dtgTime, err = time.Parse("2006-01-02T15:04:05Z", timeStr); err != nil {
 		return nil
 	}
-	return &tideIn{Lat: center.Coordinates[1], Lon: center.Coordinates[0], Dtg: dtgTime.Format("2006-01-02-15-04")}
+	result := tideIn{Lat: center.Coordinates[1], Lon: center.Coordinates[0], Dtg: dtgTime.Format(dtgFormat)}
+	if series != nil {
+		result.Start = dtgTime.Add(-series.Window / 2).Format(dtgFormat)
+		result.End = dtgTime.Add(series.Window / 2).Format(dtgFormat)
+		result.Interval = int(series.Interval / time.Minute)
+	}
+	return &result
 }
 
-func toTidesIn(features []*geojson.Feature, context util.LogContext) (result tidesIn, dtgFeatureMap map[string]*geojson.Feature) {
-	dtgFeatureMap = make(map[string]*geojson.Feature)
+// toTidesIn returns the tide locations for the features along with
+// the feature that each location was derived from
+func toTidesIn(features []*geojson.Feature, series *SeriesOptions, context util.LogContext) (result tidesIn, locationFeatures []*geojson.Feature) {
 	for _, feature := range features {
-		currTideIn := toTideIn(feature.ForceBbox(), feature.PropertyString("acquiredDate"))
+		currTideIn := toTideIn(feature.ForceBbox(), feature.PropertyString("acquiredDate"), series)
 		if currTideIn == nil {
 			util.LogInfo(context, fmt.Sprintf("Could not get tide information from feature %v because required elements did not exist. BBOX: %#v, Date: %v",
 				feature.IDStr(),
@@ -100,43 +161,95 @@ func toTidesIn(features []*geojson.Feature, context util.LogContext) (result tid
 			continue
 		}
 		result.Locations = append(result.Locations, *currTideIn)
-		dtgFeatureMap[currTideIn.Dtg] = feature
+		locationFeatures = append(locationFeatures, feature)
 	}
 	return
 }
 
 // GetTides returns the tide information for the features provided.
-// Features must have a geometry and an acquiredDate property.
-func GetTides(fc *geojson.FeatureCollection, context *Context) (*geojson.FeatureCollection, error) {
+// Features must have a geometry and an acquiredDate property. Requests
+// made for the tides are abandoned once ctx is done.
+func GetTides(ctx context.Context, fc *geojson.FeatureCollection, context *Context) (*geojson.FeatureCollection, error) {
+	ctx, span := trace.Start(ctx, "tides.GetTides")
+	defer span.End()
+	result, err := getTides(ctx, fc, nil, context)
+	span.SetError(err)
+	return result, err
+}
+
+// GetTideSeries is GetTides, but also adds a TideSeries property holding
+// the tide heights over a window around each feature's acquired date
+func GetTideSeries(ctx context.Context, fc *geojson.FeatureCollection, options SeriesOptions, context *Context) (*geojson.FeatureCollection, error) {
+	ctx, span := trace.Start(ctx, "tides.GetTideSeries")
+	defer span.End()
+	if !CanPredictSeries(context.Source) {
+		span.SetError(ErrNoSeriesSource)
+		return nil, ErrNoSeriesSource
+	}
+	result, err := getTides(ctx, fc, &options, context)
+	span.SetError(err)
+	return result, err
+}
+
+func getTides(ctx context.Context, fc *geojson.FeatureCollection, series *SeriesOptions, context *Context) (*geojson.FeatureCollection, error) {
 	var (
-		err    error
-		tout   out
-		result *geojson.FeatureCollection
+		err     error
+		results []*tideOut
+		result  *geojson.FeatureCollection
 	)
-	tidesURL := context.TidesURL
-	tin, dtgFeatureMap := toTidesIn(fc.Features, context)
+	source := context.Source
+	if source == nil {
+		source = &ServiceSource{URL: context.TidesURL}
+	}
+	tin, locationFeatures := toTidesIn(fc.Features, series, context)
+	span := trace.FromContext(ctx)
+	span.SetAttribute("tides.source", source.Name())
+	span.SetAttribute("feature_count", len(tin.Locations))
 
-	util.LogAudit(context, util.LogAuditInput{Actor: "anon user", Action: "POST", Actee: tidesURL, Message: "Requesting tide information", Severity: util.INFO})
-	if _, err = util.ReqByObjJSON("POST", tidesURL, "", tin, &tout); err != nil {
+	if results, err = source.Tides(ctx, tin, context); err != nil {
 		return nil, err
 	}
-	util.LogAudit(context, util.LogAuditInput{Actor: tidesURL, Action: "POST response", Actee: "anon user", Message: "Retrieving tide information", Severity: util.INFO})
 
 	tideFeatures := []*geojson.Feature{}
-	for _, outputLocation := range tout.Locations {
-		if _, ok := dtgFeatureMap[outputLocation.Dtg]; !ok {
-			util.LogInfo(context, "Failed to find location for output dtg "+outputLocation.Dtg)
+	for inx, location := range tin.Locations {
+		if results[inx] == nil {
+			util.LogInfo(context, "Failed to find "+source.Name()+" tide information for dtg "+location.Dtg)
 			continue
 		}
-		oldFeaturePtr, _ := dtgFeatureMap[outputLocation.Dtg]
-		newFeature := *oldFeaturePtr
-		newFeature.Properties["CurrentTide"] = outputLocation.Results.CurrTide
-		newFeature.Properties["MinimumTide24Hours"] = outputLocation.Results.MinTide
-		newFeature.Properties["MaximumTide24Hours"] = outputLocation.Results.MaxTide
+		newFeature := *locationFeatures[inx]
+		newFeature.Properties["CurrentTide"] = results[inx].CurrTide
+		newFeature.Properties["MinimumTide24Hours"] = results[inx].MinTide
+		newFeature.Properties["MaximumTide24Hours"] = results[inx].MaxTide
+		if results[inx].Source == "" {
+			newFeature.Properties["TideSource"] = source.Name()
+		} else {
+			newFeature.Properties["TideSource"] = results[inx].Source
+		}
+		if results[inx].Station != "" {
+			newFeature.Properties["TideStation"] = results[inx].Station
+			newFeature.Properties["TideStationDistance"] = results[inx].Distance
+		}
+		if series != nil {
+			newFeature.Properties["TideSeries"] = toSeriesProperty(results[inx].Series)
+		}
 		tideFeatures = append(tideFeatures, &newFeature)
 	}
 
 	result = geojson.NewFeatureCollection(tideFeatures)
+	span.SetAttribute("tides.found", len(tideFeatures))
 
 	return result, err
 }
+
+// toSeriesProperty converts the samples to RFC 3339 times to match acquiredDate
+func toSeriesProperty(samples []tideSample) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, sample := range samples {
+		sampleTime, err := time.Parse(dtgFormat, sample.Dtg)
+		if err != nil {
+			continue
+		}
+		result = append(result, map[string]interface{}{"time": sampleTime.Format(time.RFC3339), "tide": sample.Tide})
+	}
+	return result
+}
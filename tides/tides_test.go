@@ -15,6 +15,7 @@
 package tides
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,13 +25,14 @@ import (
 func TestGetTides(t *testing.T) {
 	fc, err := getTestingFeatureCollection()
 	server := CreateMockTidesServer()
+	ctx := context.Background()
 	context := Context{TidesURL: server.URL}
 
 	if err != nil {
 		t.Fatalf("Failed loading testing feature collection %v", err)
 	}
 
-	fc, err = GetTides(fc, &context)
+	fc, err = GetTides(ctx, fc, &context)
 	assert.Nil(t, err, "Expected GetTides to succeed but received: %v", err)
 
 	_, err = geojson.Write(fc)
@@ -0,0 +1,316 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The exporters that can be configured
+const (
+	ExportNone   = "none"
+	ExportStdout = "stdout"
+	ExportFile   = "file"
+	ExportOTLP   = "otlp"
+)
+
+// An Exporter sends spans that have ended somewhere
+type Exporter interface {
+	Export(span SpanData) error
+	Close() error
+}
+
+// WriterExporter writes each span as a line of JSON, for reading locally
+type WriterExporter struct {
+	mutex   sync.Mutex
+	writer  io.Writer
+	service string
+}
+
+// NewWriterExporter returns an exporter writing spans of the named service
+// to writer
+func NewWriterExporter(writer io.Writer, service string) *WriterExporter {
+	return &WriterExporter{writer: writer, service: service}
+}
+
+// NewFileExporter returns an exporter appending spans to a file
+func NewFileExporter(path, service string) (*WriterExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterExporter(file, service), nil
+}
+
+type spanLine struct {
+	TraceID         string                 `json:"traceID"`
+	SpanID          string                 `json:"spanID"`
+	ParentSpanID    string                 `json:"parentSpanID,omitempty"`
+	Service         string                 `json:"service"`
+	Name            string                 `json:"name"`
+	Kind            string                 `json:"kind"`
+	Start           time.Time              `json:"start"`
+	DurationSeconds float64                `json:"durationSeconds"`
+	Attributes      map[string]interface{} `json:"attributes,omitempty"`
+	Error           string                 `json:"error,omitempty"`
+}
+
+// Export implements Exporter
+func (e *WriterExporter) Export(span SpanData) error {
+	line := spanLine{TraceID: span.TraceID.String(), SpanID: span.SpanID.String(), Service: e.service,
+		Name: span.Name, Kind: span.Kind.String(), Start: span.Start.UTC(),
+		DurationSeconds: span.End.Sub(span.Start).Seconds(), Attributes: span.Attributes, Error: span.Error}
+	if span.ParentSpanID.IsValid() {
+		line.ParentSpanID = span.ParentSpanID.String()
+	}
+	bytes, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err = e.writer.Write(append(bytes, '\n'))
+	return err
+}
+
+// Close implements Exporter, closing the writer if it is a file other than
+// standard output or standard error
+func (e *WriterExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if file, ok := e.writer.(*os.File); ok && file != os.Stdout && file != os.Stderr {
+		return file.Close()
+	}
+	return nil
+}
+
+// Limits on the spans the OTLP exporter holds and sends at once
+const (
+	otlpQueueSize  = 2048
+	otlpBatchSize  = 512
+	otlpBatchDelay = 5 * time.Second
+	otlpTimeout    = 10 * time.Second
+)
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector, using
+// OTLP's JSON encoding over HTTP. Spans that arrive while the queue is full
+// are dropped rather than slowing requests down.
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+	mutex   sync.Mutex // guards closed and sending to queue
+	closed  bool
+	queue   chan SpanData
+	done    chan struct{}
+}
+
+// OTLPURL returns the URL spans are sent to for an endpoint. One without a
+// path, such as http://collector:4318, gets OTLP's default of /v1/traces.
+func OTLPURL(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("%#v is not an http or https URL", endpoint)
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/v1/traces"
+	}
+	return parsed.String(), nil
+}
+
+// NewOTLPExporter returns an exporter sending spans of the named service to
+// a collector at the endpoint
+func NewOTLPExporter(endpoint, service string) (*OTLPExporter, error) {
+	address, err := OTLPURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	e := &OTLPExporter{url: address, service: service, client: &http.Client{Timeout: otlpTimeout},
+		queue: make(chan SpanData, otlpQueueSize), done: make(chan struct{})}
+	go e.run()
+	return e, nil
+}
+
+// Export implements Exporter
+func (e *OTLPExporter) Export(span SpanData) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.closed {
+		return errors.New("the trace exporter is closed")
+	}
+	select {
+	case e.queue <- span:
+		return nil
+	default:
+		return errors.New("the trace export queue is full")
+	}
+}
+
+// Close implements Exporter, sending the spans still queued
+func (e *OTLPExporter) Close() error {
+	e.mutex.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mutex.Unlock()
+	<-e.done
+	return nil
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(otlpBatchDelay)
+	defer ticker.Stop()
+	var batch []SpanData
+	for {
+		select {
+		case span, ok := <-e.queue:
+			if !ok {
+				e.send(batch)
+				return
+			}
+			if batch = append(batch, span); len(batch) >= otlpBatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []SpanData) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(otlpRequest(e.service, batch))
+	if err == nil {
+		err = e.post(body)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export %d spans: %v\n", len(batch), err)
+	}
+}
+
+func (e *OTLPExporter) post(body []byte) error {
+	response, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%v returned %v: %s", e.url, response.Status, message)
+	}
+	return nil
+}
+
+// The OTLP JSON encoding, in which IDs are hex and 64-bit integers are
+// strings
+type (
+	otlpAttribute struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              SpanKind        `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// OTLP status codes
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+func otlpRequest(service string, batch []SpanData) map[string]interface{} {
+	spans := make([]otlpSpan, len(batch))
+	for index, span := range batch {
+		spans[index] = otlpSpan{TraceID: span.TraceID.String(), SpanID: span.SpanID.String(), Name: span.Name, Kind: span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10), EndTimeUnixNano: strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes: otlpAttributes(span.Attributes), Status: otlpStatus{Code: otlpStatusUnset}}
+		if span.ParentSpanID.IsValid() {
+			spans[index].ParentSpanID = span.ParentSpanID.String()
+		}
+		if span.Error != "" {
+			spans[index].Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+	}
+	return map[string]interface{}{"resourceSpans": []interface{}{map[string]interface{}{
+		"resource": map[string]interface{}{"attributes": otlpAttributes(map[string]interface{}{"service.name": service})},
+		"scopeSpans": []interface{}{map[string]interface{}{
+			"scope": map[string]string{"name": "github.com/venicegeo/dg-bf-ia-broker/trace"},
+			"spans": spans,
+		}},
+	}}}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]otlpAttribute, len(keys))
+	for index, key := range keys {
+		result[index] = otlpAttribute{Key: key, Value: otlpValue(attributes[key])}
+	}
+	return result
+}
+
+func otlpValue(value interface{}) map[string]interface{} {
+	switch typed := value.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": typed}
+	case bool:
+		return map[string]interface{}{"boolValue": typed}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(typed)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(typed, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": typed}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(value)}
+}
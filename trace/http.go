@@ -0,0 +1,137 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader carries a caller's span, as W3C Trace Context defines it
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent reads a traceparent header value. Versions after 00 are
+// read as far as version 00 goes, as the specification asks.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || (parts[0] == "00" && len(parts) != 4) || parts[0] == "ff" {
+		return sc, false
+	}
+	for index, length := range []int{2, 32, 16, 2} {
+		if len(parts[index]) != length || !isLowerHex(parts[index]) {
+			return sc, false
+		}
+	}
+	hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	flags, _ := hex.DecodeString(parts[3])
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+func isLowerHex(value string) bool {
+	for _, c := range value {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatTraceparent writes a traceparent header value
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Inject sets the traceparent header of a request made on behalf of the
+// span in ctx, or of the remote caller if there is no span
+func Inject(ctx context.Context, header http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		header.Set(TraceparentHeader, FormatTraceparent(sc))
+	}
+}
+
+// statusRecorder notes the status a handler writes
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(bytes []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(bytes)
+}
+
+// Flush lets handlers that stream their responses keep doing so
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Handler traces the requests a handler serves, continuing the caller's
+// trace if the request has a traceparent header. The route, such as
+// /planet/{itemType}/{id}, names the spans. Handlers can add attributes to
+// the span, which FromContext finds in the request's context.
+func Handler(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		if remote, ok := ParseTraceparent(request.Header.Get(TraceparentHeader)); ok {
+			ctx = ContextWithRemote(ctx, remote)
+		}
+		ctx, span := StartKind(ctx, KindServer, request.Method+" "+route)
+		if span == nil {
+			handler.ServeHTTP(writer, request.WithContext(ctx))
+			return
+		}
+		defer span.End()
+		span.SetAttribute("http.method", request.Method)
+		span.SetAttribute("http.route", route)
+		recorder := &statusRecorder{ResponseWriter: writer}
+		defer func() {
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			span.SetAttribute("http.status_code", recorder.status)
+			if recorder.status >= 500 {
+				span.SetError(errorStatus(recorder.status))
+			}
+		}()
+		handler.ServeHTTP(recorder, request.WithContext(ctx))
+	})
+}
+
+// errorStatus is a server error status as an error
+type errorStatus int
+
+func (s errorStatus) Error() string {
+	return http.StatusText(int(s))
+}
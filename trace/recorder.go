@@ -0,0 +1,53 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import "sync"
+
+// Recorder is an Exporter that keeps spans in memory, for tests
+type Recorder struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+// Export implements Exporter
+func (r *Recorder) Export(span SpanData) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = append(r.spans, span)
+	return nil
+}
+
+// Close implements Exporter
+func (r *Recorder) Close() error {
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended
+func (r *Recorder) Spans() []SpanData {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]SpanData(nil), r.spans...)
+}
+
+// Find returns the first span exported with the given name
+func (r *Recorder) Find(name string) (SpanData, bool) {
+	for _, span := range r.Spans() {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return SpanData{}, false
+}
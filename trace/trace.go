@@ -0,0 +1,241 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace: the spans of one request, in every service
+// it reaches
+type TraceID [16]byte
+
+// String returns the ID in hex, as traceparent headers carry it
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether the ID is set, as an all-zero ID is invalid
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the ID in hex, as traceparent headers carry it
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether the ID is set, as an all-zero ID is invalid
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// SpanKind tells whether a span serves a request, makes one or neither,
+// numbered as OTLP numbers them
+type SpanKind int
+
+// The kinds of span
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// SpanData is what exporters receive of a span that has ended
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID // invalid for the root span
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Error        string // empty unless the span failed
+}
+
+// A Span times one operation. Its methods may be called on a nil Span,
+// which is what Start returns while tracing is disabled, and do nothing.
+type Span struct {
+	mutex    sync.Mutex
+	data     SpanData
+	sampled  bool
+	exporter Exporter
+	ended    bool
+}
+
+var (
+	providerMutex sync.RWMutex
+	exporter      Exporter // nil while tracing is disabled
+	sampleRatio   = 1.0
+)
+
+// SetExporter starts sending spans to the exporter, or stops tracing if it
+// is nil, and closes the exporter used before. Traces are started for the
+// given fraction of requests that do not arrive as part of one; those that
+// do are traced if their caller's trace is.
+func SetExporter(newExporter Exporter, ratio float64) {
+	providerMutex.Lock()
+	previous := exporter
+	exporter, sampleRatio = newExporter, math.Max(0, math.Min(1, ratio))
+	providerMutex.Unlock()
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close trace exporter: %v\n", err)
+		}
+	}
+}
+
+// Enabled reports whether spans are being exported
+func Enabled() bool {
+	providerMutex.RLock()
+	defer providerMutex.RUnlock()
+	return exporter != nil
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// FromContext returns the span in ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the context of the span in ctx, or else
+// that of the remote caller, if any
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := FromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	remote, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return remote
+}
+
+// ContextWithRemote makes spans started in ctx children of a caller's span
+func ContextWithRemote(ctx context.Context, remote SpanContext) context.Context {
+	if !remote.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, remote)
+}
+
+// Start starts a span, the child of any span in ctx, and returns a context
+// holding it. The span must be ended.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, KindInternal, name)
+}
+
+// StartKind is Start for a span of the given kind
+func StartKind(ctx context.Context, kind SpanKind, name string) (context.Context, *Span) {
+	providerMutex.RLock()
+	currentExporter, ratio := exporter, sampleRatio
+	providerMutex.RUnlock()
+	if currentExporter == nil {
+		return ctx, nil
+	}
+	span := &Span{exporter: currentExporter, data: SpanData{Name: name, Kind: kind, Start: time.Now()}}
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		span.data.TraceID, span.data.ParentSpanID, span.sampled = parent.TraceID, parent.SpanID, parent.Sampled
+	} else {
+		rand.Read(span.data.TraceID[:])
+		span.sampled = ratio >= 1 || mathrand.Float64() < ratio
+	}
+	rand.Read(span.data.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanContext returns the span's IDs and sampling decision
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Sampled: s.sampled}
+}
+
+// SetAttribute notes something about the operation. Values should be
+// strings, bools, integers or floats.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the operation as failed, if err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.data.Error = err.Error()
+	}
+}
+
+// End ends the span and exports it if its trace is sampled. Only the
+// first call has any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mutex.Unlock()
+	if !s.sampled {
+		return
+	}
+	if err := s.exporter.Export(data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export span: %v\n", err)
+	}
+}
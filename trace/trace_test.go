@@ -0,0 +1,220 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisabled(t *testing.T) {
+	SetExporter(nil, 1)
+	ctx, span := Start(context.Background(), "nothing")
+	assert.Nil(t, span)
+	assert.Equal(t, context.Background(), ctx)
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("ignored"))
+	span.End()
+	assert.False(t, Enabled())
+
+	// A caller's trace is still passed on
+	remote := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}, Sampled: true}
+	header := http.Header{}
+	Inject(ContextWithRemote(context.Background(), remote), header)
+	assert.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", header.Get(TraceparentHeader))
+}
+
+func TestSpans(t *testing.T) {
+	recorder := &Recorder{}
+	SetExporter(recorder, 1)
+	defer SetExporter(nil, 1)
+
+	ctx, parent := Start(context.Background(), "parent")
+	require.NotNil(t, parent)
+	assert.Equal(t, parent, FromContext(ctx))
+	_, child := StartKind(ctx, KindClient, "child")
+	child.SetAttribute("count", 3)
+	child.SetError(errors.New("failed"))
+	child.End()
+	child.SetAttribute("late", true)
+	child.End()
+	parent.End()
+
+	spans := recorder.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, KindClient, spans[0].Kind)
+	assert.Equal(t, map[string]interface{}{"count": 3}, spans[0].Attributes)
+	assert.Equal(t, "failed", spans[0].Error)
+	assert.Equal(t, "parent", spans[1].Name)
+	assert.Equal(t, spans[1].TraceID, spans[0].TraceID)
+	assert.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	assert.False(t, spans[1].ParentSpanID.IsValid())
+	assert.True(t, spans[1].TraceID.IsValid())
+	assert.False(t, spans[0].End.Before(spans[0].Start))
+}
+
+func TestSampling(t *testing.T) {
+	recorder := &Recorder{}
+	SetExporter(recorder, 0)
+	defer SetExporter(nil, 1)
+
+	ctx, span := Start(context.Background(), "unsampled")
+	header := http.Header{}
+	Inject(ctx, header)
+	span.End()
+	assert.Empty(t, recorder.Spans())
+	sc, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	assert.True(t, ok)
+	assert.False(t, sc.Sampled)
+
+	// A caller's decision is followed
+	remote := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}, Sampled: true}
+	_, span = Start(ContextWithRemote(context.Background(), remote), "sampled")
+	span.End()
+	if spans := recorder.Spans(); assert.Len(t, spans, 1) {
+		assert.Equal(t, remote.TraceID, spans[0].TraceID)
+		assert.Equal(t, remote.SpanID, spans[0].ParentSpanID)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", FormatTraceparent(sc))
+
+	_, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	assert.True(t, ok, "Expected a later version to be read")
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g",
+	} {
+		_, ok = ParseTraceparent(value)
+		assert.False(t, ok, "Expected %#v to be invalid", value)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	recorder := &Recorder{}
+	SetExporter(recorder, 1)
+	defer SetExporter(nil, 1)
+
+	handler := Handler("/items/{id}", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		FromContext(request.Context()).SetAttribute("item", "a")
+		writer.WriteHeader(http.StatusBadGateway)
+	}))
+	request := httptest.NewRequest("GET", "/items/a", nil)
+	request.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	span, ok := recorder.Find("GET /items/{id}")
+	require.True(t, ok)
+	assert.Equal(t, KindServer, span.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentSpanID.String())
+	assert.Equal(t, map[string]interface{}{"http.method": "GET", "http.route": "/items/{id}", "http.status_code": 502, "item": "a"}, span.Attributes)
+	assert.Equal(t, "Bad Gateway", span.Error)
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buffer bytes.Buffer
+	SetExporter(NewWriterExporter(&buffer, "test-service"), 1)
+	defer SetExporter(nil, 1)
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	child.SetAttribute("cache_hit", true)
+	child.End()
+	parent.End()
+
+	lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var line map[string]interface{}
+	require.Nil(t, json.Unmarshal(lines[0], &line))
+	assert.Equal(t, "child", line["name"])
+	assert.Equal(t, "internal", line["kind"])
+	assert.Equal(t, "test-service", line["service"])
+	assert.Equal(t, parent.SpanContext().SpanID.String(), line["parentSpanID"])
+	assert.Equal(t, map[string]interface{}{"cache_hit": true}, line["attributes"])
+	assert.NotContains(t, line, "error")
+}
+
+func TestOTLPExporter(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, "/v1/traces", request.URL.Path)
+		assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(request.Body)
+		bodies <- body
+	}))
+	defer collector.Close()
+	exporter, err := NewOTLPExporter(collector.URL, "test-service")
+	require.Nil(t, err)
+	SetExporter(exporter, 1)
+	_, span := StartKind(context.Background(), KindServer, "GET /items")
+	span.SetAttribute("feature_count", 12)
+	span.SetAttribute("ratio", 0.5)
+	span.SetError(errors.New("failed"))
+	span.End()
+	SetExporter(nil, 1) // Closing sends the queued span
+
+	var request struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpAttribute
+			}
+			ScopeSpans []struct {
+				Spans []map[string]interface{}
+			}
+		}
+	}
+	require.Nil(t, json.Unmarshal(<-bodies, &request))
+	require.Len(t, request.ResourceSpans, 1)
+	assert.Equal(t, []otlpAttribute{{Key: "service.name", Value: map[string]interface{}{"stringValue": "test-service"}}}, request.ResourceSpans[0].Resource.Attributes)
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	assert.Equal(t, span.SpanContext().TraceID.String(), spans[0]["traceId"])
+	assert.Equal(t, "GET /items", spans[0]["name"])
+	assert.Equal(t, 2.0, spans[0]["kind"])
+	assert.NotContains(t, spans[0], "parentSpanId")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "feature_count", "value": map[string]interface{}{"intValue": "12"}},
+		map[string]interface{}{"key": "ratio", "value": map[string]interface{}{"doubleValue": 0.5}},
+	}, spans[0]["attributes"])
+	assert.Equal(t, map[string]interface{}{"code": 2.0, "message": "failed"}, spans[0]["status"])
+
+	assert.NotNil(t, exporter.Export(SpanData{}), "Expected a closed exporter to refuse spans")
+	_, err = NewOTLPExporter("collector:4318", "test-service")
+	assert.NotNil(t, err)
+	address, _ := OTLPURL("https://collector.example.com/custom/path")
+	assert.Equal(t, "https://collector.example.com/custom/path", address)
+}
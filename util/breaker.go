@@ -0,0 +1,144 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// BreakerSettings control the circuit breaker kept for each upstream host.
+// After enough consecutive transient failures the circuit opens and requests
+// fail at once; after the cooldown one request is let through to test it.
+type BreakerSettings struct {
+	Failures int // consecutive failures that open the circuit; 0 disables it
+	Cooldown time.Duration
+}
+
+// DefaultBreakerSettings opens a circuit for 30 seconds after 5 failures
+func DefaultBreakerSettings() BreakerSettings {
+	return BreakerSettings{Failures: 5, Cooldown: 30 * time.Second}
+}
+
+// BreakerState describes the circuit breaker for one host
+type BreakerState struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`
+	OpenUntil *time.Time `json:"openUntil,omitempty"`
+}
+
+type circuitBreaker struct {
+	failures  int
+	openUntil time.Time
+	trial     bool // a request is testing the half-open circuit
+}
+
+var (
+	breakerSettings BreakerSettings
+	breakers        map[string]*circuitBreaker
+)
+
+func (b *circuitBreaker) state(now time.Time) string {
+	switch {
+	case b.failures < breakerSettings.Failures:
+		return CircuitClosed
+	case now.Before(b.openUntil):
+		return CircuitOpen
+	}
+	return CircuitHalfOpen
+}
+
+// allowRequest reports whether a request may be sent to the host and, if
+// not, how long until it may be
+func allowRequest(host string) (time.Duration, bool) {
+	resilienceMutex.Lock()
+	defer resilienceMutex.Unlock()
+	breaker, ok := breakers[host]
+	if !ok || breakerSettings.Failures == 0 {
+		return 0, true
+	}
+	now := time.Now()
+	switch breaker.state(now) {
+	case CircuitOpen:
+		return breaker.openUntil.Sub(now), false
+	case CircuitHalfOpen:
+		if breaker.trial {
+			return breakerSettings.Cooldown, false
+		}
+		breaker.trial = true
+	}
+	return 0, true
+}
+
+// releaseTrial lets another request test a half-open circuit when one was
+// abandoned without an outcome, such as when its context was canceled
+func releaseTrial(host string) {
+	resilienceMutex.Lock()
+	defer resilienceMutex.Unlock()
+	if breaker, ok := breakers[host]; ok {
+		breaker.trial = false
+	}
+}
+
+func recordOutcome(host string, success bool) {
+	resilienceMutex.Lock()
+	defer resilienceMutex.Unlock()
+	if breakerSettings.Failures == 0 {
+		return
+	}
+	breaker, ok := breakers[host]
+	if !ok {
+		if success {
+			return
+		}
+		breaker = &circuitBreaker{}
+		breakers[host] = breaker
+	}
+	breaker.trial = false
+	if success {
+		delete(breakers, host)
+		return
+	}
+	breaker.failures++
+	if breaker.failures >= breakerSettings.Failures {
+		breaker.openUntil = time.Now().Add(breakerSettings.Cooldown)
+		LogAlert(&BasicLogContext{}, fmt.Sprintf("Opened the circuit to %v after %d failures", host, breaker.failures))
+	}
+}
+
+// BreakerStates returns the state of the circuit to each host that has
+// failed recently. Hosts that are not listed are closed.
+func BreakerStates() map[string]BreakerState {
+	resilienceMutex.RLock()
+	defer resilienceMutex.RUnlock()
+	now := time.Now()
+	result := make(map[string]BreakerState)
+	for host, breaker := range breakers {
+		state := BreakerState{State: breaker.state(now), Failures: breaker.failures}
+		if state.State != CircuitClosed {
+			openUntil := breaker.openUntil
+			state.OpenUntil = &openUntil
+		}
+		result[host] = state
+	}
+	return result
+}
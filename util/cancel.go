@@ -0,0 +1,70 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// StatusClientClosedRequest is the status, borrowed from nginx, for a
+// request that the client gave up on before it was answered
+const StatusClientClosedRequest = 499
+
+// Canceled returns an HTTPErr once ctx is done: a 499 if the client went
+// away, or a 504 if the request ran out of time. Until then it returns nil.
+func Canceled(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return HTTPErr{Status: http.StatusGatewayTimeout, Message: "The request took too long to complete."}
+	default:
+		return HTTPErr{Status: StatusClientClosedRequest, Message: "The request was canceled."}
+	}
+}
+
+// IsCanceled reports whether err is one returned by Canceled
+func IsCanceled(err error) bool {
+	herr, ok := err.(HTTPErr)
+	return ok && (herr.Status == StatusClientClosedRequest || herr.Status == http.StatusGatewayTimeout)
+}
+
+// Sleep waits for d, returning early with the error from Canceled if ctx
+// is done first
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return Canceled(ctx)
+	}
+}
+
+// WithTimeout gives each request a deadline, after which the upstream
+// requests made for it are abandoned
+func WithTimeout(timeout time.Duration, handler http.Handler) http.Handler {
+	if timeout <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx, cancel := context.WithTimeout(request.Context(), timeout)
+		defer cancel()
+		handler.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCanceled(t *testing.T) {
+	if err := Canceled(context.Background()); err != nil {
+		t.Errorf("Canceled: expected nil for a live context, received %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Canceled(ctx); !IsCanceled(err) || err.(HTTPErr).Status != StatusClientClosedRequest {
+		t.Errorf("Canceled: expected a 499, received %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if err := Canceled(ctx); !IsCanceled(err) || err.(HTTPErr).Status != http.StatusGatewayTimeout {
+		t.Errorf("Canceled: expected a 504, received %v", err)
+	}
+	if IsCanceled(HTTPErr{Status: http.StatusTooManyRequests}) {
+		t.Error("IsCanceled: a 429 is not a cancellation")
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if err := Sleep(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("Sleep: expected nil, received %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if err := Sleep(ctx, time.Minute); !IsCanceled(err) {
+		t.Errorf("Sleep: expected a cancellation, received %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Sleep: expected to wake when the context was canceled")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	handler := WithTimeout(time.Minute, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		deadline, ok = request.Context().Deadline()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !ok || time.Until(deadline) < 50*time.Second {
+		t.Errorf("WithTimeout: expected a deadline a minute away, received %v", deadline)
+	}
+
+	handler = WithTimeout(0, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, ok = request.Context().Deadline()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if ok {
+		t.Error("WithTimeout: expected no deadline when the timeout is zero")
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	setTestingResilience(3, 1)
+	defer SetResilience(DefaultRetrySettings(), DefaultBreakerSettings())
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-request.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	start := time.Now()
+	response, err := Do(DefaultProfile, request)
+	if response != nil || !IsCanceled(err) || err.(HTTPErr).Status != http.StatusGatewayTimeout {
+		t.Errorf("Do: expected a 504 when the deadline passed, received %v %v", response, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Do: expected to give up at the deadline")
+	}
+	// Abandoning a request is not a failure of the host
+	for _, state := range BreakerStates() {
+		if state.Failures > 0 {
+			t.Errorf("Do: expected no failures to be recorded, received %v", state)
+		}
+	}
+}
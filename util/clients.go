@@ -0,0 +1,199 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Names of the HTTP client profiles, one for each upstream service
+const (
+	DefaultProfile  = "default"
+	PlanetProfile   = "planet"
+	TidesProfile    = "tides"
+	LandsatProfile  = "landsat"
+	SentinelProfile = "sentinel"
+)
+
+// ClientProfiles lists the profiles, one for each upstream service and the default
+var ClientProfiles = []string{DefaultProfile, PlanetProfile, TidesProfile, LandsatProfile, SentinelProfile}
+
+// ClientProfile configures the HTTP client used to reach an upstream service
+type ClientProfile struct {
+	ConnectTimeout      time.Duration // to connect and complete a TLS handshake
+	ReadTimeout         time.Duration // to receive response headers once the request is sent
+	Timeout             time.Duration // for the whole exchange, including reading the body
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int    // 0 means no limit
+	CAFile              string // PEM certificates trusted in addition to the system's
+	CertFile            string // PEM client certificate, for mutual TLS
+	KeyFile             string
+	Proxy               string // an http, https or socks5 URL; if empty, HTTP_PROXY and friends apply
+	InsecureSkipVerify  bool
+}
+
+// DefaultClientProfile returns the settings for the named profile before
+// any are configured
+func DefaultClientProfile(name string) ClientProfile {
+	result := ClientProfile{
+		ConnectTimeout:      10 * time.Second,
+		ReadTimeout:         30 * time.Second,
+		Timeout:             time.Minute,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+	}
+	if name == LandsatProfile {
+		// The scene list is a large download
+		result.ReadTimeout = time.Minute
+		result.Timeout = 10 * time.Minute
+	}
+	return result
+}
+
+var (
+	clientsMutex sync.Mutex
+	clients      = make(map[string]*http.Client)
+)
+
+// NewClient creates an HTTP client from a profile
+func NewClient(profile ClientProfile) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: profile.InsecureSkipVerify}
+	if profile.CAFile != "" {
+		pem, err := ioutil.ReadFile(profile.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig.RootCAs, err = x509.SystemCertPool(); err != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %v", profile.CAFile)
+		}
+	}
+	if profile.CertFile != "" || profile.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(profile.CertFile, profile.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	proxy := http.ProxyFromEnvironment
+	if profile.Proxy != "" {
+		proxyURL, err := url.Parse(profile.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("Unsupported proxy scheme %#v", proxyURL.Scheme)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           (&net.Dialer{Timeout: profile.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   profile.ConnectTimeout,
+		ResponseHeaderTimeout: profile.ReadTimeout,
+		MaxIdleConns:          profile.MaxIdleConns,
+		MaxIdleConnsPerHost:   profile.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       profile.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+	return &http.Client{Transport: transport, Timeout: profile.Timeout}, nil
+}
+
+// SetClientProfile replaces the client for the named profile
+func SetClientProfile(name string, profile ClientProfile) error {
+	client, err := NewClient(profile)
+	if err != nil {
+		return fmt.Errorf("HTTP client profile %v: %v", name, err)
+	}
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	clients[name] = client
+	return nil
+}
+
+// SetClientProfiles replaces the clients for the named profiles, reporting
+// the first that is misconfigured. If any is, none are replaced.
+func SetClientProfiles(profiles map[string]ClientProfile) error {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	created := make(map[string]*http.Client, len(profiles))
+	for _, name := range names {
+		client, err := NewClient(profiles[name])
+		if err != nil {
+			return fmt.Errorf("HTTP client profile %v: %v", name, err)
+		}
+		created[name] = client
+	}
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	for name, client := range created {
+		clients[name] = client
+	}
+	return nil
+}
+
+// Client returns the client for the named profile, creating one with the
+// default settings if the profile has not been configured
+func Client(name string) *http.Client {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	client, ok := clients[name]
+	if !ok {
+		// The defaults name no files or proxy, so they cannot fail
+		client, _ = NewClient(DefaultClientProfile(name))
+		clients[name] = client
+	}
+	return client
+}
+
+// Probe checks that an upstream service answers a GET of address, using the
+// named profile's client but without retries or circuit breaking. As probes
+// carry no credentials, any status below 500 counts as an answer.
+func Probe(ctx context.Context, profile, address string) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", address, nil)
+	if err != nil {
+		return 0, err
+	}
+	response, err := Client(profile).Do(request)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+	if response.StatusCode >= 500 {
+		return response.StatusCode, fmt.Errorf("%v returned %v", address, response.Status)
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDefaultClientProfile(t *testing.T) {
+	if landsat := DefaultClientProfile(LandsatProfile); landsat.Timeout <= DefaultClientProfile(PlanetProfile).Timeout {
+		t.Errorf("DefaultClientProfile: expected a longer timeout for landsat, received %v", landsat.Timeout)
+	}
+	if profile := DefaultClientProfile(PlanetProfile); profile.InsecureSkipVerify || profile.Timeout == 0 {
+		t.Errorf("DefaultClientProfile: expected verification and timeouts by default, received %#v", profile)
+	}
+}
+
+// writeTestingCert writes a self-signed certificate and its key
+// to PEM files, returning their names and the certificate
+func writeTestingCert(t *testing.T, dir string, name string) (string, string, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestNewClientTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "clients")
+	defer os.RemoveAll(dir)
+	clientCertFile, clientKeyFile, clientCert := writeTestingCert(t, dir, "client")
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("ok"))
+	}))
+	clientCAs := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(clientCert.Certificate[0])
+	clientCAs.AddCert(leaf)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := filepath.Join(dir, "ca.crt")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	get := func(profile ClientProfile) error {
+		client, err := NewClient(profile)
+		if err != nil {
+			return err
+		}
+		response, err := client.Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+		return err
+	}
+	profile := DefaultClientProfile(DefaultProfile)
+	if err := get(profile); err == nil {
+		t.Error("NewClient: expected an unknown certificate authority to be refused")
+	}
+	profile.CAFile = caFile
+	if err := get(profile); err == nil {
+		t.Error("NewClient: expected the server to require a client certificate")
+	}
+	profile.CertFile, profile.KeyFile = clientCertFile, clientKeyFile
+	if err := get(profile); err != nil {
+		t.Errorf("NewClient: expected mutual TLS to succeed, received %v", err)
+	}
+
+	profile.CAFile = filepath.Join(dir, "client.key")
+	if _, err := NewClient(profile); err == nil {
+		t.Error("NewClient: expected a CA file without certificates to fail")
+	}
+	profile.CAFile = ""
+	profile.KeyFile = filepath.Join(dir, "missing.key")
+	if _, err := NewClient(profile); err == nil {
+		t.Error("NewClient: expected a missing key file to fail")
+	}
+}
+
+func TestNewClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		proxied = request.URL.String()
+		writer.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+	profile := DefaultClientProfile(DefaultProfile)
+	profile.Proxy = proxy.URL
+	client, err := NewClient(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := client.Get("http://upstream.example.com/data"); err != nil {
+		t.Errorf("NewClient: expected the proxy to answer, received %v", err)
+	} else {
+		response.Body.Close()
+	}
+	if proxied != "http://upstream.example.com/data" {
+		t.Errorf("NewClient: expected the request to go through the proxy, received %#v", proxied)
+	}
+	profile.Proxy = "ftp://proxy.example.com"
+	if _, err := NewClient(profile); err == nil {
+		t.Error("NewClient: expected an unsupported proxy scheme to fail")
+	}
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	profile := DefaultClientProfile(DefaultProfile)
+	profile.ReadTimeout = 10 * time.Millisecond
+	client, _ := NewClient(profile)
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("NewClient: expected a slow response to time out")
+	}
+}
+
+func TestClientMisconfigured(t *testing.T) {
+	defer func() {
+		clientsMutex.Lock()
+		delete(clients, SentinelProfile)
+		clientsMutex.Unlock()
+	}()
+	before := Client(PlanetProfile)
+	misconfigured := DefaultClientProfile(SentinelProfile)
+	misconfigured.CAFile = "/does/not/exist.pem"
+	err := SetClientProfiles(map[string]ClientProfile{PlanetProfile: DefaultClientProfile(PlanetProfile), SentinelProfile: misconfigured})
+	if err == nil {
+		t.Error("SetClientProfiles: expected a missing CA file to fail")
+	}
+	if Client(PlanetProfile) != before {
+		t.Error("SetClientProfiles: expected no client to be replaced when one is misconfigured")
+	}
+	if err := SetClientProfiles(map[string]ClientProfile{PlanetProfile: DefaultClientProfile(PlanetProfile)}); err != nil || Client(PlanetProfile) == before {
+		t.Errorf("SetClientProfiles: expected the planet client to be replaced, received %v", err)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	status := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(status)
+	}))
+	defer server.Close()
+	if code, err := Probe(context.Background(), TidesProfile, server.URL); err != nil || code != status {
+		t.Errorf("Probe: expected %v to count as an answer; got %v, %v", status, code, err)
+	}
+	status = http.StatusBadGateway
+	if code, err := Probe(context.Background(), TidesProfile, server.URL); err == nil || code != status {
+		t.Errorf("Probe: expected %v to fail; got %v, %v", status, code, err)
+	}
+	server.Close()
+	if _, err := Probe(context.Background(), TidesProfile, server.URL); err == nil {
+		t.Error("Probe: expected an unreachable server to fail")
+	}
+}
@@ -15,7 +15,7 @@
 package util
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 )
 
@@ -43,7 +43,7 @@ type Error struct {
 //
 
 // GenExtendedMsg is used to generate extended log messages from Error objects
-// for the cases where that's appropriate
+// for the cases where that's appropriate.  Secrets are redacted.
 func (err Error) GenExtendedMsg() string {
 	lineBreak := "\n/**************************************/\n"
 	outBody := "Http Error: " + err.LogMsg + lineBreak
@@ -60,7 +60,7 @@ func (err Error) GenExtendedMsg() string {
 		outBody += "\nHTTP Status: " + http.StatusText(err.HTTPStatus) + "\n"
 	}
 	outBody += lineBreak
-	return outBody
+	return Redact(outBody)
 }
 
 // Log is intended as the base way to generate logging information for an Error
@@ -82,12 +82,12 @@ func (err *Error) Log(s LogContext, msgAdd string) LoggedError {
 		if err.Request != "" || err.Response != "" {
 			outMsg = err.GenExtendedMsg()
 		}
-		logMessage(s, "ERROR", outMsg)
+		logMessage(s, ERROR, outMsg)
 		err.hasLogged = true
 	} else {
-		logMessage(s, "ERROR", "Meta-error.  Tried to log same message for a second time.")
+		logMessage(s, ERROR, "Meta-error.  Tried to log same message for a second time.")
 	}
-	return fmt.Errorf(err.Error())
+	return errors.New(err.Error())
 }
 
 // Error here is intended to let pzsvc.Error objects serve the error interface, and,
@@ -16,43 +16,40 @@ package util
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-var httpClient *http.Client
-
 // HTTPErr represents any HTTP error
 type HTTPErr struct {
-	Status  int
-	Message string
+	Status     int
+	Message    string
+	RetryAfter time.Duration // if set, when the client may retry
 }
 
 func (err HTTPErr) Error() string {
 	return fmt.Sprintf("%d: %v", err.Status, err.Message)
 }
 
-// HTTPClient is a factory method for a http.Client suitable for common operations
+// HTTPClient returns the client for the default profile, used by
+// requests that are not to any particular upstream service
 func HTTPClient() *http.Client {
-	if httpClient == nil {
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-
-		httpClient = &http.Client{Transport: transport}
-	}
-	return httpClient
+	return Client(DefaultProfile)
 }
 
-// SetHTTPClient is used to set the current http client.  This is mostly useful
-// for testing purposes
+// SetHTTPClient is used to set the client for the default profile.  This
+// is mostly useful for testing purposes
 func SetHTTPClient(newClient *http.Client) {
-	httpClient = newClient
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	clients[DefaultProfile] = newClient
 }
 
 // RequestKnownJSON submits an http request where the response is assumed to be JSON
@@ -98,7 +95,6 @@ func SubmitMultipart(bodyStr, address, filename, authKey string, fileData []byte
 	var (
 		body   = &bytes.Buffer{}
 		writer = multipart.NewWriter(body)
-		client = HTTPClient()
 		err    error
 	)
 
@@ -136,7 +132,7 @@ func SubmitMultipart(bodyStr, address, filename, authKey string, fileData []byte
 	fileReq.Header.Add("Content-Type", writer.FormDataContentType())
 	fileReq.Header.Add("Authorization", authKey)
 
-	resp, err := client.Do(fileReq)
+	resp, err := Do(DefaultProfile, fileReq)
 	if err != nil {
 		return nil, &Error{LogMsg: "Error on POST multipart: " + err.Error(), URL: address, Request: bodyStr, SimpleMsg: "HTTP error on file upload.  See logs."}
 	}
@@ -156,7 +152,6 @@ func SubmitSinglePart(method, bodyStr, url, authKey string) (*http.Response, err
 	var (
 		fileReq *http.Request
 		err     error
-		client  = HTTPClient()
 	)
 
 	if method == "" || url == "" {
@@ -178,7 +173,7 @@ func SubmitSinglePart(method, bodyStr, url, authKey string) (*http.Response, err
 
 	fileReq.Header.Add("Authorization", authKey)
 
-	resp, err := client.Do(fileReq)
+	resp, err := Do(DefaultProfile, fileReq)
 	if err != nil {
 		return nil, &Error{LogMsg: err.Error(), Request: bodyStr}
 	}
@@ -237,7 +232,7 @@ func Preflight(w http.ResponseWriter, r *http.Request, lc LogContext) bool {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers",
-			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Planet-Key")
 	}
 
 	if r.Method == "OPTIONS" {
@@ -259,14 +254,58 @@ func PrintJSON(w http.ResponseWriter, output interface{}, httpStatus int) []byte
 	return outBuf
 }
 
-// HTTPError provides an error message that conceals the detailed information for security reasons
+// BaseURL returns the scheme and host that the client used to reach us,
+// honoring X-Forwarded-Proto from a proxy that terminates TLS
+func BaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// HTTPError provides an error message that conceals the detailed information for security reasons.
+// The message ends with the request ID, if there is one, so that the error can be found in the logs.
 func HTTPError(r *http.Request, w http.ResponseWriter, context LogContext, message string, status int) {
 	if status == 0 {
 		status = http.StatusInternalServerError
 	}
 	LogAudit(context, LogAuditInput{Actor: r.URL.String(), Action: r.Method + " response", Actee: "anon user", Message: "Returning error response", Severity: INFO})
-	if message == "" {
+	id := RequestID(r.Context())
+	switch {
+	case message == "" && id != "":
+		message = fmt.Sprintf("An error occurred. Please contact your system administrator. Request ID: %v", id)
+	case message == "":
 		message = fmt.Sprintf("An error occurred. Please contact your system administrator. Session ID: %v", context.SessionID())
+	case id != "":
+		message = fmt.Sprintf("%v\nRequest ID: %v", message, id)
+	}
+	if id != "" {
+		w.Header().Set(RequestIDHeader, id)
 	}
 	http.Error(w, message, status)
 }
+
+// WriteHTTPErr provides an error response for an HTTPErr,
+// including a Retry-After header if it has one
+func WriteHTTPErr(r *http.Request, w http.ResponseWriter, context LogContext, err HTTPErr) {
+	if err.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	}
+	HTTPError(r, w, context, err.Message, err.Status)
+}
+
+// ParseRetryAfter reads a Retry-After header, which is either a number of
+// seconds or an HTTP date. It returns zero if there is no usable value.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
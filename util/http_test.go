@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestSubmitSinglePart(t *testing.T) {
@@ -209,3 +210,46 @@ func TestUtils(t *testing.T) {
 	t.Log(SliceToCommaSep(uuidSlice))
 
 }
+
+func TestBaseURL(t *testing.T) {
+	request := httptest.NewRequest("GET", "http://broker.example.com/planet/discover/rapideye?bbox=1,2,3,4", nil)
+	if result := BaseURL(request); result != "http://broker.example.com" {
+		t.Errorf("BaseURL: expected http://broker.example.com, received %v", result)
+	}
+	request.Header.Set("X-Forwarded-Proto", "https")
+	if result := BaseURL(request); result != "https://broker.example.com" {
+		t.Errorf("BaseURL: did not honor X-Forwarded-Proto, received %v", result)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	if result := ParseRetryAfter("120", now); result != 2*time.Minute {
+		t.Errorf("ParseRetryAfter: expected 2m0s for seconds, received %v", result)
+	}
+	if result := ParseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now); result != 30*time.Second {
+		t.Errorf("ParseRetryAfter: expected 30s for a date, received %v", result)
+	}
+	for _, value := range []string{"", "soon", "-5", now.Add(-time.Minute).Format(http.TimeFormat)} {
+		if result := ParseRetryAfter(value, now); result != 0 {
+			t.Errorf("ParseRetryAfter: expected 0 for %#v, received %v", value, result)
+		}
+	}
+}
+
+func TestWriteHTTPErr(t *testing.T) {
+	request := httptest.NewRequest("GET", "/planet/discover/rapideye", nil)
+	writer := httptest.NewRecorder()
+	WriteHTTPErr(request, writer, &BasicLogContext{}, HTTPErr{Status: http.StatusTooManyRequests, Message: "Slow down", RetryAfter: 1500 * time.Millisecond})
+	if writer.Code != http.StatusTooManyRequests {
+		t.Errorf("WriteHTTPErr: expected status 429, received %v", writer.Code)
+	}
+	if value := writer.Header().Get("Retry-After"); value != "2" {
+		t.Errorf("WriteHTTPErr: expected Retry-After 2, received %#v", value)
+	}
+	writer = httptest.NewRecorder()
+	WriteHTTPErr(request, writer, &BasicLogContext{}, HTTPErr{Status: http.StatusBadRequest, Message: "Bad"})
+	if value := writer.Header().Get("Retry-After"); value != "" {
+		t.Errorf("WriteHTTPErr: expected no Retry-After, received %#v", value)
+	}
+}
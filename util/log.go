@@ -16,7 +16,7 @@ package util
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -28,6 +28,7 @@ import (
 // various constants representing the levels of severity for a given audit message
 const (
 	FATAL    = 0
+	ALERT    = 1
 	CRITICAL = 2
 	ERROR    = 3
 	WARN     = 4
@@ -43,25 +44,72 @@ type LogContext interface {
 	LogRootDir() string // The root directory that has all associated go packages that use pzsvc logging.  Helps keep file locs short.
 }
 
-// logFunc is the function used to add entries to the log
+// logFunc, when set, receives each entry formatted as JSON in place of the
+// logger's sinks
 var (
 	logFunc func(string)
 )
 
-func init() {
-	logFunc = func(logString string) {
-		fmt.Println(logString)
+// SetLogFunc replaces the sinks of the logger with a function receiving
+// each entry formatted as JSON, returning the previous function.  A nil
+// function restores the sinks.  This is mostly useful for testing purposes
+func SetLogFunc(newFunc func(string)) func(string) {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	oldFunc := logFunc
+	logFunc = newFunc
+	return oldFunc
+}
+
+// FlushLogs writes out any log entries that have not been written yet.
+// It is called when the broker shuts down.
+func FlushLogs() {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	logger.Flush()
+}
+
+var (
+	hostName, _ = os.Hostname()
+	processID   = os.Getpid()
+)
+
+// newEntry starts an entry from a log context, whose values are redacted
+func newEntry(lc LogContext, severity int, message string) Entry {
+	entry := Entry{
+		Time:     time.Now(),
+		Severity: severity,
+		App:      lc.AppName(),
+		Session:  lc.SessionID(),
+		Host:     hostName,
+		PID:      processID,
+		Message:  Redact(message),
 	}
+	if rc, ok := lc.(RequestLogContext); ok {
+		entry.RequestID = rc.RequestID()
+	}
+	return entry
 }
 
-// logMessage receives a string to put to the logs.  It formats it correctly
-// and puts it in the right place.  This function exists partially in order
-// to simplify the task of modifying log behavior in the future.  Note that
-// logMessage will panic if no baseLogFunc has been set.  This is a feature,
-// not a bug.  It helps you identify threads that have not been properly
-// readied.  If logMessage panics in this way, the appropriate answer is
-// to call ReadyLog before the first call to logMessage.
-func logMessage(lc LogContext, prefix, message string) {
+// writeEntry sends an entry to the logger, or to logFunc if one is set
+func writeEntry(entry Entry) {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	if !logger.Enabled(entry.Severity) {
+		return
+	}
+	if logFunc != nil {
+		logFunc(entry.Format(JSONFormat))
+		return
+	}
+	logger.Log(entry)
+}
+
+// logMessage receives a string to put to the logs.  It records where it
+// was called from and sends it to the logger.  This function exists
+// partially in order to simplify the task of modifying log behavior in
+// the future.
+func logMessage(lc LogContext, severity int, message string) {
 	_, file, line, _ := runtime.Caller(2)
 	if lc.LogRootDir() != "" {
 		splits := strings.SplitAfter(file, lc.LogRootDir())
@@ -69,14 +117,21 @@ func logMessage(lc LogContext, prefix, message string) {
 			file = lc.LogRootDir() + splits[len(splits)-1]
 		}
 	}
-	outMsg := fmt.Sprintf("%s - [%s:%s %s %d] %s", prefix, lc.AppName(), lc.SessionID(), file, line, message)
-	logFunc(outMsg)
+	entry := newEntry(lc, severity, message)
+	entry.File, entry.Line = file, line
+	writeEntry(entry)
 }
 
 // LogInfo posts a logMessage call for standard, non-error messages.  The
 // point is mostly to maintain uniformity of appearance and behavior.
 func LogInfo(lc LogContext, message string) {
-	logMessage(lc, "INFO", message)
+	logMessage(lc, INFO, message)
+}
+
+// LogDebug posts a logMessage call for detail that is only logged when
+// diagnosing a problem
+func LogDebug(lc LogContext, message string) {
+	logMessage(lc, DEBUG, message)
 }
 
 // LogAlert posts a logMessage call for messages that suggest that someone
@@ -84,7 +139,7 @@ func LogInfo(lc LogContext, message string) {
 // possibility of a significant security vulnerability.  The point of this
 // function is mostly to maintain uniformity of appearance and behavior.
 func LogAlert(lc LogContext, message string) {
-	logMessage(lc, "ALERT", message)
+	logMessage(lc, ALERT, message)
 }
 
 // LogSimpleErr posts a logMessage call for simple error messages, and produces a pzsvc.Error
@@ -98,9 +153,9 @@ func LogSimpleErr(lc LogContext, message string, err error) LoggedError {
 		if err != nil {
 			message += err.Error()
 		}
-		logMessage(lc, "ERROR", message)
+		logMessage(lc, ERROR, message)
 	}
-	return fmt.Errorf(message)
+	return errors.New(message)
 }
 
 // LogAuditInput is the set of inputs for the LogAudit function
@@ -118,12 +173,10 @@ type LogAuditInput struct {
 // uniformity of appearance and behavior, and also to ease maintainability
 // when routing requirements change.
 func LogAudit(lc LogContext, input LogAuditInput) {
-	time := time.Now().UTC().Format("2006-01-02T15:04:05.999Z")
-
-	hostName, _ := os.Hostname()
-	outStr := fmt.Sprintf(`<%d>1 %s %s %s - ID%d [pzaudit@48851 actor="%s" action="%s" actee="%s"] %s`,
-		8+input.Severity, time, hostName, lc.AppName(), os.Getpid(), input.Actor, input.Action, input.Actee, input.Message)
-	logFunc(outStr)
+	entry := newEntry(lc, input.Severity, input.Message)
+	entry.Audit = true
+	entry.Fields = map[string]string{"actor": Redact(input.Actor), "action": Redact(input.Action), "actee": Redact(input.Actee)}
+	writeEntry(entry)
 }
 
 // LogAuditResponse is LogAudit for those cases where it needs to include an HTTP response
@@ -151,6 +204,7 @@ type LoggedError error
 // context information is available.
 type BasicLogContext struct {
 	sessionID string
+	requestID string
 }
 
 // AppName returns a hard-coded string
@@ -170,3 +224,8 @@ func (tc *BasicLogContext) SessionID() string {
 func (tc *BasicLogContext) LogRootDir() string {
 	return ""
 }
+
+// RequestID returns the ID of the request the context is for, if any
+func (tc *BasicLogContext) RequestID() string {
+	return tc.requestID
+}
@@ -0,0 +1,270 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The formats a Logger can write entries in
+const (
+	JSONFormat   = "json"
+	LogfmtFormat = "logfmt"
+	TextFormat   = "text" // the broker's original, unstructured format
+)
+
+// DefaultLogLevel is the least severe level logged unless configured otherwise
+const DefaultLogLevel = INFO
+
+var levelNames = map[int]string{
+	FATAL:    "fatal",
+	ALERT:    "alert",
+	CRITICAL: "critical",
+	ERROR:    "error",
+	WARN:     "warn",
+	NOTICE:   "notice",
+	INFO:     "info",
+	DEBUG:    "debug",
+}
+
+// LevelName returns the name of one of the severity constants
+func LevelName(severity int) string {
+	if name, ok := levelNames[severity]; ok {
+		return name
+	}
+	return strconv.Itoa(severity)
+}
+
+// ParseLevel returns the severity constant with the given name
+func ParseLevel(name string) (int, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		name = "warn"
+	}
+	for severity, levelName := range levelNames {
+		if levelName == name {
+			return severity, nil
+		}
+	}
+	return 0, fmt.Errorf("%#v is not a log level", name)
+}
+
+// Entry is a single log entry. Fields holds anything beyond the standard
+// ones, such as the actor, action and actee of an audit entry.
+type Entry struct {
+	Time      time.Time
+	Severity  int
+	App       string
+	Session   string
+	RequestID string
+	Host      string
+	PID       int
+	File      string
+	Line      int
+	Message   string
+	Audit     bool
+	Fields    map[string]string
+}
+
+// Format renders the entry in one of the log formats
+func (e Entry) Format(format string) string {
+	switch format {
+	case LogfmtFormat:
+		return e.logfmt()
+	case TextFormat:
+		return e.text()
+	default:
+		return e.json()
+	}
+}
+
+// fieldNames returns the names of the extra fields in a stable order
+func (e Entry) fieldNames() []string {
+	var names []string
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e Entry) json() string {
+	var buffer bytes.Buffer
+	add := func(key string, value interface{}) {
+		if buffer.Len() == 0 {
+			buffer.WriteByte('{')
+		} else {
+			buffer.WriteByte(',')
+		}
+		bytes, _ := json.Marshal(key)
+		buffer.Write(bytes)
+		buffer.WriteByte(':')
+		bytes, _ = json.Marshal(value)
+		buffer.Write(bytes)
+	}
+	add("time", e.Time.UTC().Format(time.RFC3339Nano))
+	add("level", LevelName(e.Severity))
+	add("app", e.App)
+	if e.Session != "" {
+		add("session", e.Session)
+	}
+	if e.RequestID != "" {
+		add("requestID", e.RequestID)
+	}
+	if e.File != "" {
+		add("file", e.File)
+		add("line", e.Line)
+	}
+	if e.Audit {
+		add("audit", true)
+	}
+	for _, name := range e.fieldNames() {
+		add(name, e.Fields[name])
+	}
+	add("msg", e.Message)
+	buffer.WriteByte('}')
+	return buffer.String()
+}
+
+func (e Entry) logfmt() string {
+	var pairs []string
+	add := func(key, value string) {
+		if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+			value = strconv.Quote(value)
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	add("time", e.Time.UTC().Format(time.RFC3339Nano))
+	add("level", LevelName(e.Severity))
+	add("app", e.App)
+	if e.Session != "" {
+		add("session", e.Session)
+	}
+	if e.RequestID != "" {
+		add("requestID", e.RequestID)
+	}
+	if e.File != "" {
+		add("file", e.File)
+		add("line", strconv.Itoa(e.Line))
+	}
+	if e.Audit {
+		add("audit", "true")
+	}
+	for _, name := range e.fieldNames() {
+		add(name, e.Fields[name])
+	}
+	add("msg", e.Message)
+	return strings.Join(pairs, " ")
+}
+
+func (e Entry) text() string {
+	if e.Audit {
+		return fmt.Sprintf(`<%d>1 %s %s %s - ID%d [pzaudit@48851 actor="%s" action="%s" actee="%s"] %s`,
+			8+e.Severity, e.Time.UTC().Format("2006-01-02T15:04:05.999Z"), e.Host, e.App, e.PID,
+			e.Fields["actor"], e.Fields["action"], e.Fields["actee"], e.Message)
+	}
+	prefix, session := strings.ToUpper(LevelName(e.Severity)), e.Session
+	if e.RequestID != "" {
+		session += " request=" + e.RequestID
+	}
+	return fmt.Sprintf("%s - [%s:%s %s %d] %s", prefix, e.App, session, e.File, e.Line, e.Message)
+}
+
+// A Sink is somewhere log entries are written
+type Sink interface {
+	Write(entry Entry) error
+	Flush() error
+	Close() error
+}
+
+// Logger writes each entry at or above its level to all of its sinks
+type Logger struct {
+	Level int
+	sinks []Sink
+}
+
+// NewLogger returns a logger writing entries at or above level to the sinks
+func NewLogger(level int, sinks ...Sink) *Logger {
+	return &Logger{Level: level, sinks: sinks}
+}
+
+// Enabled reports whether entries of the given severity are written
+func (l *Logger) Enabled(severity int) bool {
+	return severity <= l.Level
+}
+
+// Log writes an entry. A sink that fails is reported on standard error so
+// that the other sinks still receive the entry.
+func (l *Logger) Log(entry Entry) {
+	if !l.Enabled(entry.Severity) {
+		return
+	}
+	for _, sink := range l.sinks {
+		if err := sink.Write(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write log entry: %v\n", err)
+		}
+	}
+}
+
+// Flush writes out anything the sinks are holding
+func (l *Logger) Flush() {
+	for _, sink := range l.sinks {
+		sink.Flush()
+	}
+}
+
+// Close flushes and releases the sinks
+func (l *Logger) Close() {
+	for _, sink := range l.sinks {
+		sink.Flush()
+		sink.Close()
+	}
+}
+
+var (
+	loggerMutex sync.RWMutex
+	logger      = NewLogger(DefaultLogLevel, NewWriterSink(os.Stdout, JSONFormat))
+)
+
+// loggerCloseDelay is how long a replaced logger stays open for callers
+// that fetched it with CurrentLogger before it was replaced
+var loggerCloseDelay = 5 * time.Second
+
+// SetLogger replaces the logger used by LogInfo, LogAudit and the rest. The
+// previous one is flushed at once but closed only after loggerCloseDelay, so
+// that callers still holding it do not write to closed sinks.
+func SetLogger(newLogger *Logger) {
+	loggerMutex.Lock()
+	oldLogger := logger
+	logger = newLogger
+	loggerMutex.Unlock()
+	oldLogger.Flush()
+	time.AfterFunc(loggerCloseDelay, oldLogger.Close)
+}
+
+// CurrentLogger returns the logger in use
+func CurrentLogger() *Logger {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	return logger
+}
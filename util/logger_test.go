@@ -0,0 +1,375 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testingEntry = Entry{
+	Time:     time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+	Severity: INFO,
+	App:      "bf-ia-broker",
+	Session:  "abc",
+	Host:     "host",
+	PID:      42,
+	Message:  `Receiving "request"`,
+	Audit:    true,
+	Fields:   map[string]string{"actor": "anon user", "action": "GET", "actee": "/planet"},
+}
+
+func TestEntryFormat(t *testing.T) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(testingEntry.Format(JSONFormat)), &values); err != nil {
+		t.Fatalf("Expected JSON but received %v", err)
+	}
+	for key, expected := range map[string]interface{}{"level": "info", "msg": `Receiving "request"`, "actor": "anon user", "session": "abc", "audit": true, "time": "2024-03-01T12:30:00Z"} {
+		if values[key] != expected {
+			t.Errorf("Expected %v to be %v but received %v", key, expected, values[key])
+		}
+	}
+
+	expected := `time=2024-03-01T12:30:00Z level=info app=bf-ia-broker session=abc audit=true actee=/planet action=GET actor="anon user" msg="Receiving \"request\""`
+	if result := testingEntry.Format(LogfmtFormat); result != expected {
+		t.Errorf("Expected %v but received %v", expected, result)
+	}
+
+	expected = `<14>1 2024-03-01T12:30:00Z host bf-ia-broker - ID42 [pzaudit@48851 actor="anon user" action="GET" actee="/planet"] Receiving "request"`
+	if result := testingEntry.Format(TextFormat); result != expected {
+		t.Errorf("Expected %v but received %v", expected, result)
+	}
+	entry := Entry{Severity: ERROR, App: "bf-ia-broker", Session: "abc", File: "log.go", Line: 7, Message: "Failed"}
+	if result := entry.Format(TextFormat); result != "ERROR - [bf-ia-broker:abc log.go 7] Failed" {
+		t.Errorf("Expected the original format but received %v", result)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]int{"debug": DEBUG, "INFO": INFO, "warning": WARN, " error ": ERROR, "alert": ALERT} {
+		if level, err := ParseLevel(name); err != nil || level != expected {
+			t.Errorf("Expected %v to be level %v but received %v, %v", name, expected, level, err)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Errorf("Expected an error for an unknown level")
+	}
+	if LevelName(WARN) != "warn" {
+		t.Errorf("Expected warn but received %v", LevelName(WARN))
+	}
+}
+
+// recordingSink is locked since a replaced logger is closed from a timer
+type recordingSink struct {
+	mutex   sync.Mutex
+	entries []Entry
+	flushed bool
+	closed  bool
+}
+
+func (s *recordingSink) Write(entry Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *recordingSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.flushed = true
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestLoggerLevel(t *testing.T) {
+	sink := &recordingSink{}
+	oldLogger := CurrentLogger()
+	SetLogger(NewLogger(WARN, sink))
+	defer SetLogger(NewLogger(oldLogger.Level, NewWriterSink(os.Stdout, JSONFormat)))
+
+	context := &BasicLogContext{}
+	LogInfo(context, "Not logged")
+	LogAlert(context, "Logged")
+	LogAudit(context, LogAuditInput{Actor: "a", Action: "b", Actee: "c", Message: "Not logged", Severity: DEBUG})
+	LogSimpleErr(context, "Logged", nil)
+	if len(sink.entries) != 2 {
+		t.Fatalf("Expected 2 entries but received %v", len(sink.entries))
+	}
+	if sink.entries[0].Severity != ALERT || sink.entries[0].File == "" || sink.entries[0].Session != context.SessionID() {
+		t.Errorf("Unexpected entry %#v", sink.entries[0])
+	}
+
+	FlushLogs()
+	if !sink.flushed {
+		t.Errorf("Expected the sink to be flushed")
+	}
+}
+
+func TestSetLoggerClosesLater(t *testing.T) {
+	defer func(delay time.Duration) { loggerCloseDelay = delay }(loggerCloseDelay)
+	loggerCloseDelay = 50 * time.Millisecond
+	sink := &recordingSink{}
+	oldLogger := CurrentLogger()
+	SetLogger(NewLogger(INFO, sink))
+	defer SetLogger(NewLogger(oldLogger.Level, NewWriterSink(os.Stdout, JSONFormat)))
+
+	held := CurrentLogger()
+	SetLogger(NewLogger(INFO))
+	sink.mutex.Lock()
+	flushed, closed := sink.flushed, sink.closed
+	sink.mutex.Unlock()
+	if !flushed {
+		t.Errorf("Expected the replaced logger to be flushed at once")
+	}
+	if closed {
+		t.Fatal("Expected the replaced logger to stay open for those holding it")
+	}
+	held.Log(testingEntry)
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		sink.mutex.Lock()
+		closed = sink.closed
+		sink.mutex.Unlock()
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the replaced logger to be closed after %v", loggerCloseDelay)
+		}
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if len(sink.entries) != 1 {
+		t.Errorf("Expected the entry from the held logger but received %v", sink.entries)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "broker.log")
+	line := int64(len(testingEntry.Format(JSONFormat)) + 1)
+	sink, err := NewFileSink(path, JSONFormat, 2*line, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if err = sink.Write(testingEntry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]int64{"broker.log": line, "broker.log.1": 2 * line, "broker.log.2": 2 * line} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil || info.Size() != expected {
+			t.Errorf("Expected %v to have %v bytes but received %v, %v", name, expected, info, err)
+		}
+	}
+	if _, err = os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups")
+	}
+	if err = sink.Write(testingEntry); err == nil {
+		t.Errorf("Expected an error writing to a closed sink")
+	}
+}
+
+func TestFileSinkRotateFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "broker.log")
+	line := int64(len(testingEntry.Format(JSONFormat)) + 1)
+	sink, err := NewFileSink(path, JSONFormat, line, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	// A directory in the way of the backup stops the file being renamed
+	if err = os.MkdirAll(filepath.Join(path+".1", "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sink.Write(testingEntry); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write(testingEntry); err == nil {
+		t.Errorf("Expected the failed rotation to be reported")
+	}
+	if err = sink.Write(testingEntry); err == nil {
+		t.Errorf("Expected the rotation to be tried again and fail")
+	}
+	if err = sink.Flush(); err != nil {
+		t.Errorf("Expected the sink to keep an open file but received %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 3*line {
+		t.Errorf("Expected every entry to be written despite the failures but received %v, %v", info, err)
+	}
+}
+
+func TestFileSinkFlushes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "broker.log")
+	sink, err := NewFileSink(path, JSONFormat, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	line := int64(len(testingEntry.Format(JSONFormat)) + 1)
+
+	warning := testingEntry
+	warning.Severity = WARN
+	if err = sink.Write(warning); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != line {
+		t.Errorf("Expected a warning to be written at once but received %v, %v", info, err)
+	}
+
+	if err = sink.Write(testingEntry); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * fileFlushInterval)
+	for {
+		info, err := os.Stat(path)
+		if err == nil && info.Size() == 2*line {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected buffered entries to be written within %v but received %v, %v", fileFlushInterval, info, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	connection, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	network, address, err := ParseSyslogAddress("udp://" + connection.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewSyslogSink(network, address, TextFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err = sink.Write(testingEntry); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 2048)
+	connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+	count, _, err := connection.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<14>1 2024-03-01T12:30:00Z host bf-ia-broker 42 - [pzaudit@48851 actee="/planet" action="GET" actor="anon user"] Receiving "request"`
+	if string(buffer[:count]) != expected {
+		t.Errorf("Expected %v but received %v", expected, string(buffer[:count]))
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write(testingEntry); err == nil {
+		t.Errorf("Expected an error writing to a closed sink")
+	}
+}
+
+func TestSyslogSinkQueueFull(t *testing.T) {
+	// A sink that never sends, so that its queue fills up
+	sink := &SyslogSink{network: "udp", queue: make(chan syslogItem, 1)}
+	if err := sink.Write(testingEntry); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(testingEntry); err == nil {
+		t.Errorf("Expected an entry to be dropped when the queue is full")
+	}
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		reader := bufio.NewReader(connection)
+		length, _ := reader.ReadString(' ')
+		body := make([]byte, len(syslogMessage(testingEntry, JSONFormat)))
+		reader.Read(body)
+		received <- length + string(body)
+	}()
+	sink, err := NewSyslogSink("tcp", listener.Addr().String(), JSONFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err = sink.Write(testingEntry); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case message := <-received:
+		if !strings.HasSuffix(message, testingEntry.Format(JSONFormat)) || !strings.HasPrefix(message, "2") {
+			t.Errorf("Expected an octet-counted JSON message but received %v", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a message")
+	}
+}
+
+func TestParseSyslogAddress(t *testing.T) {
+	if network, host, err := ParseSyslogAddress("logs:514"); network != "udp" || host != "logs:514" || err != nil {
+		t.Errorf("Expected UDP by default but received %v %v %v", network, host, err)
+	}
+	for _, address := range []string{"http://logs:514", "tcp://logs"} {
+		if _, _, err := ParseSyslogAddress(address); err == nil {
+			t.Errorf("Expected an error for %v", address)
+		}
+	}
+}
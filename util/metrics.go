@@ -0,0 +1,80 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/metrics"
+)
+
+// The metrics of requests made to upstream services. The upstream is the
+// client profile used, and the endpoint is named with WithEndpoint.
+var (
+	upstreamDurations = metrics.NewHistogram("bf_upstream_request_duration_seconds",
+		"Time taken by requests to upstream services, by upstream, endpoint and status.", metrics.DefaultBuckets, "upstream", "endpoint", "status")
+	upstreamErrors = metrics.NewCounter("bf_upstream_errors_total",
+		"Requests to upstream services that failed, by upstream, endpoint and reason.", "upstream", "endpoint", "reason")
+)
+
+// unnamedEndpoint labels requests whose endpoint is not named
+const unnamedEndpoint = "other"
+
+type endpointKey struct{}
+
+// WithEndpoint names the endpoint a request calls, such as quick-search,
+// in the metrics of upstream requests
+func WithEndpoint(request *http.Request, endpoint string) *http.Request {
+	if endpoint == "" {
+		return request
+	}
+	return request.WithContext(context.WithValue(request.Context(), endpointKey{}, endpoint))
+}
+
+func endpointOf(request *http.Request) string {
+	if endpoint, ok := request.Context().Value(endpointKey{}).(string); ok {
+		return endpoint
+	}
+	return unnamedEndpoint
+}
+
+// recordUpstream notes the outcome of one attempt at an upstream request.
+// Server errors, throttling and failures to get a response count as errors.
+func recordUpstream(profile string, request *http.Request, start time.Time, response *http.Response, err error) {
+	endpoint, status := endpointOf(request), "error"
+	if response != nil {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	upstreamDurations.Observe(time.Since(start).Seconds(), profile, endpoint, status)
+	switch {
+	case err != nil:
+		reason := "connection"
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			reason = "timeout"
+		}
+		upstreamErrors.Inc(profile, endpoint, reason)
+	case response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests:
+		upstreamErrors.Inc(profile, endpoint, status)
+	}
+}
+
+// recordCircuitOpen notes a request refused because its host's circuit is open
+func recordCircuitOpen(profile string, request *http.Request) {
+	upstreamErrors.Inc(profile, endpointOf(request), "circuit_open")
+}
@@ -0,0 +1,60 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpstreamMetrics(t *testing.T) {
+	SetHTTPClient(&http.Client{})
+	defer SetResilience(DefaultRetrySettings(), DefaultBreakerSettings())
+	SetResilience(RetrySettings{Attempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, BreakerSettings{Failures: 2, Cooldown: time.Minute})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	response, err := Do(DefaultProfile, WithEndpoint(request, "test-metrics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if count := upstreamDurations.Count(DefaultProfile, "test-metrics", "503"); count != 2 {
+		t.Errorf("Expected 2 timed attempts but received %v", count)
+	}
+	if count := upstreamErrors.Value(DefaultProfile, "test-metrics", "503"); count != 2 {
+		t.Errorf("Expected 2 errors but received %v", count)
+	}
+
+	// The circuit is now open
+	request, _ = http.NewRequest("GET", server.URL, nil)
+	if _, err = Do(DefaultProfile, WithEndpoint(request, "test-metrics")); err == nil {
+		t.Fatal("Expected the open circuit to refuse the request")
+	}
+	if count := upstreamErrors.Value(DefaultProfile, "test-metrics", "circuit_open"); count != 1 {
+		t.Errorf("Expected the refusal to be counted but received %v", count)
+	}
+
+	request, _ = http.NewRequest("GET", "http://127.0.0.1:1", nil)
+	Do(DefaultProfile, request)
+	if count := upstreamErrors.Value(DefaultProfile, unnamedEndpoint, "connection"); count < 1 {
+		t.Errorf("Expected a connection error for an unnamed endpoint but received %v", count)
+	}
+}
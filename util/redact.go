@@ -0,0 +1,122 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in log output
+const Redacted = "REDACTED"
+
+// minSecretLength keeps registered secrets that are too short to
+// be distinctive from masking ordinary text
+const minSecretLength = 4
+
+// RedactionSettings name the headers, query parameters and JSON fields
+// whose values are masked before anything is logged
+type RedactionSettings struct {
+	Headers    []string
+	Parameters []string
+	Fields     []string
+}
+
+// DefaultRedactionSettings covers the places the broker and Planet Labs
+// carry credentials
+func DefaultRedactionSettings() RedactionSettings {
+	return RedactionSettings{
+		Headers:    []string{"Authorization", "Proxy-Authorization", "X-Planet-Key", "Cookie", "Set-Cookie"},
+		Parameters: []string{"PL_API_KEY", "api_key", "access_token"},
+		Fields:     []string{"PL_API_KEY", "api_key", "apiKey", "access_token", "password", "secret"},
+	}
+}
+
+type redactionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+var (
+	redactionMutex sync.RWMutex
+	redactionRules []redactionRule
+	secrets        []string
+)
+
+func init() {
+	SetRedaction(DefaultRedactionSettings())
+}
+
+// SetRedaction replaces the redaction settings
+func SetRedaction(settings RedactionSettings) {
+	var rules []redactionRule
+	for _, header := range settings.Headers {
+		name := regexp.QuoteMeta(header)
+		rules = append(rules,
+			// Go syntax, as in %#v of an http.Header
+			redactionRule{regexp.MustCompile(`(?i)("` + name + `"\s*:\s*\[\]string\{)[^}]*`), "${1}\"" + Redacted + "\""},
+			// JSON arrays
+			redactionRule{regexp.MustCompile(`(?i)("` + name + `"\s*:\s*\[)[^\]]*`), "${1}\"" + Redacted + "\""},
+			// %v of an http.Header
+			redactionRule{regexp.MustCompile(`(?i)(\b` + name + `:\[)[^\]]*`), "${1}" + Redacted},
+			// HTTP wire format
+			redactionRule{regexp.MustCompile(`(?i)(\b` + name + `:[ \t]*)[^\[\s][^\r\n]*`), "${1}" + Redacted},
+		)
+	}
+	for _, parameter := range settings.Parameters {
+		rules = append(rules, redactionRule{regexp.MustCompile(`(?i)((?:^|[?&;\s"])` + regexp.QuoteMeta(parameter) + `=)[^&#\s"'<>]*`), "${1}" + Redacted})
+	}
+	for _, field := range append(settings.Fields, settings.Headers...) {
+		rules = append(rules, redactionRule{regexp.MustCompile(`(?i)("` + regexp.QuoteMeta(field) + `"\s*:\s*)"(?:[^"\\]|\\.)*"`), "${1}\"" + Redacted + "\""})
+	}
+	redactionMutex.Lock()
+	redactionRules = rules
+	redactionMutex.Unlock()
+}
+
+// AddSecret registers a value, such as a server-side key, that must never
+// be logged wherever it appears. Its Basic authentication forms are
+// registered too.
+func AddSecret(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+	redactionMutex.Lock()
+	defer redactionMutex.Unlock()
+	for _, existing := range secrets {
+		if existing == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret,
+		base64.StdEncoding.EncodeToString([]byte(secret+":")),
+		base64.StdEncoding.EncodeToString([]byte(secret)))
+}
+
+// Redact masks the configured headers, query parameters and JSON fields,
+// and any registered secrets, in a message
+func Redact(message string) string {
+	redactionMutex.RLock()
+	defer redactionMutex.RUnlock()
+	for _, rule := range redactionRules {
+		message = rule.pattern.ReplaceAllString(message, rule.replacement)
+	}
+	for _, secret := range secrets {
+		message = strings.Replace(message, secret, Redacted, -1)
+	}
+	return message
+}
@@ -0,0 +1,107 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testingSecret = "SECRET_KEY"
+
+func TestRedact(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Basic U0VDUkVUX0tFWTo=")
+	header.Set("X-Planet-Key", testingSecret)
+	header.Set("Content-Type", "application/json")
+	tests := []string{
+		fmt.Sprintf("Header:\n%#v", header),
+		fmt.Sprintf("Header: %v", header),
+		"Authorization: api-key " + testingSecret + "\r\nAccept: */*",
+		"GET /planet/discover/rapideye?bbox=1,2,3,4&PL_API_KEY=" + testingSecret + "&cloudCover=10",
+		"PL_API_KEY=" + testingSecret,
+		`{"api_key": "` + testingSecret + `", "name": "value"}`,
+		`{"headers":{"Authorization":["Basic U0VDUkVUX0tFWTo="]}}`,
+	}
+	for _, test := range tests {
+		result := Redact(test)
+		if strings.Contains(result, testingSecret) || strings.Contains(result, "U0VDUkVUX0tFWTo=") {
+			t.Errorf("Expected the secret to be redacted from %v but received %v", test, result)
+		}
+		if !strings.Contains(result, Redacted) {
+			t.Errorf("Expected %v in %v", Redacted, result)
+		}
+	}
+
+	// Everything else is left alone
+	for _, test := range []string{"application/json", "bbox=1,2,3,4&", "&cloudCover=10", `{"name": "value"}`} {
+		if !strings.Contains(Redact(fmt.Sprintf("%#v %v", header, tests[3]+` {"name": "value"}`)), test) {
+			t.Errorf("Expected %v to survive redaction", test)
+		}
+	}
+}
+
+func TestRedactSettings(t *testing.T) {
+	defer SetRedaction(DefaultRedactionSettings())
+	SetRedaction(RedactionSettings{Headers: []string{"X-Custom"}, Parameters: []string{"custom"}, Fields: []string{"customField"}})
+	result := Redact("X-Custom: a1\n?custom=b2 {\"customField\":\"c3\"} ?PL_API_KEY=d4")
+	for _, secret := range []string{"a1", "b2", "c3"} {
+		if strings.Contains(result, secret) {
+			t.Errorf("Expected %v to be redacted from %v", secret, result)
+		}
+	}
+	if !strings.Contains(result, "d4") {
+		t.Errorf("Expected only the configured names to be redacted but received %v", result)
+	}
+}
+
+func TestAddSecret(t *testing.T) {
+	AddSecret("abc")
+	AddSecret("REGISTERED_SECRET")
+	result := Redact("abc REGISTERED_SECRET UkVHSVNURVJFRF9TRUNSRVQ6")
+	if result != "abc REDACTED REDACTED" {
+		t.Errorf("Expected registered secrets, but not short ones, to be redacted but received %v", result)
+	}
+}
+
+func TestLogRedaction(t *testing.T) {
+	var output []string
+	oldFunc := SetLogFunc(func(message string) { output = append(output, message) })
+	defer SetLogFunc(oldFunc)
+
+	context := &BasicLogContext{}
+	url := "/planet/discover/rapideye?PL_API_KEY=" + testingSecret
+	LogInfo(context, "Requesting "+url)
+	LogAlert(context, "Authorization: api-key "+testingSecret)
+	LogSimpleErr(context, "Failed: ", errors.New(url))
+	LogAudit(context, LogAuditInput{Actor: "anon user", Action: "GET", Actee: url, Message: "Receiving request", Severity: INFO})
+	err := Error{LogMsg: "Failed", URL: url, Request: `{"api_key":"` + testingSecret + `"}`, HTTPStatus: 400}
+	err.Log(context, "")
+	if strings.Contains(err.GenExtendedMsg(), testingSecret) {
+		t.Errorf("Expected the extended message to be redacted")
+	}
+
+	if len(output) != 5 {
+		t.Errorf("Expected 5 log entries but received %v", len(output))
+	}
+	for _, message := range output {
+		if strings.Contains(message, testingSecret) {
+			t.Errorf("Expected the secret to be redacted from %v", message)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID that correlates a request with its log
+// entries, its upstream requests and its response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the IDs accepted from clients
+const maxRequestIDLength = 128
+
+// upstreamRequestIDHeaders are where upstream services report the IDs they
+// gave our requests
+var upstreamRequestIDHeaders = []string{RequestIDHeader, "X-Amzn-RequestId", "X-Amz-Request-Id", "X-Correlation-ID"}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying a request ID
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts IDs that cannot disturb log entries or headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, char := range id {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case char == '-', char == '_', char == '.', char == ':', char == '/', char == '+', char == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID gives each request the ID in its X-Request-ID header, or a
+// new one if it has none that is usable, and returns the ID in the response
+func WithRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id, _ = PsuUUID()
+		}
+		writer.Header().Set(RequestIDHeader, id)
+		handler.ServeHTTP(writer, request.WithContext(ContextWithRequestID(request.Context(), id)))
+	})
+}
+
+// UpstreamRequestID returns the ID an upstream service gave a request, or ""
+func UpstreamRequestID(response *http.Response) string {
+	for _, header := range upstreamRequestIDHeaders {
+		if id := response.Header.Get(header); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// A RequestLogContext is a LogContext for work done on behalf of a
+// request. Its log entries carry the request ID.
+type RequestLogContext interface {
+	LogContext
+	RequestID() string
+}
+
+// NewRequestLogContext returns a log context for the request ctx carries
+func NewRequestLogContext(ctx context.Context) *BasicLogContext {
+	return &BasicLogContext{requestID: RequestID(ctx)}
+}
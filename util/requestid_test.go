@@ -0,0 +1,113 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var received string
+	handler := WithRequestID(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		received = RequestID(request.Context())
+	}))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(RequestIDHeader, "client-id.1")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if received != "client-id.1" || recorder.Header().Get(RequestIDHeader) != "client-id.1" {
+		t.Errorf("WithRequestID: expected the client's ID, received %v and %v", received, recorder.Header().Get(RequestIDHeader))
+	}
+
+	for _, id := range []string{"", "bad id\nINFO - forged", strings.Repeat("a", maxRequestIDLength+1)} {
+		request = httptest.NewRequest("GET", "/", nil)
+		request.Header.Set(RequestIDHeader, id)
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if received == "" || received == id || recorder.Header().Get(RequestIDHeader) != received {
+			t.Errorf("WithRequestID: expected a new ID in place of %#v, received %v", id, received)
+		}
+	}
+}
+
+func TestRequestIDLogged(t *testing.T) {
+	var output []string
+	oldFunc := SetLogFunc(func(message string) { output = append(output, message) })
+	defer SetLogFunc(oldFunc)
+
+	LogInfo(NewRequestLogContext(ContextWithRequestID(httptest.NewRequest("GET", "/", nil).Context(), "abc-123")), "Message")
+	LogInfo(&BasicLogContext{}, "Message")
+	var entries []map[string]interface{}
+	for _, line := range output {
+		var entry map[string]interface{}
+		json.Unmarshal([]byte(line), &entry)
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 || entries[0]["requestID"] != "abc-123" || entries[1]["requestID"] != nil {
+		t.Errorf("Expected only the first entry to have a request ID, received %v", output)
+	}
+}
+
+func TestHTTPErrorRequestID(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request = request.WithContext(ContextWithRequestID(request.Context(), "abc-123"))
+	recorder := httptest.NewRecorder()
+	HTTPError(request, recorder, &BasicLogContext{}, "Bad bbox", http.StatusBadRequest)
+	if body := recorder.Body.String(); body != "Bad bbox\nRequest ID: abc-123\n" {
+		t.Errorf("HTTPError: expected the request ID in the body, received %#v", body)
+	}
+	if recorder.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("HTTPError: expected the request ID header")
+	}
+
+	recorder = httptest.NewRecorder()
+	HTTPError(httptest.NewRequest("GET", "/", nil), recorder, &BasicLogContext{}, "Bad bbox", http.StatusBadRequest)
+	if body := recorder.Body.String(); body != "Bad bbox\n" {
+		t.Errorf("HTTPError: expected no request ID, received %#v", body)
+	}
+}
+
+func TestDoRequestID(t *testing.T) {
+	SetHTTPClient(&http.Client{})
+	var forwarded string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		forwarded = request.Header.Get(RequestIDHeader)
+		writer.Header().Set("X-Amzn-RequestId", "upstream-456")
+		writer.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	var output []string
+	oldFunc := SetLogFunc(func(message string) { output = append(output, message) })
+	defer SetLogFunc(oldFunc)
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	request = request.WithContext(ContextWithRequestID(request.Context(), "abc-123"))
+	response, err := Do(DefaultProfile, request)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	response.Body.Close()
+	if forwarded != "abc-123" {
+		t.Errorf("Do: expected the request ID to be forwarded, received %#v", forwarded)
+	}
+	if len(output) != 1 || !strings.Contains(output[0], "upstream-456") || !strings.Contains(output[0], `"requestID":"abc-123"`) {
+		t.Errorf("Do: expected the upstream request ID to be logged, received %v", output)
+	}
+}
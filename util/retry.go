@@ -0,0 +1,201 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetrySettings control how requests to upstream services are retried
+// after transient failures: connection errors and 502, 503 and 504 responses
+type RetrySettings struct {
+	Attempts  int           // including the first; 1 disables retries
+	BaseDelay time.Duration // before the first retry; it doubles for each one after
+	MaxDelay  time.Duration
+}
+
+// DefaultRetrySettings retries twice, starting after a fifth of a second
+func DefaultRetrySettings() RetrySettings {
+	return RetrySettings{Attempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second}
+}
+
+var (
+	resilienceMutex sync.RWMutex
+	retrySettings   RetrySettings
+)
+
+type retrySafeKey struct{}
+
+func init() {
+	SetResilience(DefaultRetrySettings(), DefaultBreakerSettings())
+}
+
+// SetResilience replaces the retry and circuit breaker settings used by Do,
+// closing every circuit
+func SetResilience(retry RetrySettings, breaker BreakerSettings) {
+	resilienceMutex.Lock()
+	defer resilienceMutex.Unlock()
+	if retry.Attempts < 1 {
+		retry.Attempts = 1
+	}
+	retrySettings = retry
+	breakerSettings = breaker
+	breakers = make(map[string]*circuitBreaker)
+}
+
+// RetrySafe marks a request that is safe to repeat even though its method is
+// not idempotent, such as a POST that only runs a search
+func RetrySafe(request *http.Request) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), retrySafeKey{}, true))
+}
+
+func retryable(request *http.Request) bool {
+	if request.Body != nil && request.GetBody == nil {
+		// The body cannot be sent again
+		return false
+	}
+	switch request.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	safe, _ := request.Context().Value(retrySafeKey{}).(bool)
+	return safe
+}
+
+// Do sends a request with the client for the named profile, through the
+// circuit breaker for its host. Idempotent requests, and those marked by
+// RetrySafe, are retried after transient failures with exponential backoff
+// and jitter. If they keep failing, the last response or error is returned.
+// While the circuit is open, the request is not sent and a 503 HTTPErr is
+// returned. Once the request's context is done, Do stops and returns the
+// error from Canceled. The ID of the request the context is for is sent in
+// the X-Request-ID header, and the ID the upstream gives the request is
+// logged.
+func Do(profile string, request *http.Request) (*http.Response, error) {
+	resilienceMutex.RLock()
+	settings := retrySettings
+	resilienceMutex.RUnlock()
+	attempts := 1
+	if retryable(request) {
+		attempts = settings.Attempts
+	}
+	host := request.URL.Host
+	ctx := request.Context()
+	logContext := NewRequestLogContext(ctx)
+	if id := RequestID(ctx); id != "" && request.Header.Get(RequestIDHeader) == "" {
+		request.Header.Set(RequestIDHeader, id)
+	}
+	for attempt := 1; ; attempt++ {
+		if err := Canceled(ctx); err != nil {
+			logCanceled(logContext, request, err)
+			return nil, err
+		}
+		if wait, ok := allowRequest(host); !ok {
+			recordCircuitOpen(profile, request)
+			return nil, HTTPErr{Status: http.StatusServiceUnavailable, Message: fmt.Sprintf("%v is unavailable; please retry later.", host), RetryAfter: wait}
+		}
+		if attempt > 1 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				releaseTrial(host)
+				return nil, err
+			}
+			request.Body = body
+		}
+		span := startUpstreamSpan(profile, request, attempt)
+		start := time.Now()
+		response, err := Client(profile).Do(request)
+		if err != nil && ctx.Err() != nil {
+			// Giving up on a request says nothing about the host
+			releaseTrial(host)
+			err = Canceled(ctx)
+			endUpstreamSpan(span, nil, err)
+			logCanceled(logContext, request, err)
+			return nil, err
+		}
+		endUpstreamSpan(span, response, err)
+		recordUpstream(profile, request, start, response, err)
+		if response != nil {
+			if id := UpstreamRequestID(response); id != "" {
+				message := fmt.Sprintf("%v %v returned %v; upstream request ID %v", request.Method, request.URL, response.Status, id)
+				if response.StatusCode < 400 {
+					LogDebug(logContext, message)
+				} else {
+					LogInfo(logContext, message)
+				}
+			}
+		}
+		failure := transientFailure(response, err)
+		recordOutcome(host, failure == "")
+		if failure == "" || attempt >= attempts {
+			return response, err
+		}
+		delay := backoff(settings, attempt, response)
+		if response != nil {
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+		LogInfo(logContext, fmt.Sprintf("Retrying %v %v in %v after %v (attempt %d of %d)", request.Method, request.URL, delay, failure, attempt+1, attempts))
+		if err := Sleep(ctx, delay); err != nil {
+			logCanceled(logContext, request, err)
+			return nil, err
+		}
+	}
+}
+
+// logCanceled notes an upstream request abandoned because the request it
+// was made for is done. This is not a failure, so it is not an alert.
+func logCanceled(logContext LogContext, request *http.Request, err error) {
+	LogInfo(logContext, fmt.Sprintf("Abandoned %v %v: %v", request.Method, request.URL, err.(HTTPErr).Message))
+}
+
+// transientFailure describes a failure worth retrying, or returns ""
+func transientFailure(response *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return response.Status
+	}
+	return ""
+}
+
+// backoff returns the delay before the given retry: the base delay doubled
+// for each earlier retry, up to the maximum, with up to half of it random
+// so that clients do not retry in step. A longer Retry-After is honored as
+// long as it is within the maximum.
+func backoff(settings RetrySettings, attempt int, response *http.Response) time.Duration {
+	delay := settings.MaxDelay
+	if attempt < 32 && settings.BaseDelay<<uint(attempt-1) < delay {
+		delay = settings.BaseDelay << uint(attempt-1)
+	}
+	if delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+	}
+	if response != nil {
+		if retryAfter := ParseRetryAfter(response.Header.Get("Retry-After"), time.Now()); retryAfter > delay && retryAfter <= settings.MaxDelay {
+			delay = retryAfter
+		}
+	}
+	return delay
+}
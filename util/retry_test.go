@@ -0,0 +1,218 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createFlakyServer fails the first failures requests it receives, either
+// with the given status or, if it is zero, by dropping the connection
+func createFlakyServer(failures int, status int) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		if requests <= failures {
+			if status == 0 {
+				conn, _, _ := writer.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			writer.WriteHeader(status)
+			return
+		}
+		body, _ := ioutil.ReadAll(request.Body)
+		writer.Write(body)
+	}))
+	return server, &requests
+}
+
+func setTestingResilience(attempts, failures int) {
+	SetHTTPClient(&http.Client{})
+	SetResilience(RetrySettings{Attempts: attempts, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+		BreakerSettings{Failures: failures, Cooldown: 50 * time.Millisecond})
+}
+
+func TestDoRetries(t *testing.T) {
+	setTestingResilience(3, 0)
+	defer SetResilience(DefaultRetrySettings(), DefaultBreakerSettings())
+
+	for _, status := range []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, 0} {
+		server, requests := createFlakyServer(2, status)
+		request, _ := http.NewRequest("GET", server.URL, nil)
+		response, err := Do(DefaultProfile, request)
+		if err != nil || response.StatusCode != http.StatusOK {
+			t.Errorf("Do: expected a retry after %d to succeed, received %v %v", status, response, err)
+		}
+		if *requests != 3 {
+			t.Errorf("Do: expected 3 requests after %d, received %d", status, *requests)
+		}
+		server.Close()
+	}
+
+	// Give up after the last attempt, returning its response
+	server, requests := createFlakyServer(5, http.StatusServiceUnavailable)
+	defer server.Close()
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	if response, err := Do(DefaultProfile, request); err != nil || response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Do: expected the last 503 when retries run out, received %v %v", response, err)
+	}
+	if *requests != 3 {
+		t.Errorf("Do: expected 3 requests, received %d", *requests)
+	}
+
+	// Other failures are not retried
+	server, requests = createFlakyServer(1, http.StatusInternalServerError)
+	defer server.Close()
+	request, _ = http.NewRequest("GET", server.URL, nil)
+	if response, _ := Do(DefaultProfile, request); response.StatusCode != http.StatusInternalServerError || *requests != 1 {
+		t.Errorf("Do: expected a 500 not to be retried, received %v after %d requests", response.StatusCode, *requests)
+	}
+}
+
+func TestDoRetrySafe(t *testing.T) {
+	setTestingResilience(3, 0)
+	defer SetResilience(DefaultRetrySettings(), DefaultBreakerSettings())
+
+	server, requests := createFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+	request, _ := http.NewRequest("POST", server.URL, strings.NewReader("search"))
+	if response, _ := Do(DefaultProfile, request); response.StatusCode != http.StatusServiceUnavailable || *requests != 1 {
+		t.Errorf("Do: expected a POST not to be retried, received %v after %d requests", response.StatusCode, *requests)
+	}
+
+	*requests = 0
+	request, _ = http.NewRequest("POST", server.URL, strings.NewReader("search"))
+	response, err := Do(DefaultProfile, RetrySafe(request))
+	if err != nil || response.StatusCode != http.StatusOK || *requests != 2 {
+		t.Errorf("Do: expected a retry-safe POST to be retried, received %v %v after %d requests", response, err, *requests)
+	} else if body, _ := ioutil.ReadAll(response.Body); string(body) != "search" {
+		t.Errorf("Do: expected the body to be sent again, received %#v", string(body))
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	setTestingResilience(1, 2)
+	defer SetResilience(DefaultRetrySettings(), DefaultBreakerSettings())
+
+	server, requests := createFlakyServer(3, http.StatusServiceUnavailable)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	get := func() (*http.Response, error) {
+		request, _ := http.NewRequest("GET", server.URL, nil)
+		return Do(DefaultProfile, request)
+	}
+
+	get()
+	if state := BreakerStates()[host]; state.State != CircuitClosed || state.Failures != 1 {
+		t.Errorf("BreakerStates: expected a closed circuit with 1 failure, received %#v", state)
+	}
+	get()
+	if state := BreakerStates()[host]; state.State != CircuitOpen || state.OpenUntil == nil {
+		t.Errorf("BreakerStates: expected an open circuit, received %#v", state)
+	}
+
+	// Requests fail without being sent
+	_, err := get()
+	if herr, ok := err.(HTTPErr); !ok || herr.Status != http.StatusServiceUnavailable || herr.RetryAfter <= 0 {
+		t.Errorf("Do: expected a 503 HTTPErr while open, received %#v", err)
+	}
+	if *requests != 2 {
+		t.Errorf("Do: expected no request while open, received %d", *requests)
+	}
+
+	// A failed test request opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if state := BreakerStates()[host]; state.State != CircuitHalfOpen {
+		t.Errorf("BreakerStates: expected a half-open circuit, received %#v", state)
+	}
+	get()
+	if state := BreakerStates()[host]; state.State != CircuitOpen {
+		t.Errorf("BreakerStates: expected a reopened circuit, received %#v", state)
+	}
+
+	// A successful one closes it
+	time.Sleep(60 * time.Millisecond)
+	if response, err := get(); err != nil || response.StatusCode != http.StatusOK {
+		t.Errorf("Do: expected the test request to succeed, received %v %v", response, err)
+	}
+	if _, ok := BreakerStates()[host]; ok {
+		t.Errorf("BreakerStates: expected the circuit to be closed and forgotten")
+	}
+}
+
+func TestCircuitBreakerCanceledTrial(t *testing.T) {
+	setTestingResilience(1, 1)
+	defer SetResilience(DefaultRetrySettings(), DefaultBreakerSettings())
+
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch {
+		case request.URL.Path == "/slow":
+			<-request.Context().Done()
+		case failing:
+			failing = false
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	Do(DefaultProfile, request)
+	if state := BreakerStates()[host]; state.State != CircuitOpen {
+		t.Fatalf("BreakerStates: expected an open circuit, received %#v", state)
+	}
+
+	// Abandon the request testing the half-open circuit
+	time.Sleep(60 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	request, _ = http.NewRequest("GET", server.URL+"/slow", nil)
+	if _, err := Do(DefaultProfile, request.WithContext(ctx)); !IsCanceled(err) {
+		t.Errorf("Do: expected the trial request to be canceled, received %v", err)
+	}
+
+	request, _ = http.NewRequest("GET", server.URL, nil)
+	if response, err := Do(DefaultProfile, request); err != nil || response.StatusCode != http.StatusOK {
+		t.Errorf("Do: expected the next request to be allowed through, received %v %v", response, err)
+	}
+	if _, ok := BreakerStates()[host]; ok {
+		t.Errorf("BreakerStates: expected the circuit to be closed after the next request")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	settings := RetrySettings{Attempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if delay := backoff(settings, attempt+1, nil); delay < expected/2 || delay > expected {
+			t.Errorf("backoff: expected between %v and %v for attempt %d, received %v", expected/2, expected, attempt+1, delay)
+		}
+	}
+	response := &http.Response{Header: http.Header{"Retry-After": []string{"1"}}}
+	if delay := backoff(settings, 1, response); delay != time.Second {
+		t.Errorf("backoff: expected Retry-After to be honored, received %v", delay)
+	}
+	response.Header.Set("Retry-After", "60")
+	if delay := backoff(settings, 1, response); delay > 100*time.Millisecond {
+		t.Errorf("backoff: expected a long Retry-After to be ignored, received %v", delay)
+	}
+}
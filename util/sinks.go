@@ -0,0 +1,402 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriterSink writes each entry as a line to a writer, such as os.Stdout
+type WriterSink struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	format string
+}
+
+// NewWriterSink returns a sink writing entries in the format to writer
+func NewWriterSink(writer io.Writer, format string) *WriterSink {
+	return &WriterSink{writer: writer, format: format}
+}
+
+// Write implements Sink
+func (s *WriterSink) Write(entry Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := io.WriteString(s.writer, entry.Format(s.format)+"\n")
+	return err
+}
+
+// Flush implements Sink, syncing the writer if it is a file
+func (s *WriterSink) Flush() error {
+	if file, ok := s.writer.(*os.File); ok {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return file.Sync()
+	}
+	return nil
+}
+
+// Close implements Sink. The writer is left open, as it belongs to the caller.
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// fileFlushInterval is how long a FileSink may hold entries before writing
+// them to the file
+const fileFlushInterval = time.Second
+
+// FileSink appends entries to a file, rotating it when it grows past its
+// maximum size. Rotated files are named after the file with .1 for the most
+// recent, .2 for the one before and so on. Entries are buffered for up to
+// fileFlushInterval, except warnings and worse, which are written at once.
+type FileSink struct {
+	mutex      sync.Mutex
+	path       string
+	format     string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	writer     *bufio.Writer
+	size       int64
+	closed     bool
+	stop       chan struct{}
+}
+
+// NewFileSink opens path for appending. A maxSize of 0 never rotates it.
+func NewFileSink(path, format string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, format: format, maxSize: maxSize, maxBackups: maxBackups, stop: make(chan struct{})}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	go s.flushEvery(fileFlushInterval)
+	return s, nil
+}
+
+// flushEvery writes out buffered entries periodically until the sink is closed
+func (s *FileSink) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			if s.file != nil {
+				s.writer.Flush()
+			}
+			s.mutex.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.writer, s.size = file, bufio.NewWriter(file), info.Size()
+	return nil
+}
+
+// rotate renames the file and its backups along and starts a new file. The
+// sink never keeps the closed file: if a step fails, it opens the file at its
+// path again, and if even that fails, it has no file until a later Write
+// manages to open one.
+func (s *FileSink) rotate() error {
+	s.writer.Flush()
+	err := s.file.Close()
+	s.file = nil
+	if err == nil {
+		err = s.shift()
+	}
+	if openErr := s.open(); err == nil {
+		err = openErr
+	}
+	return err
+}
+
+// shift renames the file and its backups along, or removes the file if no
+// backups are kept
+func (s *FileSink) shift() error {
+	if s.maxBackups == 0 {
+		return os.Remove(s.path)
+	}
+	for index := s.maxBackups - 1; index > 0; index-- {
+		os.Rename(s.path+"."+strconv.Itoa(index), s.path+"."+strconv.Itoa(index+1))
+	}
+	return os.Rename(s.path, s.path+".1")
+}
+
+// Write implements Sink. An entry is still written when rotating the file
+// fails, as long as a file is open, and the failure is reported.
+func (s *FileSink) Write(entry Entry) error {
+	line := entry.Format(s.format) + "\n"
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("Log file %v is closed", s.path)
+	}
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	var rotateErr error
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if rotateErr = s.rotate(); s.file == nil {
+			return rotateErr
+		}
+	}
+	written, err := s.writer.WriteString(line)
+	s.size += int64(written)
+	if err == nil && entry.Severity <= WARN {
+		err = s.writer.Flush()
+	}
+	if rotateErr != nil {
+		return fmt.Errorf("Failed to rotate log file %v: %v", s.path, rotateErr)
+	}
+	return err
+}
+
+// Flush implements Sink
+func (s *FileSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close implements Sink
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+	if s.file == nil {
+		return nil
+	}
+	s.writer.Flush()
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// syslogFacility is the RFC 5424 user-level facility
+const syslogFacility = 1
+
+// syslogTimeout limits how long a write to the syslog server may take
+const syslogTimeout = 5 * time.Second
+
+// syslogQueueSize is the number of messages a SyslogSink holds while waiting
+// to send them
+const syslogQueueSize = 2048
+
+// SyslogSink sends entries to a syslog server as RFC 5424 messages, over
+// UDP or over TCP with octet-counted framing (RFC 6587). Each message
+// carries the entry in the sink's format, or just its message in the text
+// format. Messages are sent in the background, and those that arrive while
+// the queue is full are dropped rather than slowing requests down. A TCP
+// connection that fails is redialed for the next message.
+type SyslogSink struct {
+	network    string
+	address    string
+	format     string
+	connection net.Conn   // used only by run once the sink is created
+	mutex      sync.Mutex // guards closed and sending to queue
+	closed     bool
+	queue      chan syslogItem
+	done       chan struct{}
+}
+
+// syslogItem is a message to send, or a request to be told once everything
+// queued before it has been sent
+type syslogItem struct {
+	message string
+	flushed chan struct{}
+}
+
+// NewSyslogSink connects to a syslog server. network is "udp" or "tcp".
+func NewSyslogSink(network, address, format string) (*SyslogSink, error) {
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("Syslog network must be udp or tcp, not %#v", network)
+	}
+	s := &SyslogSink{network: network, address: address, format: format,
+		queue: make(chan syslogItem, syslogQueueSize), done: make(chan struct{})}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	go s.run()
+	return s, nil
+}
+
+// ParseSyslogAddress splits an address such as udp://localhost:514 into its
+// network and host. The network defaults to UDP.
+func ParseSyslogAddress(address string) (network, host string, err error) {
+	network, host = "udp", address
+	if parts := strings.SplitN(address, "://", 2); len(parts) == 2 {
+		network, host = parts[0], parts[1]
+	}
+	if network != "udp" && network != "tcp" {
+		return "", "", fmt.Errorf("Syslog address %#v must use udp or tcp", address)
+	}
+	if _, _, err = net.SplitHostPort(host); err != nil {
+		return "", "", fmt.Errorf("Syslog address %#v must have a host and port", address)
+	}
+	return network, host, nil
+}
+
+func (s *SyslogSink) dial() error {
+	connection, err := net.DialTimeout(s.network, s.address, syslogTimeout)
+	if err != nil {
+		return err
+	}
+	s.connection = connection
+	return nil
+}
+
+// syslogMessage renders an entry as an RFC 5424 message
+func syslogMessage(entry Entry, format string) string {
+	host, app, procID := entry.Host, entry.App, "-"
+	if host == "" {
+		host = "-"
+	}
+	if app == "" {
+		app = "-"
+	}
+	if entry.PID != 0 {
+		procID = strconv.Itoa(entry.PID)
+	}
+	data := "-"
+	if entry.Audit {
+		var params []string
+		for _, name := range entry.fieldNames() {
+			params = append(params, name+`="`+syslogParamEscaper.Replace(entry.Fields[name])+`"`)
+		}
+		data = "[pzaudit@48851 " + strings.Join(params, " ") + "]"
+	}
+	message := entry.Message
+	if format != TextFormat {
+		message = entry.Format(format)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s - %s %s", syslogFacility*8+entry.Severity,
+		entry.Time.UTC().Format(time.RFC3339Nano), host, app, procID, data, message)
+}
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "]", `\]`)
+
+// Write implements Sink, queueing the entry to be sent
+func (s *SyslogSink) Write(entry Entry) error {
+	message := syslogMessage(entry, s.format)
+	if s.network == "tcp" {
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("The syslog sink for %v is closed", s.address)
+	}
+	select {
+	case s.queue <- syslogItem{message: message}:
+		return nil
+	default:
+		return fmt.Errorf("The syslog queue for %v is full", s.address)
+	}
+}
+
+// Flush implements Sink, waiting for the messages already queued to be sent
+func (s *SyslogSink) Flush() error {
+	flushed := make(chan struct{})
+	timeout := time.After(syslogTimeout)
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	select {
+	case s.queue <- syslogItem{flushed: flushed}:
+	case <-timeout:
+	}
+	s.mutex.Unlock()
+	select {
+	case <-flushed:
+		return nil
+	case <-timeout:
+		return fmt.Errorf("Timed out sending messages to syslog at %v", s.address)
+	}
+}
+
+// Close implements Sink, sending the messages still queued
+func (s *SyslogSink) Close() error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+	<-s.done
+	return nil
+}
+
+func (s *SyslogSink) run() {
+	defer close(s.done)
+	for item := range s.queue {
+		if item.flushed != nil {
+			close(item.flushed)
+		} else if err := s.send(item.message); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send log entry to syslog: %v\n", err)
+		}
+	}
+	if s.connection != nil {
+		s.connection.Close()
+		s.connection = nil
+	}
+}
+
+func (s *SyslogSink) send(message string) error {
+	if s.connection == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+	s.connection.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := io.WriteString(s.connection, message); err != nil {
+		s.connection.Close()
+		s.connection = nil
+		return err
+	}
+	return nil
+}
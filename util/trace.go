@@ -0,0 +1,50 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
+)
+
+// startUpstreamSpan starts the span of one attempt at an upstream request
+// and sets the request's traceparent header, so that the upstream's spans
+// join the trace. Without a span, the caller's traceparent is passed on.
+func startUpstreamSpan(profile string, request *http.Request, attempt int) *trace.Span {
+	ctx, span := trace.StartKind(request.Context(), trace.KindClient, request.Method+" "+profile+" "+endpointOf(request))
+	trace.Inject(ctx, request.Header)
+	span.SetAttribute("http.method", request.Method)
+	span.SetAttribute("http.url", Redact(request.URL.String()))
+	span.SetAttribute("upstream", profile)
+	if attempt > 1 {
+		span.SetAttribute("retry.attempt", attempt)
+	}
+	return span
+}
+
+// endUpstreamSpan ends the span of an attempt, which failed if there was
+// no response or a server error
+func endUpstreamSpan(span *trace.Span, response *http.Response, err error) {
+	if response != nil {
+		span.SetAttribute("http.status_code", response.StatusCode)
+		if response.StatusCode >= 500 {
+			err = errors.New(response.Status)
+		}
+	}
+	span.SetError(err)
+	span.End()
+}
@@ -0,0 +1,75 @@
+// Copyright 2017, RadiantBlue Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/venicegeo/dg-bf-ia-broker/trace"
+)
+
+func TestDoTrace(t *testing.T) {
+	SetHTTPClient(&http.Client{})
+	defer SetResilience(DefaultRetrySettings(), DefaultBreakerSettings())
+	SetResilience(RetrySettings{Attempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, DefaultBreakerSettings())
+	recorder := &trace.Recorder{}
+	trace.SetExporter(recorder, 1)
+	defer trace.SetExporter(nil, 1)
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		received = append(received, request.Header.Get(trace.TraceparentHeader))
+		if len(received) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	ctx, parent := trace.Start(context.Background(), "parent")
+	request, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	response, err := Do(DefaultProfile, WithEndpoint(request, "test-trace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	parent.End()
+
+	spans := recorder.Spans()
+	if len(spans) != 3 || len(received) != 2 {
+		t.Fatalf("Expected 2 attempts and 3 spans; received %v and %v", len(received), len(spans))
+	}
+	for index, span := range spans[:2] {
+		if span.Name != "GET default test-trace" || span.Kind != trace.KindClient {
+			t.Errorf("Expected a client span for the attempt; received %v %v", span.Kind, span.Name)
+		}
+		if span.ParentSpanID != parent.SpanContext().SpanID {
+			t.Errorf("Expected attempt %d to be a child of the caller's span", index+1)
+		}
+		sc, ok := trace.ParseTraceparent(received[index])
+		if !ok || sc.TraceID != span.TraceID || sc.SpanID != span.SpanID {
+			t.Errorf("Expected attempt %d to carry its span in traceparent; received %#v", index+1, received[index])
+		}
+	}
+	if spans[0].Error != "503 Service Unavailable" || spans[0].Attributes["http.status_code"] != 503 {
+		t.Errorf("Expected the first attempt to fail with a 503; received %#v", spans[0])
+	}
+	if spans[1].Error != "" || spans[1].Attributes["retry.attempt"] != 2 {
+		t.Errorf("Expected the retry to succeed; received %#v", spans[1])
+	}
+}